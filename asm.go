@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+)
+
+// asm [-machine apache8] [-o image.txt] [-symbols image.sym] source.masic
+func asmCommand(args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	machineName := flags.String("machine", "apache8", "machine to assemble the program for")
+	output := flags.String("o", "", "file to write the image to, stdout when empty")
+	symbols := flags.String("symbols", "", "file to write the symbol table to")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: asm [-machine apache8] [-o image.txt] [-symbols image.sym] source.masic")
+	}
+	sourceName := flags.Arg(0)
+
+	target, ok := assembler.Targets[*machineName]
+	if !ok {
+		return fmt.Errorf("no assembler target for machine: %s", *machineName)
+	}
+
+	source, err := os.ReadFile(sourceName)
+	if err != nil {
+		return err
+	}
+
+	program, err := assembler.Assemble(string(source), target)
+	if err != nil {
+		return sourceErrors(sourceName, err)
+	}
+
+	if *symbols != "" {
+		var sb strings.Builder
+		if err := assembler.WriteSymbols(&sb, program.Symbols); err != nil {
+			return err
+		}
+		if err := os.WriteFile(*symbols, []byte(sb.String()), 0644); err != nil {
+			return err
+		}
+	}
+
+	if *output == "" {
+		fmt.Print(program.Format())
+		return nil
+	}
+	return os.WriteFile(*output, []byte(program.Format()), 0644)
+}
+
+// sourceErrors prefixes every assembler error with the file name, as in "sum.masic:3: ..."
+func sourceErrors(sourceName string, err error) error {
+	var list assembler.ErrorList
+	if !errors.As(err, &list) {
+		return err
+	}
+	msgs := make([]string, len(list))
+	for idx, e := range list {
+		msgs[idx] = fmt.Sprintf("%s:%d: %s", sourceName, e.Line, e.Msg)
+	}
+	return errors.New("\n" + strings.Join(msgs, "\n"))
+}
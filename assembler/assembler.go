@@ -0,0 +1,266 @@
+package assembler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var labelRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var registerRegex = regexp.MustCompile(`^[Rr][0-9]+$`)
+
+type statement struct {
+	line        int
+	address     int
+	instruction *Instruction // nil for .data
+	register    string       // register given in place of RegisterPlaceholder
+	operands    []string     // expressions
+}
+
+// Assemble turns MASIC source into a memory image for the target, in two passes,
+// the first gives an address to every symbol and the second encodes the words
+//
+//	        .equ STEP 2        ; constants can be used in any expression
+//	loop:   ADD R0 one         ; comments start with a semicolon
+//	        JUMP loop
+//	        .org 14            ; words are placed from address 14 on
+//	one:    .data 1, STEP * 3  ; one word per value
+func Assemble(source string, target *Target) (*Program, error) {
+	var errs ErrorList
+	program := &Program{
+		Target:  target,
+		Symbols: map[string]Symbol{},
+	}
+
+	// first pass, split the lines and give an address to every symbol
+	var statements []statement
+	var pending []string // labels waiting for the statement that tells their kind
+	var address int = 0
+	var lastLine int = 0
+	for idx, text := range strings.Split(source, "\n") {
+		line := idx + 1
+		if i := strings.Index(text, ";"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+
+		if label, rest, ok := strings.Cut(text, ":"); ok {
+			label = strings.TrimSpace(label)
+			if !labelRegex.MatchString(label) {
+				errs = append(errs, &Error{Line: line, Msg: fmt.Sprintf("invalid label %q", label)})
+			} else if _, ok := program.Symbols[label]; ok {
+				errs = append(errs, &Error{Line: line, Msg: fmt.Sprintf("symbol %q already defined", label)})
+			} else {
+				program.Symbols[label] = Symbol{Name: label, Value: address, Kind: CodeSymbol, Line: line}
+				pending = append(pending, label)
+			}
+			text = strings.TrimSpace(rest)
+		}
+
+		tokens := tokenize(text)
+		if len(tokens) == 0 {
+			continue
+		}
+		lastLine = line
+
+		directive := strings.ToLower(tokens[0])
+		switch {
+		case directive == ".data":
+			rest := strings.TrimSpace(text[len(tokens[0]):])
+			if rest == "" {
+				errs = append(errs, &Error{Line: line, Msg: ".data needs at least one value"})
+				continue
+			}
+			values := strings.Split(rest, ",")
+			for _, label := range pending {
+				symbol := program.Symbols[label]
+				symbol.Kind = DataSymbol
+				program.Symbols[label] = symbol
+			}
+			pending = nil
+			statements = append(statements, statement{line: line, address: address, operands: values})
+			address += len(values)
+		case directive == ".org":
+			val, err := Evaluate(strings.Join(tokens[1:], " "), program.Symbols)
+			if err != nil {
+				errs = append(errs, &Error{Line: line, Msg: err.Error()})
+				continue
+			}
+			if val < address || val > target.MemorySize() {
+				errs = append(errs, &Error{Line: line, Msg: fmt.Sprintf(".org %d must be between %d and %d", val, address, target.MemorySize())})
+				continue
+			}
+			address = val
+			for _, label := range pending {
+				symbol := program.Symbols[label]
+				symbol.Value = address
+				program.Symbols[label] = symbol
+			}
+		case directive == ".equ":
+			if len(tokens) < 3 || !labelRegex.MatchString(tokens[1]) {
+				errs = append(errs, &Error{Line: line, Msg: ".equ expects a name and a value"})
+				continue
+			}
+			if _, ok := program.Symbols[tokens[1]]; ok {
+				errs = append(errs, &Error{Line: line, Msg: fmt.Sprintf("symbol %q already defined", tokens[1])})
+				continue
+			}
+			val, err := Evaluate(strings.Join(tokens[2:], " "), program.Symbols)
+			if err != nil {
+				errs = append(errs, &Error{Line: line, Msg: err.Error()})
+				continue
+			}
+			program.Symbols[tokens[1]] = Symbol{Name: tokens[1], Value: val, Kind: ConstantSymbol, Line: line}
+		case strings.HasPrefix(directive, "."):
+			errs = append(errs, &Error{Line: line, Msg: fmt.Sprintf("unknown directive %q", tokens[0])})
+		default:
+			instruction, register, operands := target.match(tokens)
+			if instruction == nil {
+				errs = append(errs, &Error{Line: line, Msg: fmt.Sprintf("unknown instruction %q", text)})
+				continue
+			}
+			if len(operands) > 0 {
+				operands = []string{strings.Join(operands, " ")}
+			}
+			pending = nil
+			statements = append(statements, statement{line: line, address: address, instruction: instruction, register: register, operands: operands})
+			address++
+		}
+	}
+
+	if address > target.MemorySize() {
+		errs = append(errs, &Error{Line: lastLine, Msg: fmt.Sprintf("program needs %d words, %s memory has %d", address, target.Name, target.MemorySize())})
+	}
+
+	// second pass, encode every statement now that all symbols are known
+	for _, stmt := range statements {
+		words, err := target.encodeStatement(stmt, program.Symbols)
+		if err != nil {
+			errs = append(errs, &Error{Line: stmt.line, Msg: err.Error()})
+			continue
+		}
+		// words skipped by .org are zero
+		for len(program.Words) < stmt.address {
+			program.Words = append(program.Words, 0)
+			program.Lines = append(program.Lines, 0)
+		}
+		for _, word := range words {
+			program.Words = append(program.Words, word)
+			program.Lines = append(program.Lines, stmt.line)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return program, nil
+}
+
+func (t *Target) encodeStatement(stmt statement, symbols map[string]Symbol) ([]uint16, error) {
+	if stmt.instruction == nil {
+		words := make([]uint16, len(stmt.operands))
+		for idx, operand := range stmt.operands {
+			val, err := Evaluate(operand, symbols)
+			if err != nil {
+				return nil, err
+			}
+			if val < -(1<<(t.WordBits-1)) || val >= 1<<t.WordBits {
+				return nil, fmt.Errorf("value %d does not fit in %d bits", val, t.WordBits)
+			}
+			words[idx] = uint16(val) & (1<<t.WordBits - 1)
+		}
+		return words, nil
+	}
+
+	var register uint8 = 0
+	if stmt.register != "" {
+		idx, err := strconv.Atoi(stmt.register[1:])
+		if err != nil || idx >= t.Registers() {
+			return nil, fmt.Errorf("register %s does not exist, %s has R0 to R%d", stmt.register, t.Name, t.Registers()-1)
+		}
+		register = uint8(idx)
+	}
+
+	switch stmt.instruction.Operand {
+	case AddressOperand:
+		if len(stmt.operands) != 1 {
+			return nil, fmt.Errorf("%s expects an address", stmt.instruction.Mnemonic)
+		}
+		val, err := Evaluate(stmt.operands[0], symbols)
+		if err != nil {
+			return nil, err
+		}
+		if val < 0 || val >= t.MemorySize() {
+			return nil, fmt.Errorf("address %d is out of range, max is %d", val, t.MemorySize()-1)
+		}
+		return []uint16{t.Encode(*stmt.instruction, register, uint16(val))}, nil
+	case CountOperand:
+		if len(stmt.operands) != 1 {
+			return nil, fmt.Errorf("%s expects a shift count", stmt.instruction.Mnemonic)
+		}
+		val, err := Evaluate(stmt.operands[0], symbols)
+		if err != nil {
+			return nil, err
+		}
+		if val < 0 || val > t.WordBits {
+			return nil, fmt.Errorf("shift count %d is out of range, max is %d", val, t.WordBits)
+		}
+		return []uint16{t.Encode(*stmt.instruction, register, uint16(val))}, nil
+	default:
+		if len(stmt.operands) != 0 {
+			return nil, fmt.Errorf("%s takes no operand", stmt.instruction.Mnemonic)
+		}
+		return []uint16{t.Encode(*stmt.instruction, register, 0)}, nil
+	}
+}
+
+// match finds the instruction with the longest mnemonic at the start of tokens,
+// along with the register given for RegisterPlaceholder
+func (t *Target) match(tokens []string) (*Instruction, string, []string) {
+	var found *Instruction
+	var foundRegister string
+	var foundLen int = 0
+	for idx := range t.Instructions {
+		mnemonic := tokenize(t.Instructions[idx].Mnemonic)
+		if len(mnemonic) > len(tokens) || len(mnemonic) <= foundLen {
+			continue
+		}
+		matched := true
+		register := ""
+		for i, token := range mnemonic {
+			if token == RegisterPlaceholder && registerRegex.MatchString(tokens[i]) {
+				register = strings.ToUpper(tokens[i])
+				continue
+			}
+			if !strings.EqualFold(token, tokens[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = &t.Instructions[idx]
+			foundRegister = register
+			foundLen = len(mnemonic)
+		}
+	}
+	if found == nil {
+		return nil, "", nil
+	}
+	return found, foundRegister, tokens[foundLen:]
+}
+
+// tokenize splits on spaces, shifts are split from their register, "<<R0" is "<<", "R0"
+func tokenize(text string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(text) {
+		if len(field) > 2 && (strings.HasPrefix(field, "<<") || strings.HasPrefix(field, ">>")) {
+			tokens = append(tokens, field[:2], field[2:])
+			continue
+		}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
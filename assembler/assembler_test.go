@@ -0,0 +1,241 @@
+package assembler
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/machines"
+)
+
+func Test_Assemble_Programs(t *testing.T) {
+	testCases := map[string]struct {
+		source, image string
+		target        *Target
+	}{
+		"sum":         {source: "../programs/sum.masic", image: "../programs/sum.txt", target: Apache8bits},
+		"sub":         {source: "../programs/sub.masic", image: "../programs/sub.txt", target: Apache8bits},
+		"square":      {source: "../programs/square.masic", image: "../programs/square.txt", target: Apache8bits},
+		"fibonacci":   {source: "../programs/fibonacci.masic", image: "../programs/fibonacci.txt", target: Apache8bits},
+		"sum16":       {source: "../programs/sum16.masic", image: "../programs/sum16.txt", target: Apache16bits},
+		"sub16":       {source: "../programs/sub16.masic", image: "../programs/sub16.txt", target: Apache16bits},
+		"mut16":       {source: "../programs/mut16.masic", image: "../programs/mut16.txt", target: Apache16bits},
+		"div16":       {source: "../programs/div16.masic", image: "../programs/div16.txt", target: Apache16bits},
+		"fibonacci16": {source: "../programs/fibonacci16.masic", image: "../programs/fibonacci16.txt", target: Apache16bits},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(testCase.source)
+			assert.NoError(t, err)
+			image, err := os.ReadFile(testCase.image)
+			assert.NoError(t, err)
+
+			program, err := Assemble(string(source), testCase.target)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.TrimSpace(string(image)), strings.TrimSpace(program.Format()))
+		})
+	}
+}
+
+func Test_Assemble(t *testing.T) {
+	program, err := Assemble("start: <<R0 ; shift\n<< r1\n\n  jump r1 if start\nend: .data 0b1010, 0xF, -1, end\n", Apache8bits)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{0b0100_0000, 0b1100_0000, 0b1010_0000, 0b1010, 0b1111, 0b11111111, 3}, program.Words)
+	assert.Equal(t, []int{1, 2, 4, 5, 5, 5, 5}, program.Lines)
+	assert.Equal(t, map[string]Symbol{
+		"start": {Name: "start", Value: 0, Kind: CodeSymbol, Line: 1},
+		"end":   {Name: "end", Value: 3, Kind: DataSymbol, Line: 5},
+	}, program.Symbols)
+}
+
+func Test_Assemble_Directives(t *testing.T) {
+	source := `
+        .equ SIZE 4
+        .equ LAST SIZE * 2 - 1
+        JUMP start
+table:  .data SIZE, (SIZE + 1) * 2, -SIZE, LAST % 3
+start:  LOAD R0 table + 1
+        ADD R0 table+SIZE-1
+        .org LAST
+result:
+        .data start`
+	program, err := Assemble(source, Apache8bits)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{0b0110_0101, 4, 10, 0b11111100, 1, 0b0000_0010, 0b0011_0100, 5}, program.Words)
+	assert.Equal(t, []int{4, 5, 5, 5, 5, 6, 7, 10}, program.Lines)
+	assert.Equal(t, map[string]Symbol{
+		"SIZE":   {Name: "SIZE", Value: 4, Kind: ConstantSymbol, Line: 2},
+		"LAST":   {Name: "LAST", Value: 7, Kind: ConstantSymbol, Line: 3},
+		"table":  {Name: "table", Value: 1, Kind: DataSymbol, Line: 5},
+		"start":  {Name: "start", Value: 5, Kind: CodeSymbol, Line: 6},
+		"result": {Name: "result", Value: 7, Kind: DataSymbol, Line: 9},
+	}, program.Symbols)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteSymbols(&out, program.Symbols))
+	assert.Equal(t, "table 1 data 5\nSIZE 4 const 2\nstart 5 code 6\nLAST 7 const 3\nresult 7 data 9\n", out.String())
+
+	symbols, err := ReadSymbols(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, program.Symbols, symbols)
+
+	_, err = ReadSymbols(strings.NewReader("x 1 label 1\n"))
+	assert.Error(t, err)
+}
+
+func Test_Assemble_Apache16bits(t *testing.T) {
+	program, err := Assemble("LOAD R3 end\n>>R1 3\n<< r2 16\nNOT R0\nJUMP R2 IF 1023\nOUT R1\nend: .data 65535, -32768", Apache16bits)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{
+		0b0000_11_0000000110,
+		0b0111_01_0000000011,
+		0b1000_10_0000010000,
+		0b1001_00_0000000000,
+		0b0010_10_1111111111,
+		0b1110_01_0000000000,
+		0b1111111111111111,
+		0b1000000000000000,
+	}, program.Words)
+	assert.Equal(t, "0000 11 0000000110\n", Apache16bits.FormatWord(program.Words[0])+"\n")
+
+	machine, err := machines.New(Apache16bits.Name, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Apache16bits.MemorySize(), int(machine.MemorySize()))
+
+	_, err = Assemble("LOAD R4 0\nIN 1024\n>>R0 17\n<<R0\nNOT R1 2\nSTOP R1", Apache16bits)
+	assert.Equal(t, ErrorList{
+		{Line: 1, Msg: "register R4 does not exist, apache16 has R0 to R3"},
+		{Line: 2, Msg: "address 1024 is out of range, max is 1023"},
+		{Line: 3, Msg: "shift count 17 is out of range, max is 16"},
+		{Line: 4, Msg: "<<RX expects a shift count"},
+		{Line: 5, Msg: "NOT RX takes no operand"},
+		{Line: 6, Msg: "STOP takes no operand"},
+	}, err)
+}
+
+func Test_Assemble_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		source   string
+		expected ErrorList
+	}{
+		"unknown instruction": {
+			source:   "STOP\nMOV R0 1",
+			expected: ErrorList{{Line: 2, Msg: `unknown instruction "MOV R0 1"`}},
+		},
+		"unknown directive": {
+			source:   ".word 1",
+			expected: ErrorList{{Line: 1, Msg: `unknown directive ".word"`}},
+		},
+		"directives": {
+			source: ".equ X\n.equ 1X 2\n.equ Y Z\n.data 1\n.org 0\n.org 17\n.equ A 1\n.equ A 2\n.data (1\n.data 1/0\n.data 1 $ 2",
+			expected: ErrorList{
+				{Line: 1, Msg: ".equ expects a name and a value"},
+				{Line: 2, Msg: ".equ expects a name and a value"},
+				{Line: 3, Msg: `undefined symbol "Z"`},
+				{Line: 5, Msg: ".org 0 must be between 1 and 16"},
+				{Line: 6, Msg: ".org 17 must be between 1 and 16"},
+				{Line: 8, Msg: `symbol "A" already defined`},
+				{Line: 9, Msg: "missing )"},
+				{Line: 10, Msg: "division by zero"},
+				{Line: 11, Msg: `unexpected '$' in "1 $ 2"`},
+			},
+		},
+		"label": {
+			source: "1a: STOP\nb: STOP\nb: STOP\nJUMP c",
+			expected: ErrorList{
+				{Line: 1, Msg: `invalid label "1a"`},
+				{Line: 3, Msg: `symbol "b" already defined`},
+				{Line: 4, Msg: `undefined symbol "c"`},
+			},
+		},
+		"operands": {
+			source: "STOP 1\nIN\nIN 16\nIN x1y\n.data 256\n.data",
+			expected: ErrorList{
+				{Line: 6, Msg: ".data needs at least one value"},
+				{Line: 1, Msg: "STOP takes no operand"},
+				{Line: 2, Msg: "IN expects an address"},
+				{Line: 3, Msg: "address 16 is out of range, max is 15"},
+				{Line: 4, Msg: `undefined symbol "x1y"`},
+				{Line: 5, Msg: "value 256 does not fit in 8 bits"},
+			},
+		},
+		"numbers": {
+			source: ".data 010\n.data 1_000\n.data 0x\n.data 0o17\n.data 0b0010, 0x0F, 0, 10",
+			expected: ErrorList{
+				{Line: 1, Msg: `invalid number "010", leading zeros are not allowed, use 0b for binary and 0x for hexadecimal`},
+				{Line: 2, Msg: `invalid number "1_000", _ separators are not allowed`},
+				{Line: 3, Msg: `invalid number "0x"`},
+				{Line: 4, Msg: `invalid number "0o17", leading zeros are not allowed, use 0b for binary and 0x for hexadecimal`},
+			},
+		},
+		"too big": {
+			source:   ".data 0, 0, 0, 0, 0, 0, 0, 0\n.data 0, 0, 0, 0, 0, 0, 0, 0\nSTOP",
+			expected: ErrorList{{Line: 3, Msg: "program needs 17 words, apache8 memory has 16"}},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Assemble(testCase.source, Apache8bits)
+			assert.Equal(t, testCase.expected, err)
+		})
+	}
+}
+
+func Test_Target_Decode(t *testing.T) {
+	testCases := map[string]struct {
+		target *Target
+		text   string
+	}{
+		"apache8 LOAD R1":      {target: Apache8bits, text: "LOAD R1 14"},
+		"apache8 JUMP R0 IF":   {target: Apache8bits, text: "JUMP R0 IF 3"},
+		"apache8 <<R1":         {target: Apache8bits, text: "<<R1"},
+		"apache16 JUMP R3 IF":  {target: Apache16bits, text: "JUMP R3 IF 1023"},
+		"apache16 >>R2":        {target: Apache16bits, text: ">>R2 5"},
+		"apache16 OUT R1":      {target: Apache16bits, text: "OUT R1"},
+		"apache16 IN":          {target: Apache16bits, text: "IN 512"},
+		"apache16 DIV R0":      {target: Apache16bits, text: "DIV R0 7"},
+		"apache16 STOP":        {target: Apache16bits, text: "STOP"},
+		"apache16 NOT R3":      {target: Apache16bits, text: "NOT R3"},
+		"apache16 JUMP":        {target: Apache16bits, text: "JUMP 9"},
+		"apache16 STORE R2":    {target: Apache16bits, text: "STORE R2 0"},
+		"apache16 MUT R1":      {target: Apache16bits, text: "MUT R1 1"},
+		"apache16 SUB R0":      {target: Apache16bits, text: "SUB R0 2"},
+		"apache16 <<R0":        {target: Apache16bits, text: "<<R0 16"},
+		"apache16 ADD R1":      {target: Apache16bits, text: "ADD R1 100"},
+		"apache16 LOAD R0":     {target: Apache16bits, text: "LOAD R0 0"},
+		"apache8 OUT R0":       {target: Apache8bits, text: "OUT R0"},
+		"apache8 IN":           {target: Apache8bits, text: "IN 15"},
+		"apache8 STORE R0":     {target: Apache8bits, text: "STORE R0 1"},
+		"apache8 JUMP":         {target: Apache8bits, text: "JUMP 0"},
+		"apache8 NOT R0":       {target: Apache8bits, text: "NOT R0"},
+		"apache8 STOP":         {target: Apache8bits, text: "STOP"},
+		"apache8 ADD R1":       {target: Apache8bits, text: "ADD R1 2"},
+		"apache8 JUMP R1 IF":   {target: Apache8bits, text: "JUMP R1 IF 7"},
+		"apache8 STORE R1":     {target: Apache8bits, text: "STORE R1 9"},
+		"apache8 <<R0":         {target: Apache8bits, text: "<<R0"},
+		"apache8 LOAD R0":      {target: Apache8bits, text: "LOAD R0 13"},
+		"apache8 ADD R0":       {target: Apache8bits, text: "ADD R0 4"},
+		"apache8 NOT R1":       {target: Apache8bits, text: "NOT R1"},
+		"apache16 unused 1011": {target: Apache16bits},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if testCase.text == "" {
+				_, _, _, ok := testCase.target.Decode(0b1011_00_0000000000)
+				assert.False(t, ok)
+				return
+			}
+			program, err := Assemble(testCase.text, testCase.target)
+			assert.NoError(t, err)
+			instruction, register, operand, ok := testCase.target.Decode(program.Words[0])
+			assert.True(t, ok)
+			assert.Equal(t, testCase.text, testCase.target.Text(instruction, register, operand))
+		})
+	}
+}
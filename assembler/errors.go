@@ -0,0 +1,27 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is a problem found at a line of the source
+type Error struct {
+	Line int // 1 based
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ErrorList holds every error found while assembling a source
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for idx, err := range l {
+		msgs[idx] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,172 @@
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Evaluate computes a constant expression made of numbers (10, 0b1010, 0xA),
+// symbols, + - * / % and parentheses
+func Evaluate(expression string, symbols map[string]Symbol) (int, error) {
+	tokens, err := splitExpression(expression)
+	if err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, fmt.Errorf("missing value")
+	}
+	p := &parser{tokens: tokens, symbols: symbols}
+	val, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos < len(p.tokens) {
+		return 0, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], expression)
+	}
+	return val, nil
+}
+
+func splitExpression(expression string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/%()", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", r, expression)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens  []string
+	pos     int
+	symbols map[string]Symbol
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// sum = product { ("+" | "-") product }
+func (p *parser) sum() (int, error) {
+	val, err := p.product()
+	if err != nil {
+		return 0, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.tokens[p.pos]
+		p.pos++
+		rhs, err := p.product()
+		if err != nil {
+			return 0, err
+		}
+		if op == "+" {
+			val += rhs
+		} else {
+			val -= rhs
+		}
+	}
+	return val, nil
+}
+
+// product = unary { ("*" | "/" | "%") unary }
+func (p *parser) product() (int, error) {
+	val, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for p.peek() == "*" || p.peek() == "/" || p.peek() == "%" {
+		op := p.tokens[p.pos]
+		p.pos++
+		rhs, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "*":
+			val *= rhs
+		case "/", "%":
+			if rhs == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				val /= rhs
+			} else {
+				val %= rhs
+			}
+		}
+	}
+	return val, nil
+}
+
+// unary = "-" unary | "(" sum ")" | number | symbol
+func (p *parser) unary() (int, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return 0, fmt.Errorf("missing value")
+	case token == "-":
+		val, err := p.unary()
+		return -val, err
+	case token == "(":
+		val, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ")" {
+			return 0, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return val, nil
+	case labelRegex.MatchString(token):
+		symbol, ok := p.symbols[token]
+		if !ok {
+			return 0, fmt.Errorf("undefined symbol %q", token)
+		}
+		return symbol.Value, nil
+	default:
+		return parseNumber(token)
+	}
+}
+
+// parseNumber reads a decimal, 0b binary or 0x hexadecimal number, a leading
+// zero is refused instead of read as octal so 010 is not taken for 8 when it
+// was meant as binary, and so are _ separators
+func parseNumber(token string) (int, error) {
+	if strings.Contains(token, "_") {
+		return 0, fmt.Errorf("invalid number %q, _ separators are not allowed", token)
+	}
+	digits, base := token, 10
+	switch lower := strings.ToLower(token); {
+	case strings.HasPrefix(lower, "0b"):
+		digits, base = token[2:], 2
+	case strings.HasPrefix(lower, "0x"):
+		digits, base = token[2:], 16
+	case len(token) > 1 && token[0] == '0':
+		return 0, fmt.Errorf("invalid number %q, leading zeros are not allowed, use 0b for binary and 0x for hexadecimal", token)
+	}
+	val, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || digits == "" || digits[0] == '+' || digits[0] == '-' {
+		return 0, fmt.Errorf("invalid number %q", token)
+	}
+	return int(val), nil
+}
@@ -0,0 +1,45 @@
+package assembler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Program is the memory image produced by Assemble
+type Program struct {
+	Target  *Target
+	Words   []uint16
+	Lines   []int // source line that produced each word, 0 for the words skipped by .org
+	Symbols map[string]Symbol
+}
+
+// Format writes the image in the text format read by the memories LoadProgram, one word per line
+func (p *Program) Format() string {
+	var sb strings.Builder
+	for _, word := range p.Words {
+		sb.WriteString(p.Target.FormatWord(word))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// AssembleSibling assembles the .masic next to an image, the program is only
+// returned when it still assembles to the very same words
+func AssembleSibling(imagePath string, words []uint16, target *Target) (string, *Program) {
+	path := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".masic"
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil
+	}
+	program, err := Assemble(string(text), target)
+	if err != nil || len(program.Words) != len(words) {
+		return "", nil
+	}
+	for idx, word := range words {
+		if program.Words[idx] != word {
+			return "", nil
+		}
+	}
+	return path, program
+}
@@ -0,0 +1,84 @@
+package assembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SymbolKind tells what a symbol names
+type SymbolKind int
+
+const (
+	CodeSymbol     SymbolKind = iota // label of an instruction
+	DataSymbol                       // label of a .data cell
+	ConstantSymbol                   // .equ value
+)
+
+var symbolKinds = []string{"code", "data", "const"}
+
+func (k SymbolKind) String() string {
+	return symbolKinds[k]
+}
+
+type Symbol struct {
+	Name  string
+	Value int // address for code and data
+	Kind  SymbolKind
+	Line  int // source line of the definition
+}
+
+// Sorted returns the symbols ordered by value then name
+func Sorted(symbols map[string]Symbol) []Symbol {
+	sorted := make([]Symbol, 0, len(symbols))
+	for _, symbol := range symbols {
+		sorted = append(sorted, symbol)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Value != sorted[j].Value {
+			return sorted[i].Value < sorted[j].Value
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// WriteSymbols writes the symbol table, one "name value kind line" per line
+func WriteSymbols(w io.Writer, symbols map[string]Symbol) error {
+	for _, symbol := range Sorted(symbols) {
+		if _, err := fmt.Fprintf(w, "%s %d %s %d\n", symbol.Name, symbol.Value, symbol.Kind, symbol.Line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSymbols reads a symbol table written by WriteSymbols
+func ReadSymbols(r io.Reader) (map[string]Symbol, error) {
+	symbols := map[string]Symbol{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var symbol Symbol
+		var kind string
+		if _, err := fmt.Sscanf(scanner.Text(), "%s %d %s %d", &symbol.Name, &symbol.Value, &kind, &symbol.Line); err != nil {
+			return nil, &Error{Line: line, Msg: fmt.Sprintf("invalid symbol: %v", err)}
+		}
+		found := false
+		for idx, name := range symbolKinds {
+			if name == kind {
+				symbol.Kind = SymbolKind(idx)
+				found = true
+			}
+		}
+		if !found {
+			return nil, &Error{Line: line, Msg: fmt.Sprintf("unknown symbol kind %q", kind)}
+		}
+		symbols[symbol.Name] = symbol
+	}
+	return symbols, scanner.Err()
+}
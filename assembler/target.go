@@ -0,0 +1,192 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operand is the kind of argument an instruction expects
+type Operand int
+
+const (
+	NoOperand      Operand = iota
+	AddressOperand         // memory address or jump target
+	CountOperand           // immediate shift count
+)
+
+// RegisterPlaceholder stands for R0, R1... in the mnemonics of targets that encode the register
+const RegisterPlaceholder = "RX"
+
+// Flow is how an instruction moves the program counter
+type Flow int
+
+const (
+	FlowNext   Flow = iota // goes on to the next word
+	FlowJump               // always jumps to its address
+	FlowBranch             // jumps to its address when the register is zero
+	FlowStop               // halts the machine
+)
+
+type Instruction struct {
+	Opcode   uint8
+	Mnemonic string
+	Operand  Operand
+	Flow     Flow
+}
+
+// Target describes the word layout and instruction set of a machine
+type Target struct {
+	Name         string
+	WordBits     int
+	OpcodeBits   int
+	RegisterBits int // 0 when the register is part of the opcode
+	AddressBits  int
+	Layout       []int // bits of each field when a word is written as text
+	Instructions []Instruction
+}
+
+// Apache8bits follows the opcode table of machines.Apache8bits
+var Apache8bits = &Target{
+	Name:        "apache8",
+	WordBits:    8,
+	OpcodeBits:  4,
+	AddressBits: 4,
+	Layout:      []int{4, 4},
+	Instructions: []Instruction{
+		// BINARY | OPCODE     | OPERAND
+		// 0000   | LOAD R0    | ADDRESS
+		{Opcode: 0b0000, Mnemonic: "LOAD R0", Operand: AddressOperand},
+		// 0001   | STORE R0   | ADDRESS
+		{Opcode: 0b0001, Mnemonic: "STORE R0", Operand: AddressOperand},
+		// 0010   | JUMP R0 IF | ADDRESS
+		{Opcode: 0b0010, Mnemonic: "JUMP R0 IF", Operand: AddressOperand, Flow: FlowBranch},
+		// 0011   | ADD R0     | ADDRESS
+		{Opcode: 0b0011, Mnemonic: "ADD R0", Operand: AddressOperand},
+		// 0100   | <<R0       |
+		{Opcode: 0b0100, Mnemonic: "<<R0", Operand: NoOperand},
+		// 0101   | NOT R0     |
+		{Opcode: 0b0101, Mnemonic: "NOT R0", Operand: NoOperand},
+		// 0110   | JUMP       | ADDRESS
+		{Opcode: 0b0110, Mnemonic: "JUMP", Operand: AddressOperand, Flow: FlowJump},
+		// 0111   | STOP       |
+		{Opcode: 0b0111, Mnemonic: "STOP", Operand: NoOperand, Flow: FlowStop},
+		// 1000   | LOAD R1    | ADDRESS
+		{Opcode: 0b1000, Mnemonic: "LOAD R1", Operand: AddressOperand},
+		// 1001   | STORE R1   | ADDRESS
+		{Opcode: 0b1001, Mnemonic: "STORE R1", Operand: AddressOperand},
+		// 1010   | JUMP R1 IF | ADDRESS
+		{Opcode: 0b1010, Mnemonic: "JUMP R1 IF", Operand: AddressOperand, Flow: FlowBranch},
+		// 1011   | ADD R1     | ADDRESS
+		{Opcode: 0b1011, Mnemonic: "ADD R1", Operand: AddressOperand},
+		// 1100   | <<R1       |
+		{Opcode: 0b1100, Mnemonic: "<<R1", Operand: NoOperand},
+		// 1101   | NOT R1     |
+		{Opcode: 0b1101, Mnemonic: "NOT R1", Operand: NoOperand},
+		// 1110   | OUT R0     |
+		{Opcode: 0b1110, Mnemonic: "OUT R0", Operand: NoOperand},
+		// 1111   | IN         | ADDRESS
+		{Opcode: 0b1111, Mnemonic: "IN", Operand: AddressOperand},
+	},
+}
+
+// Apache16bits follows the opcode table of machines.Apache16bits, 1 << AddressBits is its apache16bitsMaxPCbits
+var Apache16bits = &Target{
+	Name:         "apache16",
+	WordBits:     16,
+	OpcodeBits:   4,
+	RegisterBits: 2,
+	AddressBits:  10,
+	Layout:       []int{4, 2, 10},
+	Instructions: []Instruction{
+		// BINARY | OPCODE      | OPERAND
+		// 0000   | LOAD RX AX  | ADDRESS
+		{Opcode: 0b0000, Mnemonic: "LOAD RX", Operand: AddressOperand},
+		// 0001   | STORE RX AX | ADDRESS
+		{Opcode: 0b0001, Mnemonic: "STORE RX", Operand: AddressOperand},
+		// 0010   | JUMP RX IF  | ADDRESS
+		{Opcode: 0b0010, Mnemonic: "JUMP RX IF", Operand: AddressOperand, Flow: FlowBranch},
+		// 0011   | ADD RX AX   | ADDRESS
+		{Opcode: 0b0011, Mnemonic: "ADD RX", Operand: AddressOperand},
+		// 0100   | SUB RX AX   | ADDRESS
+		{Opcode: 0b0100, Mnemonic: "SUB RX", Operand: AddressOperand},
+		// 0101   | MUT RX AX   | ADDRESS
+		{Opcode: 0b0101, Mnemonic: "MUT RX", Operand: AddressOperand},
+		// 0110   | DIV RX AX   | ADDRESS
+		{Opcode: 0b0110, Mnemonic: "DIV RX", Operand: AddressOperand},
+		// 0111   | >>RX X      | COUNT
+		{Opcode: 0b0111, Mnemonic: ">>RX", Operand: CountOperand},
+		// 1000   | <<RX X      | COUNT
+		{Opcode: 0b1000, Mnemonic: "<<RX", Operand: CountOperand},
+		// 1001   | NOT RX      |
+		{Opcode: 0b1001, Mnemonic: "NOT RX", Operand: NoOperand},
+		// 1010   | JUMP        | ADDRESS
+		{Opcode: 0b1010, Mnemonic: "JUMP", Operand: AddressOperand, Flow: FlowJump},
+		// 1101   | STOP        |
+		{Opcode: 0b1101, Mnemonic: "STOP", Operand: NoOperand, Flow: FlowStop},
+		// 1110   | OUT RX      |
+		{Opcode: 0b1110, Mnemonic: "OUT RX", Operand: NoOperand},
+		// 1111   | IN AX       | ADDRESS
+		{Opcode: 0b1111, Mnemonic: "IN", Operand: AddressOperand},
+	},
+}
+
+// Targets are the assembler targets by machine name
+var Targets = map[string]*Target{
+	Apache8bits.Name:  Apache8bits,
+	Apache16bits.Name: Apache16bits,
+}
+
+// MemorySize is the number of words the target can address
+func (t *Target) MemorySize() int {
+	return 1 << t.AddressBits
+}
+
+// Registers is the number of registers an instruction can encode, 0 when they are part of the opcode
+func (t *Target) Registers() int {
+	if t.RegisterBits == 0 {
+		return 0
+	}
+	return 1 << t.RegisterBits
+}
+
+// Encode builds the word of an instruction with its register and operand
+func (t *Target) Encode(instruction Instruction, register uint8, operand uint16) uint16 {
+	return uint16(instruction.Opcode)<<(t.WordBits-t.OpcodeBits) | uint16(register)<<t.AddressBits | operand
+}
+
+// Decode is the inverse of Encode, ok is false when the opcode is not in the table
+func (t *Target) Decode(word uint16) (instruction *Instruction, register uint8, operand uint16, ok bool) {
+	opcode := uint8(word >> (t.WordBits - t.OpcodeBits))
+	for idx := range t.Instructions {
+		if t.Instructions[idx].Opcode == opcode {
+			instruction = &t.Instructions[idx]
+			break
+		}
+	}
+	if instruction == nil {
+		return nil, 0, 0, false
+	}
+	register = uint8(word>>t.AddressBits) & (1<<t.RegisterBits - 1)
+	operand = word & (1<<t.AddressBits - 1)
+	return instruction, register, operand, true
+}
+
+// Text writes a decoded instruction back as source, e.g. "LOAD R2 14"
+func (t *Target) Text(instruction *Instruction, register uint8, operand uint16) string {
+	text := strings.Replace(instruction.Mnemonic, RegisterPlaceholder, fmt.Sprintf("R%d", register), 1)
+	if instruction.Operand == NoOperand {
+		return text
+	}
+	return fmt.Sprintf("%s %d", text, operand)
+}
+
+// FormatWord writes a word as binary text split by the target layout, e.g. "0011 1111"
+func (t *Target) FormatWord(word uint16) string {
+	fields := make([]string, len(t.Layout))
+	shift := t.WordBits
+	for idx, bits := range t.Layout {
+		shift -= bits
+		fields[idx] = fmt.Sprintf("%0*b", bits, (word>>shift)&(1<<bits-1))
+	}
+	return strings.Join(fields, " ")
+}
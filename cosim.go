@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"apache-instruction-set-simulator/legacy"
+)
+
+// cosim [-input file] [-cycles 1000] program.txt
+func cosimCommand(args []string) error {
+	flags := flag.NewFlagSet("cosim", flag.ExitOnError)
+	inputName := flags.String("input", "", "file both interpreters read their input from")
+	cycles := flags.Int("cycles", 1000, "instructions to run at most")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: cosim [-input file] [-cycles 1000] program.txt")
+	}
+
+	var input []byte
+	if *inputName != "" {
+		var err error
+		if input, err = os.ReadFile(*inputName); err != nil {
+			return err
+		}
+	}
+
+	lockstep, err := legacy.NewLockstep(string(input))
+	if err != nil {
+		return err
+	}
+	if err := lockstep.LoadProgram(flags.Arg(0)); err != nil {
+		return err
+	}
+	if err := lockstep.Run(*cycles); err != nil {
+		return err
+	}
+	fmt.Printf("legacy_version and apache8 agree on %d instructions, halted: %t\n", lockstep.Instructions, lockstep.Machine.Halted())
+	return nil
+}
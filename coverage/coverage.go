@@ -0,0 +1,166 @@
+package coverage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+	"apache-instruction-set-simulator/profiler"
+)
+
+// Source is the file a program was loaded from, Lines maps every word back to it
+type Source struct {
+	Path  string
+	Text  []string // lines of the file
+	Lines []int    // line of each word, 0 when no line produced it
+}
+
+// LoadSource reads the program at path, a .masic is assembled and an image is
+// mapped to the .masic next to it when that still assembles to the same words,
+// to its own lines otherwise
+func LoadSource(path string, target *assembler.Target) (Source, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return Source{}, err
+	}
+	if filepath.Ext(path) == ".masic" {
+		program, err := assembler.Assemble(string(text), target)
+		if err != nil {
+			return Source{}, err
+		}
+		return Source{Path: path, Text: splitLines(string(text)), Lines: program.Lines}, nil
+	}
+	words, err := disassembler.ParseImage(string(text), target)
+	if err != nil {
+		return Source{}, err
+	}
+	if sourcePath, program := assembler.AssembleSibling(path, words, target); program != nil {
+		sourceText, err := os.ReadFile(sourcePath)
+		if err != nil {
+			return Source{}, err
+		}
+		return Source{Path: sourcePath, Text: splitLines(string(sourceText)), Lines: program.Lines}, nil
+	}
+	return Source{Path: path, Text: splitLines(string(text)), Lines: disassembler.ImageLines(string(text))}, nil
+}
+
+func splitLines(text string) []string {
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Line is a source line holding code
+type Line struct {
+	Number int
+	Hits   int // executions of the first word of the line
+}
+
+// Branch is a conditional jump, it is fully covered once both outcomes ran
+type Branch struct {
+	Line     int
+	Address  uint16
+	Taken    int
+	NotTaken int
+}
+
+// Report is the coverage of a run mapped to its source
+type Report struct {
+	Source   Source
+	Lines    []Line   // by line number
+	Branches []Branch // by address
+}
+
+// Collect maps what the profile saw onto the source, words guessed as data
+// that never ran are not code and do not count
+func Collect(profile *profiler.Profile, listing []disassembler.Line, source Source) *Report {
+	report := &Report{Source: source}
+	seen := map[int]bool{}
+	for _, line := range listing {
+		number := 0
+		if int(line.Address) < len(source.Lines) {
+			number = source.Lines[line.Address]
+		}
+		hits := profile.Addresses[line.Address]
+		if number == 0 || line.Data && hits == 0 {
+			continue
+		}
+		if !seen[number] {
+			seen[number] = true
+			report.Lines = append(report.Lines, Line{Number: number, Hits: hits})
+		}
+		if instruction, _, _, ok := profile.Target.Decode(line.Word); ok && instruction.Flow == assembler.FlowBranch {
+			branch := Branch{Line: number, Address: line.Address}
+			if outcomes, ok := profile.Branches[line.Address]; ok {
+				branch.Taken, branch.NotTaken = outcomes.Taken, outcomes.NotTaken
+			}
+			report.Branches = append(report.Branches, branch)
+		}
+	}
+	return report
+}
+
+// LinesHit counts the lines that ran at least once
+func (r *Report) LinesHit() int {
+	hit := 0
+	for _, line := range r.Lines {
+		if line.Hits > 0 {
+			hit++
+		}
+	}
+	return hit
+}
+
+// BranchesHit counts the outcomes that happened, each branch has two
+func (r *Report) BranchesHit() int {
+	hit := 0
+	for _, branch := range r.Branches {
+		if branch.Taken > 0 {
+			hit++
+		}
+		if branch.NotTaken > 0 {
+			hit++
+		}
+	}
+	return hit
+}
+
+// LinePercent is the share of lines that ran, 100 without any line
+func (r *Report) LinePercent() float64 {
+	return percent(r.LinesHit(), len(r.Lines))
+}
+
+// BranchPercent is the share of branch outcomes that happened, 100 without any branch
+func (r *Report) BranchPercent() float64 {
+	return percent(r.BranchesHit(), 2*len(r.Branches))
+}
+
+func percent(hit int, found int) float64 {
+	if found == 0 {
+		return 100
+	}
+	return 100 * float64(hit) / float64(found)
+}
+
+// Check fails when line or branch coverage is below its minimum percentage
+func (r *Report) Check(minLines float64, minBranches float64) error {
+	if got := r.LinePercent(); got < minLines {
+		return &ThresholdError{Kind: "line", Percent: got, Minimum: minLines}
+	}
+	if got := r.BranchPercent(); got < minBranches {
+		return &ThresholdError{Kind: "branch", Percent: got, Minimum: minBranches}
+	}
+	return nil
+}
+
+// ThresholdError is returned by Check when coverage is too low
+type ThresholdError struct {
+	Kind    string // line or branch
+	Percent float64
+	Minimum float64
+}
+
+func (e *ThresholdError) Error() string {
+	return fmt.Sprintf("%s coverage %.1f%% is below the minimum of %.1f%%", e.Kind, e.Percent, e.Minimum)
+}
@@ -0,0 +1,106 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/profiler"
+	"apache-instruction-set-simulator/utils"
+)
+
+// count is 1 so the loop never goes round, JUMP loop never runs and the
+// branch is never left untaken
+const countdown = `; counts down to 0
+        LOAD R0 count
+loop:   ADD R0 minus
+        JUMP R0 IF done
+        JUMP loop
+done:   OUT R0
+        STOP
+count:  .data 1
+minus:  .data -1
+`
+
+func collectCountdown(t *testing.T) *Report {
+	program, err := assembler.Assemble(countdown, assembler.Targets["apache8"])
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := machines.New("apache8", strings.NewReader(""), &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machines.LoadWords(machine, program.Words))
+	profile := profiler.New(program.Target)
+	machine.SetWatch(profile.Watch)
+	assert.NoError(t, machine.Run(999))
+
+	listing, err := disassembler.FromMachine(machine, program.Target)
+	assert.NoError(t, err)
+	source := Source{Path: "countdown.masic", Text: splitLines(countdown), Lines: program.Lines}
+	return Collect(profile, listing, source)
+}
+
+func Test_Collect(t *testing.T) {
+	report := collectCountdown(t)
+
+	assert.Equal(t, []Line{{Number: 2, Hits: 1}, {Number: 3, Hits: 1}, {Number: 4, Hits: 1}, {Number: 5, Hits: 0}, {Number: 6, Hits: 1}, {Number: 7, Hits: 1}}, report.Lines)
+	assert.Equal(t, []Branch{{Line: 4, Address: 2, Taken: 1}}, report.Branches)
+	assert.Equal(t, "lines 5/6 83.3%, branches 1/2 50.0%", report.Summary())
+
+	assert.NoError(t, report.Check(80, 50))
+	var threshold *ThresholdError
+	assert.ErrorAs(t, report.Check(90, 0), &threshold)
+	assert.EqualError(t, report.Check(0, 100), "branch coverage 50.0% is below the minimum of 100.0%")
+}
+
+func Test_Report_Formats(t *testing.T) {
+	report := collectCountdown(t)
+
+	var text strings.Builder
+	assert.NoError(t, report.Write(&text, Text))
+	assert.Equal(t, `countdown.masic: lines 5/6 83.3%, branches 1/2 50.0%
+            1  ; counts down to 0
+     1      2          LOAD R0 count
+     1      3  loop:   ADD R0 minus
+     1      4          JUMP R0 IF done
+                taken 1, not taken 0
+ #####      5          JUMP loop
+     1      6  done:   OUT R0
+     1      7          STOP
+            8  count:  .data 1
+            9  minus:  .data -1
+`, text.String())
+
+	var lcov strings.Builder
+	assert.NoError(t, report.Write(&lcov, LCOV))
+	assert.Equal(t, "TN:\nSF:countdown.masic\n"+
+		"DA:2,1\nDA:3,1\nDA:4,1\nDA:5,0\nDA:6,1\nDA:7,1\n"+
+		"BRDA:4,0,0,1\nBRDA:4,0,1,0\n"+
+		"BRF:2\nBRH:1\nLF:6\nLH:5\nend_of_record\n", lcov.String())
+
+	_, err := ParseFormat("html")
+	assert.EqualError(t, err, `unknown coverage format "html", use text or lcov`)
+}
+
+func Test_LoadSource(t *testing.T) {
+	target := assembler.Targets["apache8"]
+
+	source, err := LoadSource("../programs/square.txt", target)
+	assert.NoError(t, err)
+	assert.Equal(t, "../programs/square.masic", source.Path)
+	assert.Equal(t, "        IN n", source.Text[source.Lines[0]-1])
+
+	// without a matching .masic the image lines are the source
+	image := filepath.Join(t.TempDir(), "loop.txt")
+	assert.NoError(t, os.WriteFile(image, []byte("0110 0000\n\n0111 0000\n"), 0644))
+	source, err = LoadSource(image, target)
+	assert.NoError(t, err)
+	assert.Equal(t, image, source.Path)
+	assert.Equal(t, []int{1, 3}, source.Lines)
+}
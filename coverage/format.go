@@ -0,0 +1,109 @@
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format picks how a report is written
+type Format int
+
+const (
+	Text Format = iota // the source annotated with hits, for people
+	LCOV               // lcov tracefile, for genhtml and editor plugins
+)
+
+var formats = []string{"text", "lcov"}
+
+func (f Format) String() string {
+	return formats[f]
+}
+
+// ParseFormat reads the names printed by Format.String
+func ParseFormat(name string) (Format, error) {
+	for idx, format := range formats {
+		if format == name {
+			return Format(idx), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown coverage format %q, use %s", name, strings.Join(formats, " or "))
+}
+
+// Write writes the report in format
+func (r *Report) Write(w io.Writer, format Format) error {
+	if format == LCOV {
+		return r.WriteLCOV(w)
+	}
+	return r.WriteText(w)
+}
+
+// Summary is the one line total, as in "lines 9/10 90.0%, branches 1/2 50.0%"
+func (r *Report) Summary() string {
+	return fmt.Sprintf("lines %d/%d %.1f%%, branches %d/%d %.1f%%",
+		r.LinesHit(), len(r.Lines), r.LinePercent(), r.BranchesHit(), 2*len(r.Branches), r.BranchPercent())
+}
+
+// WriteText writes the source with the hits of every code line, "#####" marks
+// code that never ran and branches list their outcomes under their line
+//
+//	    3      3  loop:   ADD R0 minus
+//	#####      8          OUT R0
+//	                      taken 0, not taken 3
+func (r *Report) WriteText(w io.Writer) error {
+	lines := map[int]Line{}
+	for _, line := range r.Lines {
+		lines[line.Number] = line
+	}
+	branches := map[int][]Branch{}
+	for _, branch := range r.Branches {
+		branches[branch.Line] = append(branches[branch.Line], branch)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s\n", r.Source.Path, r.Summary())
+	for idx, text := range r.Source.Text {
+		number := idx + 1
+		hits := ""
+		if line, ok := lines[number]; ok {
+			hits = "#####"
+			if line.Hits > 0 {
+				hits = fmt.Sprint(line.Hits)
+			}
+		}
+		fmt.Fprintf(&sb, "%6s %6d  %s\n", hits, number, text)
+		for _, branch := range branches[number] {
+			fmt.Fprintf(&sb, "%15s taken %d, not taken %d\n", "", branch.Taken, branch.NotTaken)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteLCOV writes an lcov tracefile, every conditional jump is a block with
+// the taken outcome first
+func (r *Report) WriteLCOV(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("TN:\n")
+	fmt.Fprintf(&sb, "SF:%s\n", r.Source.Path)
+	hits := map[int]int{}
+	for _, line := range r.Lines {
+		fmt.Fprintf(&sb, "DA:%d,%d\n", line.Number, line.Hits)
+		hits[line.Number] = line.Hits
+	}
+	for block, branch := range r.Branches {
+		for outcome, count := range []int{branch.Taken, branch.NotTaken} {
+			// lcov writes "-" for branches whose line never ran
+			taken := fmt.Sprint(count)
+			if hits[branch.Line] == 0 {
+				taken = "-"
+			}
+			fmt.Fprintf(&sb, "BRDA:%d,%d,%d,%s\n", branch.Line, block, outcome, taken)
+		}
+	}
+	fmt.Fprintf(&sb, "BRF:%d\nBRH:%d\n", 2*len(r.Branches), r.BranchesHit())
+	fmt.Fprintf(&sb, "LF:%d\nLH:%d\n", len(r.Lines), r.LinesHit())
+	sb.WriteString("end_of_record\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
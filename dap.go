@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"apache-instruction-set-simulator/dap"
+)
+
+// dap [-addr localhost:4711]
+func dapCommand(args []string) error {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	addr := flags.String("addr", "", "loopback address to wait for the client on, stdin and stdout when empty")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return fmt.Errorf("usage: dap [-addr localhost:4711]")
+	}
+
+	server := dap.NewServer()
+	if *addr == "" {
+		return server.Serve(os.Stdin, os.Stdout)
+	}
+	fmt.Printf("waiting for the debug client on %s\n", *addr)
+	return server.ListenAndServe(*addr)
+}
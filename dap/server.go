@@ -0,0 +1,570 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/debugger"
+	"apache-instruction-set-simulator/disassembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+const (
+	threadID           = 1
+	registersReference = 1
+	memoryReference    = 2
+	// chunk is the cycles a continue runs before it answers the requests that
+	// came in meanwhile, pause among them
+	chunk = 1000
+)
+
+// Server is a Debug Adapter Protocol session for a MASIC program, the client
+// launches an image or a source, breakpoints are set on source lines and each
+// step runs one instruction
+type Server struct {
+	Machine     machines.Machine
+	Target      *assembler.Target
+	Symbols     map[string]assembler.Symbol
+	tables      []*lineTable                              // the first one is shown in stack frames
+	breakpoints map[string]map[uint16]*debugger.Condition // by source path
+	nextID      int
+	stopOnEntry bool
+	stoppedAt   int // address of the breakpoint the program is stopped at, -1 when it is not
+	conn        *conn
+	requests    <-chan *request
+	pending     func() error // runs once the response is sent, e.g. resuming the program
+	quit        bool
+	handlers    map[string]func(args json.RawMessage) (any, error)
+}
+
+func NewServer() *Server {
+	s := &Server{breakpoints: map[string]map[uint16]*debugger.Condition{}, stoppedAt: -1}
+
+	//     REQUEST                | COMMENT
+	s.handlers = map[string]func(args json.RawMessage) (any, error){
+		// initialize             | Tell the client what the adapter supports
+		"initialize": s.initialize,
+		// launch                 | Load the program, the initialized event follows
+		"launch": s.launch,
+		// setBreakpoints         | Replace the breakpoints of a source
+		"setBreakpoints": s.setBreakpoints,
+		// configurationDone      | Start the program, or stop on entry
+		"configurationDone": s.configurationDone,
+		// threads                | The machine is the only thread
+		"threads": s.threads,
+		// stackTrace             | The current instruction and its source line
+		"stackTrace": s.stackTrace,
+		// scopes                 | Registers and memory
+		"scopes": s.scopes,
+		// variables              | Registers, or a page of memory words
+		"variables": s.variables,
+		// setVariable            | Change a register or a memory word
+		"setVariable": s.setVariable,
+		// evaluate               | Watch and hover expressions, as in "R0 == 0 && mem[14] > 100"
+		"evaluate": s.evaluate,
+		// continue               | Run until a breakpoint or STOP
+		"continue": s.resume(false),
+		// next, stepIn, stepOut  | Execute a single instruction
+		"next":    s.resume(true),
+		"stepIn":  s.resume(true),
+		"stepOut": s.resume(true),
+		// pause                  | Stop a running program
+		"pause": s.pause,
+		// terminate, disconnect  | End the session
+		"terminate":  s.terminate,
+		"disconnect": s.disconnect,
+	}
+	return s
+}
+
+// ListenAndServe waits for an editor on addr and serves that session, the
+// launch request opens any path it is given so addr is kept to loopback
+// addresses such as localhost:4711
+func (s *Server) ListenAndServe(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("debug adapter only listens on loopback addresses, got %q", addr)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return s.Serve(conn, conn)
+}
+
+// Serve answers requests read from in until the client disconnects or in ends
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.conn = &conn{out: out}
+	requests := make(chan *request)
+	s.requests = requests
+	go func() {
+		defer close(requests)
+		reader := bufio.NewReader(in)
+		for {
+			body, err := readMessage(reader)
+			if err != nil {
+				return
+			}
+			var req request
+			if json.Unmarshal(body, &req) == nil && req.Type == "request" {
+				requests <- &req
+			}
+		}
+	}()
+	for req := range requests {
+		if err := s.dispatch(req); err != nil {
+			return err
+		}
+		if s.quit {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Server) dispatch(req *request) error {
+	var body any
+	var err error
+	if handler, ok := s.handlers[req.Command]; !ok {
+		err = fmt.Errorf("unsupported request %s", req.Command)
+	} else if s.Machine == nil && req.Command != "initialize" && req.Command != "launch" && req.Command != "disconnect" {
+		err = fmt.Errorf("no program launched")
+	} else {
+		body, err = handler(req.Arguments)
+	}
+	resp := &response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+		s.pending = nil
+	}
+	if err := s.conn.write(resp); err != nil {
+		return err
+	}
+	if pending := s.pending; pending != nil {
+		s.pending = nil
+		return pending()
+	}
+	return nil
+}
+
+func (s *Server) initialize(_ json.RawMessage) (any, error) {
+	return capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsConditionalBreakpoints:   true,
+		SupportsSetVariable:              true,
+		SupportsEvaluateForHovers:        true,
+		SupportsTerminateRequest:         true,
+	}, nil
+}
+
+// launch loads an image or assembles a source, an image takes its source lines
+// from the .masic next to it when that still assembles to the same words
+func (s *Server) launch(raw json.RawMessage) (any, error) {
+	var args launchArguments
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Machine == "" {
+		args.Machine = "apache8"
+	}
+	target, ok := assembler.Targets[args.Machine]
+	if !ok {
+		return nil, fmt.Errorf("no assembler target for machine: %s", args.Machine)
+	}
+	path, err := filepath.Abs(args.Program)
+	if err != nil {
+		return nil, err
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []uint16
+	var tables []*lineTable
+	symbols := map[string]assembler.Symbol{}
+	if filepath.Ext(path) == ".masic" {
+		program, err := assembler.Assemble(string(text), target)
+		if err != nil {
+			return nil, err
+		}
+		words, symbols = program.Words, program.Symbols
+		tables = append(tables, programLines(path, program))
+	} else {
+		if words, err = disassembler.ParseImage(string(text), target); err != nil {
+			return nil, err
+		}
+		if sourcePath, program := assembler.AssembleSibling(path, words, target); program != nil {
+			symbols = program.Symbols
+			tables = append(tables, programLines(sourcePath, program))
+		}
+		tables = append(tables, imageLines(path, string(text)))
+	}
+
+	machine, err := machines.New(args.Machine, strings.NewReader(args.Input), outputWriter{s.conn})
+	if err != nil {
+		return nil, err
+	}
+	if err := machines.LoadWords(machine, words); err != nil {
+		return nil, err
+	}
+
+	s.Machine, s.Target, s.Symbols, s.tables = machine, target, symbols, tables
+	s.stopOnEntry = args.StopOnEntry
+	s.pending = func() error { return s.conn.event("initialized", nil) }
+	return nil, nil
+}
+
+func (s *Server) setBreakpoints(raw json.RawMessage) (any, error) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+	var table *lineTable
+	for _, candidate := range s.tables {
+		if candidate.Path == path {
+			table = candidate
+		}
+	}
+
+	set := map[uint16]*debugger.Condition{}
+	result := make([]breakpoint, len(args.Breakpoints))
+	for idx, requested := range args.Breakpoints {
+		s.nextID++
+		result[idx] = breakpoint{ID: s.nextID, Line: requested.Line}
+		if table == nil {
+			result[idx].Message = "not part of the launched program"
+			continue
+		}
+		address, line, ok := table.resolve(requested.Line)
+		if !ok {
+			result[idx].Message = "no instruction at or after this line"
+			continue
+		}
+		var condition *debugger.Condition
+		if requested.Condition != "" {
+			if condition, err = debugger.Compile(requested.Condition, len(s.Machine.Registers()), s.Symbols); err != nil {
+				result[idx].Message = err.Error()
+				continue
+			}
+		}
+		set[address] = condition
+		result[idx].Verified = true
+		result[idx].Line = line
+	}
+	s.breakpoints[path] = set
+	return map[string]any{"breakpoints": result}, nil
+}
+
+func (s *Server) configurationDone(_ json.RawMessage) (any, error) {
+	if s.stopOnEntry {
+		s.pending = func() error { return s.stopped("entry", "") }
+	} else {
+		s.pending = func() error { return s.run(false) }
+	}
+	return nil, nil
+}
+
+func (s *Server) threads(_ json.RawMessage) (any, error) {
+	return map[string]any{"threads": []thread{{ID: threadID, Name: s.Target.Name}}}, nil
+}
+
+func (s *Server) stackTrace(_ json.RawMessage) (any, error) {
+	pc := s.Machine.ProgramCounter()
+	frame := stackFrame{ID: 1, Name: s.instruction(pc), Column: 1, InstructionPointerReference: strconv.Itoa(int(pc))}
+	for _, table := range s.tables {
+		if line, ok := table.lines[pc]; ok {
+			frame.Source, frame.Line = table.source(), line
+			break
+		}
+	}
+	return map[string]any{"stackFrames": []stackFrame{frame}, "totalFrames": 1}, nil
+}
+
+func (s *Server) scopes(_ json.RawMessage) (any, error) {
+	return map[string]any{"scopes": []scope{
+		{Name: "Registers", VariablesReference: registersReference},
+		{Name: "Memory", VariablesReference: memoryReference, IndexedVariables: int(s.Machine.MemorySize()), Expensive: true},
+	}}, nil
+}
+
+func (s *Server) variables(raw json.RawMessage) (any, error) {
+	var args variablesArguments
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	var list []variable
+	switch args.VariablesReference {
+	case registersReference:
+		for idx, val := range s.Machine.Registers() {
+			list = append(list, variable{Name: fmt.Sprintf("R%d", idx), Value: strconv.Itoa(int(val))})
+		}
+		cir := s.Machine.InstructionRegister()
+		stop := "0"
+		if s.Machine.Halted() {
+			stop = "1"
+		}
+		list = append(list,
+			variable{Name: "PC", Value: strconv.Itoa(int(s.Machine.ProgramCounter()))},
+			variable{Name: "CIR", Value: fmt.Sprintf("%s (%s)", s.Target.FormatWord(cir), debugger.Instruction(s.Target, cir))},
+			variable{Name: "STOP", Value: stop},
+		)
+	case memoryReference:
+		end := int(s.Machine.MemorySize())
+		if args.Count > 0 && args.Start+args.Count < end {
+			end = args.Start + args.Count
+		}
+		for address := args.Start; address < end; address++ {
+			word, err := s.Machine.ReadMemory(uint16(address))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, variable{Name: debugger.Describe(s.Symbols, uint16(address)), Value: fmt.Sprintf("%d (%s)", word, s.Target.FormatWord(word))})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+	return map[string]any{"variables": list}, nil
+}
+
+// setVariable takes numbers, labels or expressions, negative values are stored
+// as two's complement
+func (s *Server) setVariable(raw json.RawMessage) (any, error) {
+	var args setVariableArguments
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	word, err := debugger.Word(args.Value, s.Target, s.Symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case args.VariablesReference == memoryReference:
+		address, err := strconv.Atoi(strings.Fields(args.Name)[0])
+		if err != nil {
+			return nil, fmt.Errorf("unknown memory word %q", args.Name)
+		}
+		err = s.Machine.WriteMemory(uint16(address), word)
+		return map[string]any{"value": fmt.Sprintf("%d (%s)", word, s.Target.FormatWord(word))}, err
+	case args.Name == "PC":
+		if word >= s.Machine.MemorySize() {
+			return nil, fmt.Errorf("address %d is out of range, max is %d", word, s.Machine.MemorySize()-1)
+		}
+		err = s.Machine.SetProgramCounter(word)
+	case args.Name == "CIR":
+		err = s.Machine.SetInstructionRegister(word)
+	case args.Name == "STOP":
+		s.Machine.SetHalted(word != 0)
+	case strings.HasPrefix(args.Name, "R"):
+		idx, convErr := strconv.Atoi(args.Name[1:])
+		if convErr != nil {
+			return nil, fmt.Errorf("unknown register %s", args.Name)
+		}
+		err = s.Machine.SetRegister(idx, word)
+	default:
+		return nil, fmt.Errorf("unknown register %s", args.Name)
+	}
+	return map[string]any{"value": strconv.Itoa(int(word))}, err
+}
+
+func (s *Server) evaluate(raw json.RawMessage) (any, error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	condition, err := debugger.Compile(args.Expression, len(s.Machine.Registers()), s.Symbols)
+	if err != nil {
+		return nil, err
+	}
+	val, err := condition.Value(s.Machine)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"result": strconv.Itoa(val), "variablesReference": 0}, nil
+}
+
+// resume builds continue and the step requests, the program runs after the
+// response is sent
+func (s *Server) resume(step bool) func(args json.RawMessage) (any, error) {
+	return func(_ json.RawMessage) (any, error) {
+		s.pending = func() error { return s.run(step) }
+		if step {
+			return nil, nil
+		}
+		return map[string]any{"allThreadsContinued": true}, nil
+	}
+}
+
+func (s *Server) pause(_ json.RawMessage) (any, error) {
+	s.pending = func() error { return s.stopped("pause", "") }
+	return nil, nil
+}
+
+func (s *Server) terminate(_ json.RawMessage) (any, error) {
+	s.pending = func() error { return s.conn.event("terminated", nil) }
+	return nil, nil
+}
+
+func (s *Server) disconnect(_ json.RawMessage) (any, error) {
+	s.quit = true
+	return nil, nil
+}
+
+// run executes one instruction, or until a breakpoint, STOP, an error or a
+// pause request, the machine only checks breakpoints when there are some
+func (s *Server) run(step bool) error {
+	if s.Machine.Halted() {
+		return s.exited()
+	}
+	// the breakpoint the program stopped at lets it go on, any other one at
+	// the PC stops it before it runs, as on launch
+	resumed := s.stoppedAt
+	s.stoppedAt = -1
+	if breakpoints := s.activeBreakpoints(); !step && len(breakpoints) > 0 {
+		hit := func(pc uint16) (string, bool) {
+			condition, ok := breakpoints[pc]
+			if !ok || condition == nil {
+				return "", ok
+			}
+			holds, err := condition.True(s.Machine)
+			if err != nil {
+				return fmt.Sprintf("condition %q failed: %v", condition.Text, err), true
+			}
+			return "", holds
+		}
+		if pc := s.Machine.ProgramCounter(); int(pc) != resumed {
+			if reason, stop := hit(pc); stop {
+				return s.breakpoint(reason)
+			}
+		}
+		s.Machine.SetWatch(func(result machines.StepResult) (string, bool) {
+			return hit(result.PCAfter)
+		})
+		defer s.Machine.SetWatch(nil)
+	}
+
+	cycles := chunk
+	if step {
+		cycles = 1
+	}
+	for {
+		err := s.Machine.Run(cycles)
+		var pause *machines.BreakError
+		switch {
+		case errors.As(err, &pause):
+			return s.breakpoint(pause.Reason)
+		case err != nil:
+			if outErr := s.conn.event("output", outputEvent{Category: "stderr", Output: err.Error() + "\n"}); outErr != nil {
+				return outErr
+			}
+			return s.stopped("exception", err.Error())
+		case s.Machine.Halted():
+			return s.exited()
+		case step:
+			return s.stopped("step", "")
+		}
+
+		// between chunks, stop on pause and answer what the client asks meanwhile
+		select {
+		case req, ok := <-s.requests:
+			if !ok {
+				s.quit = true
+				return nil
+			}
+			switch req.Command {
+			case "pause":
+				if err := s.conn.write(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: true}); err != nil {
+					return err
+				}
+				return s.stopped("pause", "")
+			case "continue", "next", "stepIn", "stepOut":
+				if err := s.conn.write(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: "program is running"}); err != nil {
+					return err
+				}
+			default:
+				if err := s.dispatch(req); err != nil || s.quit {
+					return err
+				}
+			}
+		default:
+		}
+	}
+}
+
+func (s *Server) activeBreakpoints() map[uint16]*debugger.Condition {
+	active := map[uint16]*debugger.Condition{}
+	for _, set := range s.breakpoints {
+		for address, condition := range set {
+			active[address] = condition
+		}
+	}
+	return active
+}
+
+// breakpoint stops at the breakpoint on the PC, reason tells why its
+// condition could not be checked
+func (s *Server) breakpoint(reason string) error {
+	s.stoppedAt = int(s.Machine.ProgramCounter())
+	if reason != "" {
+		return s.stopped("exception", reason)
+	}
+	return s.stopped("breakpoint", "")
+}
+
+func (s *Server) stopped(reason string, text string) error {
+	return s.conn.event("stopped", stoppedEvent{Reason: reason, Description: text, Text: text, ThreadID: threadID, AllThreadsStopped: true})
+}
+
+func (s *Server) exited() error {
+	if err := s.conn.event("exited", map[string]any{"exitCode": 0}); err != nil {
+		return err
+	}
+	return s.conn.event("terminated", nil)
+}
+
+// instruction names the word at address, with its label, as in "loop: ADD R0 15"
+func (s *Server) instruction(address uint16) string {
+	word, err := s.Machine.ReadMemory(address)
+	if err != nil {
+		return "?"
+	}
+	if label := debugger.Label(s.Symbols, address); label != "" {
+		return label + ": " + debugger.Instruction(s.Target, word)
+	}
+	return debugger.Instruction(s.Target, word)
+}
+
+// outputWriter turns what the program prints into output events
+type outputWriter struct {
+	conn *conn
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	if err := w.conn.event("output", outputEvent{Category: "stdout", Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
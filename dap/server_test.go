@@ -0,0 +1,305 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// client plays VS Code, messages are decoded into maps
+type client struct {
+	t      *testing.T
+	out    io.Writer
+	in     *bufio.Reader
+	seq    int
+	events []map[string]any
+}
+
+func newTestClient(t *testing.T) (*client, chan error) {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer().Serve(serverIn, serverOut)
+		serverOut.Close()
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return &client{t: t, out: clientOut, in: bufio.NewReader(clientIn)}, done
+}
+
+func (c *client) send(command string, arguments any) int {
+	c.seq++
+	body, err := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	assert.NoError(c.t, err)
+	_, err = fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	assert.NoError(c.t, err)
+	return c.seq
+}
+
+func (c *client) receive() map[string]any {
+	body, err := readMessage(c.in)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var message map[string]any
+	assert.NoError(c.t, json.Unmarshal(body, &message))
+	return message
+}
+
+// request sends a request and returns its response, events read meanwhile are
+// kept for event
+func (c *client) request(command string, arguments any) map[string]any {
+	seq := c.send(command, arguments)
+	for {
+		message := c.receive()
+		if message["type"] == "response" && message["request_seq"] == float64(seq) {
+			return message
+		}
+		c.events = append(c.events, message)
+	}
+}
+
+// event returns the next event called name, skipping other events
+func (c *client) event(name string) map[string]any {
+	for {
+		var message map[string]any
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.receive()
+		}
+		if message["type"] == "event" && message["event"] == name {
+			return message
+		}
+	}
+}
+
+// output collects output events up to the next event called name
+func (c *client) output(name string) string {
+	var output string
+	for {
+		var message map[string]any
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.receive()
+		}
+		if message["event"] == "output" {
+			output += message["body"].(map[string]any)["output"].(string)
+		}
+		if message["event"] == name {
+			return output
+		}
+	}
+}
+
+func body(message map[string]any) map[string]any {
+	return message["body"].(map[string]any)
+}
+
+// variables returns name to value
+func (c *client) variables(reference int, start int, count int) map[string]string {
+	response := c.request("variables", map[string]any{"variablesReference": reference, "start": start, "count": count})
+	assert.Equal(c.t, true, response["success"], response["message"])
+	variables := map[string]string{}
+	for _, v := range body(response)["variables"].([]any) {
+		variable := v.(map[string]any)
+		variables[variable["name"].(string)] = variable["value"].(string)
+	}
+	return variables
+}
+
+func (c *client) frame() map[string]any {
+	response := c.request("stackTrace", map[string]any{"threadId": 1})
+	return body(response)["stackFrames"].([]any)[0].(map[string]any)
+}
+
+func absolute(t *testing.T, path string) string {
+	abs, err := filepath.Abs(path)
+	assert.NoError(t, err)
+	return abs
+}
+
+func Test_Server_Image_With_Source(t *testing.T) {
+	c, done := newTestClient(t)
+	source := absolute(t, "../programs/sum.masic")
+
+	response := c.request("initialize", map[string]any{"adapterID": "apache-iss"})
+	assert.Equal(t, true, body(response)["supportsConfigurationDoneRequest"])
+
+	response = c.request("launch", map[string]any{"program": "../programs/sum.txt", "input": "3 4"})
+	assert.Equal(t, true, response["success"], response["message"])
+	c.event("initialized")
+
+	response = c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": source},
+		"breakpoints": []map[string]any{{"line": 4, "condition": "R0 == 99"}, {"line": 5}, {"line": 20}},
+	})
+	breakpoints := body(response)["breakpoints"].([]any)
+	assert.Equal(t, map[string]any{"id": float64(1), "verified": true, "line": float64(4)}, breakpoints[0])
+	assert.Equal(t, map[string]any{"id": float64(2), "verified": true, "line": float64(5)}, breakpoints[1])
+	assert.Equal(t, map[string]any{"id": float64(3), "verified": false, "line": float64(20), "message": "no instruction at or after this line"}, breakpoints[2])
+
+	c.request("configurationDone", nil)
+	assert.Equal(t, "> > ", c.output("stopped"))
+
+	frame := c.frame()
+	assert.Equal(t, "ADD R0 7", frame["name"])
+	assert.Equal(t, float64(5), frame["line"])
+	assert.Equal(t, source, frame["source"].(map[string]any)["path"])
+
+	assert.Equal(t, map[string]string{"R0": "3", "R1": "0", "PC": "3", "CIR": "0011 0110 (ADD R0 6)", "STOP": "0"}, c.variables(registersReference, 0, 0))
+	assert.Equal(t, map[string]string{"0006 <a>": "3 (0000 0011)", "0007 <b>": "4 (0000 0100)"}, c.variables(memoryReference, 6, 2))
+
+	response = c.request("evaluate", map[string]any{"expression": "R0 + mem[b]"})
+	assert.Equal(t, "7", body(response)["result"])
+
+	c.request("next", map[string]any{"threadId": 1})
+	assert.Equal(t, "step", body(c.event("stopped"))["reason"])
+	assert.Equal(t, float64(6), c.frame()["line"])
+
+	response = c.request("setVariable", map[string]any{"variablesReference": registersReference, "name": "R0", "value": "-1"})
+	assert.Equal(t, "255", body(response)["value"])
+	response = c.request("setVariable", map[string]any{"variablesReference": memoryReference, "name": "0007 <b>", "value": "a - 4"})
+	assert.Equal(t, "2 (0000 0010)", body(response)["value"])
+	assert.Equal(t, map[string]string{"0007 <b>": "2 (0000 0010)"}, c.variables(memoryReference, 7, 1))
+
+	c.request("continue", map[string]any{"threadId": 1})
+	assert.Equal(t, "255\n", c.output("exited"))
+	c.event("terminated")
+
+	response = c.request("disconnect", nil)
+	assert.Equal(t, true, response["success"])
+	assert.NoError(t, <-done)
+}
+
+func Test_Server_Source(t *testing.T) {
+	c, done := newTestClient(t)
+	source := absolute(t, "../programs/fibonacci.masic")
+
+	c.request("initialize", nil)
+	response := c.request("launch", map[string]any{"program": source, "stopOnEntry": true})
+	assert.Equal(t, true, response["success"], response["message"])
+	c.event("initialized")
+
+	response = c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": source},
+		"breakpoints": []map[string]any{{"line": 3, "condition": "mem[a] > 100"}},
+	})
+	assert.Equal(t, true, body(response)["breakpoints"].([]any)[0].(map[string]any)["verified"])
+
+	c.request("configurationDone", nil)
+	assert.Equal(t, "entry", body(c.event("stopped"))["reason"])
+	frame := c.frame()
+	assert.Equal(t, "LOAD R0 13", frame["name"])
+	assert.Equal(t, float64(2), frame["line"])
+
+	c.request("continue", map[string]any{"threadId": 1})
+	assert.Equal(t, "1\n2\n3\n5\n8\n13\n21\n34\n55\n89\n144\n233\n", c.output("stopped"))
+	assert.Equal(t, "loop: ADD R0 15", c.frame()["name"])
+	response = c.request("evaluate", map[string]any{"expression": "mem[a]"})
+	assert.Equal(t, "233", body(response)["result"])
+
+	// without breakpoints fibonacci runs forever, until paused
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": source}, "breakpoints": []any{}})
+	c.request("continue", map[string]any{"threadId": 1})
+	c.send("pause", map[string]any{"threadId": 1})
+	assert.Equal(t, "pause", body(c.event("stopped"))["reason"])
+
+	response = c.request("threads", nil)
+	assert.Equal(t, []any{map[string]any{"id": float64(1), "name": "apache8"}}, body(response)["threads"])
+
+	c.request("disconnect", nil)
+	assert.NoError(t, <-done)
+}
+
+func Test_Server_Image(t *testing.T) {
+	c, done := newTestClient(t)
+	image := filepath.Join(t.TempDir(), "loop.txt")
+	// JUMP 0, a blank line, STOP
+	assert.NoError(t, os.WriteFile(image, []byte("0110 0000\n\n0111 0000\n"), 0644))
+
+	c.request("initialize", nil)
+	c.request("launch", map[string]any{"program": image, "stopOnEntry": true})
+	response := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": image},
+		"breakpoints": []map[string]any{{"line": 2}},
+	})
+	assert.Equal(t, []any{map[string]any{"id": float64(1), "verified": true, "line": float64(3)}}, body(response)["breakpoints"])
+	response = c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": absolute(t, "../programs/sum.masic")},
+		"breakpoints": []map[string]any{{"line": 2}},
+	})
+	assert.Equal(t, "not part of the launched program", body(response)["breakpoints"].([]any)[0].(map[string]any)["message"])
+
+	c.request("configurationDone", nil)
+	c.event("stopped")
+	c.request("stepIn", map[string]any{"threadId": 1})
+	c.event("stopped")
+	frame := c.frame()
+	assert.Equal(t, "JUMP 0", frame["name"])
+	assert.Equal(t, float64(1), frame["line"])
+	assert.Equal(t, image, frame["source"].(map[string]any)["path"])
+
+	c.request("setVariable", map[string]any{"variablesReference": registersReference, "name": "PC", "value": "1"})
+	c.request("next", map[string]any{"threadId": 1})
+	c.event("exited")
+
+	c.request("disconnect", nil)
+	assert.NoError(t, <-done)
+}
+
+func Test_Server_Breakpoint_At_PC(t *testing.T) {
+	for _, stopOnEntry := range []bool{false, true} {
+		c, done := newTestClient(t)
+		source := absolute(t, "../programs/sum.masic")
+
+		c.request("initialize", nil)
+		c.request("launch", map[string]any{"program": "../programs/sum.txt", "input": "3 4", "stopOnEntry": stopOnEntry})
+		c.request("setBreakpoints", map[string]any{
+			"source":      map[string]any{"path": source},
+			"breakpoints": []map[string]any{{"line": 2}},
+		})
+		c.request("configurationDone", nil)
+		if stopOnEntry {
+			assert.Equal(t, "entry", body(c.event("stopped"))["reason"])
+			c.request("continue", map[string]any{"threadId": 1})
+		}
+
+		// the breakpoint on IN a is hit before it runs, then left behind
+		assert.Equal(t, "breakpoint", body(c.event("stopped"))["reason"], stopOnEntry)
+		assert.Equal(t, float64(2), c.frame()["line"], stopOnEntry)
+		c.request("continue", map[string]any{"threadId": 1})
+		assert.Equal(t, "> > 7\n", c.output("exited"), stopOnEntry)
+
+		c.request("disconnect", nil)
+		assert.NoError(t, <-done)
+	}
+}
+
+func Test_Server_Errors(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	testCases := []struct {
+		command   string
+		arguments any
+		message   string
+	}{
+		{command: "stackTrace", message: "no program launched"},
+		{command: "attach", message: "unsupported request attach"},
+		{command: "launch", arguments: map[string]any{"program": "../programs/sum.txt", "machine": "apache32"}, message: "no assembler target for machine: apache32"},
+		{command: "launch", arguments: map[string]any{"program": "../programs/sum16.txt"}, message: "word has more than 8 bits"},
+	}
+
+	for _, tc := range testCases {
+		response := c.request(tc.command, tc.arguments)
+		assert.Equal(t, false, response["success"], tc.command)
+		assert.Contains(t, response["message"], tc.message, tc.command)
+	}
+}
@@ -0,0 +1,65 @@
+package dap
+
+import (
+	"path/filepath"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+)
+
+// lineTable maps the lines of a source file to the words they produced
+type lineTable struct {
+	Path      string
+	addresses map[int]uint16 // first word of each line
+	lines     map[uint16]int
+	last      int // last line holding a word
+}
+
+func newLineTable(path string) *lineTable {
+	return &lineTable{Path: path, addresses: map[int]uint16{}, lines: map[uint16]int{}}
+}
+
+func (t *lineTable) add(line int, address uint16) {
+	if _, ok := t.addresses[line]; !ok {
+		t.addresses[line] = address
+	}
+	t.lines[address] = line
+	if line > t.last {
+		t.last = line
+	}
+}
+
+// resolve finds the word of line, lines without a word (comments, labels on
+// their own) move down to the next line that has one
+func (t *lineTable) resolve(line int) (uint16, int, bool) {
+	for ; line <= t.last; line++ {
+		if address, ok := t.addresses[line]; ok {
+			return address, line, true
+		}
+	}
+	return 0, 0, false
+}
+
+func (t *lineTable) source() *source {
+	return &source{Name: filepath.Base(t.Path), Path: t.Path}
+}
+
+// imageLines maps an image, one word per non blank line as ParseImage reads it
+func imageLines(path string, image string) *lineTable {
+	table := newLineTable(path)
+	for address, line := range disassembler.ImageLines(image) {
+		table.add(line, uint16(address))
+	}
+	return table
+}
+
+// programLines maps a source through the line table of the assembler
+func programLines(path string, program *assembler.Program) *lineTable {
+	table := newLineTable(path)
+	for address, line := range program.Lines {
+		if line > 0 {
+			table.add(line, uint16(address))
+		}
+	}
+	return table
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/debugger"
+	"apache-instruction-set-simulator/machines"
+)
+
+// debug [-machine apache8] [-symbols image.sym] program
+func debugCommand(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	machineName := flags.String("machine", "apache8", "machine to debug the program on")
+	symbolsName := flags.String("symbols", "", "symbol table written by asm -symbols, for images")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: debug [-machine apache8] [-symbols image.sym] program.txt|source.masic")
+	}
+
+	target, ok := assembler.Targets[*machineName]
+	if !ok {
+		return fmt.Errorf("no assembler target for machine: %s", *machineName)
+	}
+
+	// the program IN and the debugger prompt read the same terminal
+	in := bufio.NewReader(os.Stdin)
+	machine, err := machines.New(*machineName, in, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	symbols, err := loadDebugProgram(machine, target, flags.Arg(0), *symbolsName)
+	if err != nil {
+		return err
+	}
+
+	return debugger.New(machine, target, symbols, os.Stdout).Repl(in)
+}
+
+// loadDebugProgram assembles a .masic source into the machine memory, any other
+// name is loaded from programs/ like run does
+func loadDebugProgram(machine machines.Machine, target *assembler.Target, programName string, symbolsName string) (map[string]assembler.Symbol, error) {
+	if strings.HasSuffix(programName, ".masic") {
+		source, err := os.ReadFile(programName)
+		if err != nil {
+			return nil, err
+		}
+		program, err := assembler.Assemble(string(source), target)
+		if err != nil {
+			return nil, sourceErrors(programName, err)
+		}
+		if err := machines.LoadWords(machine, program.Words); err != nil {
+			return nil, err
+		}
+		return program.Symbols, nil
+	}
+
+	if err := machine.LoadProgram(programName); err != nil {
+		return nil, err
+	}
+	if symbolsName == "" {
+		return nil, nil
+	}
+	content, err := os.Open(symbolsName)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return assembler.ReadSymbols(content)
+}
@@ -0,0 +1,274 @@
+package debugger
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+var (
+	registerRegex = regexp.MustCompile(`^R[0-9]+$`)
+	nameRegex     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	operators     = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", "[", "]"}
+)
+
+// Condition guards a breakpoint or a watchpoint, it reads the live machine
+// state, as in "R0 == 0 && mem[14] > 100"
+//
+// Operands are numbers, registers (R0, PC, CIR), memory words (mem[addr]) and
+// labels, operators follow C: || && == != < <= > >= + - * / % ! and unary -,
+// comparisons and logic give 1 or 0
+type Condition struct {
+	Text string
+	eval func(machine machines.Machine) (int, error)
+}
+
+// Compile parses text, labels are resolved right away and registers are checked
+// against the count the machine has
+func Compile(text string, registers int, symbols map[string]assembler.Symbol) (*Condition, error) {
+	tokens, err := splitCondition(text)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{tokens: tokens, registers: registers, symbols: symbols}
+	eval, err := c.or()
+	if err != nil {
+		return nil, err
+	}
+	if c.pos < len(c.tokens) {
+		return nil, fmt.Errorf("unexpected %q in %q", c.tokens[c.pos], text)
+	}
+	return &Condition{Text: text, eval: eval}, nil
+}
+
+// True evaluates the condition, any non zero value is true
+func (c *Condition) True(machine machines.Machine) (bool, error) {
+	val, err := c.eval(machine)
+	return val != 0, err
+}
+
+// Value evaluates the expression, comparisons and logic give 1 or 0
+func (c *Condition) Value(machine machines.Machine) (int, error) {
+	return c.eval(machine)
+}
+
+func splitCondition(text string) ([]string, error) {
+	var tokens []string
+	for rest := strings.TrimSpace(text); rest != ""; rest = strings.TrimSpace(rest) {
+		if op := operatorPrefix(rest); op != "" {
+			tokens = append(tokens, op)
+			rest = rest[len(op):]
+			continue
+		}
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			return !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+		})
+		if end == 0 {
+			return nil, fmt.Errorf("unexpected %q in %q", rest[0], text)
+		}
+		if end < 0 {
+			end = len(rest)
+		}
+		tokens = append(tokens, rest[:end])
+		rest = rest[end:]
+	}
+	return tokens, nil
+}
+
+func operatorPrefix(text string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(text, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+type evaluator = func(machine machines.Machine) (int, error)
+
+type compiler struct {
+	tokens    []string
+	pos       int
+	registers int
+	symbols   map[string]assembler.Symbol
+}
+
+func (c *compiler) peek() string {
+	if c.pos < len(c.tokens) {
+		return c.tokens[c.pos]
+	}
+	return ""
+}
+
+// binary compiles next { op next } for the given operators, left to right
+func (c *compiler) binary(next func() (evaluator, error), ops map[string]func(a, b int) (int, error)) (evaluator, error) {
+	lhs, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		apply, ok := ops[c.peek()]
+		if !ok {
+			return lhs, nil
+		}
+		c.pos++
+		rhs, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left := lhs
+		lhs = func(machine machines.Machine) (int, error) {
+			a, err := left(machine)
+			if err != nil {
+				return 0, err
+			}
+			b, err := rhs(machine)
+			if err != nil {
+				return 0, err
+			}
+			return apply(a, b)
+		}
+	}
+}
+
+func truth(ok bool) int {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+// or = and { "||" and }
+func (c *compiler) or() (evaluator, error) {
+	return c.binary(c.and, map[string]func(a, b int) (int, error){
+		"||": func(a, b int) (int, error) { return truth(a != 0 || b != 0), nil },
+	})
+}
+
+// and = comparison { "&&" comparison }
+func (c *compiler) and() (evaluator, error) {
+	return c.binary(c.comparison, map[string]func(a, b int) (int, error){
+		"&&": func(a, b int) (int, error) { return truth(a != 0 && b != 0), nil },
+	})
+}
+
+// comparison = sum { ("==" | "!=" | "<" | "<=" | ">" | ">=") sum }
+func (c *compiler) comparison() (evaluator, error) {
+	return c.binary(c.sum, map[string]func(a, b int) (int, error){
+		"==": func(a, b int) (int, error) { return truth(a == b), nil },
+		"!=": func(a, b int) (int, error) { return truth(a != b), nil },
+		"<":  func(a, b int) (int, error) { return truth(a < b), nil },
+		"<=": func(a, b int) (int, error) { return truth(a <= b), nil },
+		">":  func(a, b int) (int, error) { return truth(a > b), nil },
+		">=": func(a, b int) (int, error) { return truth(a >= b), nil },
+	})
+}
+
+// sum = product { ("+" | "-") product }
+func (c *compiler) sum() (evaluator, error) {
+	return c.binary(c.product, map[string]func(a, b int) (int, error){
+		"+": func(a, b int) (int, error) { return a + b, nil },
+		"-": func(a, b int) (int, error) { return a - b, nil },
+	})
+}
+
+// product = unary { ("*" | "/" | "%") unary }
+func (c *compiler) product() (evaluator, error) {
+	return c.binary(c.unary, map[string]func(a, b int) (int, error){
+		"*": func(a, b int) (int, error) { return a * b, nil },
+		"/": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		},
+		"%": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a % b, nil
+		},
+	})
+}
+
+// unary = ("-" | "!") unary | "(" or ")" | "mem" "[" or "]" | register | number | label
+func (c *compiler) unary() (evaluator, error) {
+	token := c.peek()
+	c.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("missing value")
+	case token == "-" || token == "!":
+		operand, err := c.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(machine machines.Machine) (int, error) {
+			val, err := operand(machine)
+			if token == "!" {
+				return truth(val == 0), err
+			}
+			return -val, err
+		}, nil
+	case token == "(":
+		inner, err := c.or()
+		if err != nil {
+			return nil, err
+		}
+		if c.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		c.pos++
+		return inner, nil
+	case token == "mem":
+		if c.peek() != "[" {
+			return nil, fmt.Errorf("mem needs an address, as in mem[14]")
+		}
+		c.pos++
+		address, err := c.or()
+		if err != nil {
+			return nil, err
+		}
+		if c.peek() != "]" {
+			return nil, fmt.Errorf("missing ]")
+		}
+		c.pos++
+		return func(machine machines.Machine) (int, error) {
+			idx, err := address(machine)
+			if err != nil {
+				return 0, err
+			}
+			if idx < 0 || idx >= int(machine.MemorySize()) {
+				return 0, fmt.Errorf("address %d is out of range, max is %d", idx, machine.MemorySize()-1)
+			}
+			val, err := machine.ReadMemory(uint16(idx))
+			return int(val), err
+		}, nil
+	case token == "PC":
+		return func(machine machines.Machine) (int, error) { return int(machine.ProgramCounter()), nil }, nil
+	case token == "CIR":
+		return func(machine machines.Machine) (int, error) { return int(machine.InstructionRegister()), nil }, nil
+	case registerRegex.MatchString(token):
+		idx, err := strconv.Atoi(token[1:])
+		if err != nil || idx >= c.registers {
+			return nil, fmt.Errorf("unknown register %s, use R0 to R%d", token, c.registers-1)
+		}
+		return func(machine machines.Machine) (int, error) { return int(machine.Registers()[idx]), nil }, nil
+	case nameRegex.MatchString(token):
+		symbol, ok := c.symbols[token]
+		if !ok {
+			return nil, fmt.Errorf("undefined symbol %q", token)
+		}
+		return func(_ machines.Machine) (int, error) { return symbol.Value, nil }, nil
+	default:
+		val, err := strconv.ParseInt(token, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		return func(_ machines.Machine) (int, error) { return int(val), nil }, nil
+	}
+}
@@ -0,0 +1,83 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+func Test_Condition(t *testing.T) {
+	machine, err := machines.New("apache8", nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, machine.SetRegister(0, 0))
+	assert.NoError(t, machine.SetRegister(1, 7))
+	assert.NoError(t, machine.SetProgramCounter(3))
+	assert.NoError(t, machine.WriteMemory(14, 120))
+	symbols := map[string]assembler.Symbol{"a": {Name: "a", Value: 14, Kind: assembler.DataSymbol}}
+
+	testCases := map[string]struct {
+		text     string
+		expected int
+	}{
+		"request example": {text: "R0 == 0 && mem[14] > 100", expected: 1},
+		"label":           {text: "mem[a] == 120", expected: 1},
+		"arithmetic":      {text: "R1 * 2 + 1", expected: 15},
+		"precedence":      {text: "1 + 2 * 3 == 7 || 0", expected: 1},
+		"parentheses":     {text: "(1 + 2) * -3", expected: -9},
+		"not":             {text: "!R0 && !!R1", expected: 1},
+		"pc":              {text: "PC >= 3 && PC != 4", expected: 1},
+		"false":           {text: "R1 < 7 || R1 > 7", expected: 0},
+		"nested mem":      {text: "mem[R1 + 7] % 7", expected: 1},
+		"binary numbers":  {text: "R1 <= 0b111", expected: 1},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			condition, err := Compile(tc.text, 2, symbols)
+			assert.NoError(t, err)
+			val, err := condition.Value(machine)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, val)
+			holds, err := condition.True(machine)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected != 0, holds)
+		})
+	}
+}
+
+func Test_Condition_Errors(t *testing.T) {
+	machine, err := machines.New("apache8", nil, nil)
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		text       string
+		compileErr string
+		evalErr    string
+	}{
+		"unknown register": {text: "R2 == 0", compileErr: "unknown register R2, use R0 to R1"},
+		"unknown symbol":   {text: "mem[b]", compileErr: `undefined symbol "b"`},
+		"missing bracket":  {text: "mem[1", compileErr: "missing ]"},
+		"mem address":      {text: "mem + 1", compileErr: "mem needs an address, as in mem[14]"},
+		"missing value":    {text: "R0 ==", compileErr: "missing value"},
+		"dangling":         {text: "R0 R1", compileErr: `unexpected "R1" in "R0 R1"`},
+		"bad character":    {text: "R0 = 1", compileErr: `unexpected '=' in "R0 = 1"`},
+		"out of range":     {text: "mem[16]", evalErr: "address 16 is out of range, max is 15"},
+		"division":         {text: "1 / R0", evalErr: "division by zero"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			condition, err := Compile(tc.text, 2, nil)
+			if tc.compileErr != "" {
+				assert.EqualError(t, err, tc.compileErr)
+				return
+			}
+			assert.NoError(t, err)
+			_, err = condition.True(machine)
+			assert.EqualError(t, err, tc.evalErr)
+		})
+	}
+}
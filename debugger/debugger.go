@@ -0,0 +1,542 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+// DefaultMaxInstructions keeps continue and next from spinning forever on a
+// program that never halts
+const DefaultMaxInstructions = 100000
+
+// DefaultHistory is how many instructions can be stepped back over
+const DefaultHistory = 200000
+
+const prompt = "(apache) "
+
+// Debugger drives a machine one command at a time, addresses can be given as
+// numbers, labels from Symbols or expressions such as "loop + 1"
+type Debugger struct {
+	Machine         machines.Machine
+	Target          *assembler.Target
+	Symbols         map[string]assembler.Symbol
+	Breakpoints     map[uint16]*Condition // nil condition breaks every time
+	Watchpoints     []*Watchpoint
+	MaxInstructions int               // instructions continue and next may run before giving up
+	History         *machines.History // undo log of everything the machine ran under the debugger
+	out             io.Writer
+	commands        map[string]func(args []string) (bool, error)
+}
+
+func New(machine machines.Machine, target *assembler.Target, symbols map[string]assembler.Symbol, out io.Writer) *Debugger {
+	if symbols == nil {
+		symbols = map[string]assembler.Symbol{}
+	}
+	d := &Debugger{
+		Machine:         machine,
+		Target:          target,
+		Symbols:         symbols,
+		Breakpoints:     map[uint16]*Condition{},
+		MaxInstructions: DefaultMaxInstructions,
+		History:         machines.NewHistory(DefaultHistory),
+		out:             out,
+	}
+	machine.SetHistory(d.History)
+
+	//     COMMAND             | COMMENT
+	d.commands = map[string]func(args []string) (bool, error){
+		// break [addr] [if c] | Set a breakpoint, list them without an address
+		"break": d.breakCommand,
+		// delete [addr]       | Remove a breakpoint, every breakpoint without an address
+		"delete": d.deleteCommand,
+		// watch [addr|Rn]     | Break when a word is written or a register changes
+		"watch": d.watchCommand(WatchWrite),
+		// rwatch addr         | Break when a word is read
+		"rwatch": d.watchCommand(WatchRead),
+		// awatch addr         | Break when a word is read or written
+		"awatch": d.watchCommand(WatchAccess),
+		// unwatch [addr|Rn]   | Remove watchpoints, every watchpoint without an argument
+		"unwatch": d.unwatchCommand,
+		// step [n]            | Execute n instructions, 1 by default
+		"step": d.stepCommand,
+		// next                | Run until the instruction after the current one
+		"next": d.nextCommand,
+		// continue            | Run until a breakpoint or STOP
+		"continue": d.continueCommand,
+		// reverse-step [n]    | Undo n instructions, 1 by default
+		"reverse-step": d.reverseStepCommand,
+		// reverse-continue    | Undo instructions until a breakpoint, a watchpoint or the start
+		"reverse-continue": d.reverseContinueCommand,
+		// goto [n]            | Go back or forward to the nth instruction, show the current one without n
+		"goto": d.gotoCommand,
+		// regs                | Show registers, PC and CIR
+		"regs": d.regsCommand,
+		// mem addr [n]        | Show n memory words from addr
+		"mem": d.memCommand,
+		// set R0|PC|mem ...   | Change a register, the PC or a memory word
+		"set": d.setCommand,
+		// list                | Disassemble the whole memory
+		"list": d.listCommand,
+		// reset               | Put the registers back to power on, memory is kept
+		"reset": d.resetCommand,
+		// help                | List the commands
+		"help": d.helpCommand,
+		// quit                | Leave the debugger
+		"quit": func(_ []string) (bool, error) { return true, nil },
+	}
+	for alias, name := range map[string]string{"b": "break", "d": "delete", "w": "watch", "s": "step", "n": "next", "c": "continue", "rs": "reverse-step", "rc": "reverse-continue", "r": "regs", "x": "mem", "l": "list", "q": "quit"} {
+		d.commands[alias] = d.commands[name]
+	}
+	return d
+}
+
+// Repl reads commands until quit or the end of in, command errors are printed
+// and do not end the session
+func (d *Debugger) Repl(in *bufio.Reader) error {
+	if err := d.where(); err != nil {
+		return err
+	}
+	for {
+		fmt.Fprint(d.out, prompt)
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		quit, cmdErr := d.Execute(line)
+		if cmdErr != nil {
+			fmt.Fprintf(d.out, "error: %v\n", cmdErr)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Execute runs a single command line, quit is true when the session should end
+func (d *Debugger) Execute(line string) (quit bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	command, ok := d.commands[strings.ToLower(fields[0])]
+	if !ok {
+		return false, fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+	return command(fields[1:])
+}
+
+func (d *Debugger) breakCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		addresses := make([]int, 0, len(d.Breakpoints))
+		for address := range d.Breakpoints {
+			addresses = append(addresses, int(address))
+		}
+		sort.Ints(addresses)
+		if len(addresses) == 0 {
+			fmt.Fprintln(d.out, "no breakpoints")
+		}
+		for _, address := range addresses {
+			fmt.Fprintln(d.out, d.describeBreakpoint(uint16(address)))
+		}
+		return false, nil
+	}
+	location, condition, err := d.guarded(args)
+	if err != nil {
+		return false, err
+	}
+	address, err := d.address(location)
+	if err != nil {
+		return false, err
+	}
+	d.Breakpoints[address] = condition
+	fmt.Fprintln(d.out, d.describeBreakpoint(address))
+	return false, nil
+}
+
+func (d *Debugger) describeBreakpoint(address uint16) string {
+	if condition := d.Breakpoints[address]; condition != nil {
+		return fmt.Sprintf("breakpoint %s if %s", d.describe(address), condition.Text)
+	}
+	return fmt.Sprintf("breakpoint %s", d.describe(address))
+}
+
+func (d *Debugger) deleteCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		d.Breakpoints = map[uint16]*Condition{}
+		return false, nil
+	}
+	address, err := d.address(strings.Join(args, " "))
+	if err != nil {
+		return false, err
+	}
+	if _, ok := d.Breakpoints[address]; !ok {
+		return false, fmt.Errorf("no breakpoint at %d", address)
+	}
+	delete(d.Breakpoints, address)
+	return false, nil
+}
+
+func (d *Debugger) stepCommand(args []string) (bool, error) {
+	count, err := d.count(args)
+	if err != nil {
+		return false, err
+	}
+	return false, d.run(count, func() bool { count--; return count == 0 })
+}
+
+// count reads the optional instruction count of step and reverse-step
+func (d *Debugger) count(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	val, err := assembler.Evaluate(strings.Join(args, " "), d.Symbols)
+	if err != nil {
+		return 0, err
+	}
+	if val < 1 {
+		return 0, fmt.Errorf("step count must be positive, got %d", val)
+	}
+	return val, nil
+}
+
+func (d *Debugger) nextCommand(_ []string) (bool, error) {
+	following := d.Machine.ProgramCounter() + 1
+	return false, d.run(d.MaxInstructions, func() bool { return d.Machine.ProgramCounter() == following })
+}
+
+func (d *Debugger) continueCommand(_ []string) (bool, error) {
+	return false, d.run(d.MaxInstructions, nil)
+}
+
+// run lets the machine go for up to limit instructions, until done, a
+// breakpoint, a watchpoint or STOP; Run takes a budget of clock cycles, so the
+// instructions are counted by the watch
+func (d *Debugger) run(limit int, done func() bool) error {
+	if d.Machine.Halted() {
+		return d.where()
+	}
+	check := d.check(done)
+	executed, limited := 0, false
+	d.Machine.SetWatch(func(result machines.StepResult) (string, bool) {
+		executed++
+		if reason, stop := check(result); stop {
+			return reason, true
+		}
+		limited = executed >= limit && !result.Halted
+		return "", limited
+	})
+	defer d.Machine.SetWatch(nil)
+
+	err := d.Machine.Run(math.MaxInt)
+	var pause *machines.BreakError
+	switch {
+	case errors.As(err, &pause) && limited:
+		fmt.Fprintf(d.out, "stopped after %d instructions\n", limit)
+	case errors.As(err, &pause):
+		if pause.Reason != "" {
+			fmt.Fprintln(d.out, pause.Reason)
+		}
+	case err != nil:
+		return err
+	}
+	return d.where()
+}
+
+// check builds the watch Run consults after every instruction, watchpoints
+// come first so a STORE landing on a breakpoint reports the write
+func (d *Debugger) check(done func() bool) machines.Watch {
+	return func(result machines.StepResult) (string, bool) {
+		for _, watchpoint := range d.Watchpoints {
+			if reason := d.hit(watchpoint, result); reason != "" {
+				if holds, failure := d.holds(watchpoint.Condition); holds {
+					return reason + failure, true
+				}
+			}
+		}
+		if result.Halted {
+			return "", false
+		}
+		if condition, ok := d.Breakpoints[result.PCAfter]; ok {
+			if holds, failure := d.holds(condition); holds {
+				return d.describeBreakpoint(result.PCAfter) + failure, true
+			}
+		}
+		if done != nil && done() {
+			return "", true
+		}
+		return "", false
+	}
+}
+
+// holds evaluates an optional condition, a failing condition stops the program
+// and failure explains why
+func (d *Debugger) holds(condition *Condition) (holds bool, failure string) {
+	if condition == nil {
+		return true, ""
+	}
+	ok, err := condition.True(d.Machine)
+	if err != nil {
+		return true, fmt.Sprintf(", condition %q failed: %v", condition.Text, err)
+	}
+	return ok, ""
+}
+
+func (d *Debugger) regsCommand(_ []string) (bool, error) {
+	var sb strings.Builder
+	for idx, val := range d.Machine.Registers() {
+		fmt.Fprintf(&sb, "R%d %d  ", idx, val)
+	}
+	fmt.Fprintf(&sb, "PC %d  CIR %s", d.Machine.ProgramCounter(), d.Target.FormatWord(d.Machine.InstructionRegister()))
+	if d.Machine.Halted() {
+		sb.WriteString("  halted")
+	}
+	fmt.Fprintln(d.out, sb.String())
+	return false, nil
+}
+
+func (d *Debugger) memCommand(args []string) (bool, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return false, fmt.Errorf("usage: mem addr [count]")
+	}
+	address, err := d.address(args[0])
+	if err != nil {
+		return false, err
+	}
+	count := 1
+	if len(args) == 2 {
+		if count, err = assembler.Evaluate(args[1], d.Symbols); err != nil {
+			return false, err
+		}
+	}
+	for idx := 0; idx < count && int(address)+idx < int(d.Machine.MemorySize()); idx++ {
+		current := address + uint16(idx)
+		word, err := d.Machine.ReadMemory(current)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(d.out, "%-14s %s  %d\n", d.describe(current), d.Target.FormatWord(word), word)
+	}
+	return false, nil
+}
+
+func (d *Debugger) setCommand(args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, fmt.Errorf("usage: set R0|PC value, set mem addr value")
+	}
+	name := strings.ToUpper(args[0])
+	if name == "MEM" {
+		if len(args) != 3 {
+			return false, fmt.Errorf("usage: set mem addr value")
+		}
+		address, err := d.address(args[1])
+		if err != nil {
+			return false, err
+		}
+		val, err := d.value(args[2])
+		if err != nil {
+			return false, err
+		}
+		return false, d.Machine.WriteMemory(address, val)
+	}
+
+	val, err := d.value(strings.Join(args[1:], " "))
+	if err != nil {
+		return false, err
+	}
+	if name == "PC" {
+		if val >= d.Machine.MemorySize() {
+			return false, fmt.Errorf("address %d is out of range, max is %d", val, d.Machine.MemorySize()-1)
+		}
+		if err := d.Machine.SetProgramCounter(val); err != nil {
+			return false, err
+		}
+		return false, d.where()
+	}
+	idx, err := d.register(name)
+	if err != nil {
+		return false, err
+	}
+	return false, d.Machine.SetRegister(idx, val)
+}
+
+func (d *Debugger) listCommand(_ []string) (bool, error) {
+	lines, err := disassembler.FromMachine(d.Machine, d.Target)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range lines {
+		marker := "  "
+		if line.Address == d.Machine.ProgramCounter() {
+			marker = "=>"
+		}
+		if _, ok := d.Breakpoints[line.Address]; ok {
+			marker = marker[:1] + "*"
+		}
+		var sb strings.Builder
+		if err := disassembler.Format(&sb, []disassembler.Line{line}); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(d.out, "%s %-8s %s", marker, d.label(line.Address), sb.String())
+	}
+	return false, nil
+}
+
+func (d *Debugger) resetCommand(_ []string) (bool, error) {
+	d.Machine.Reset()
+	d.History.Clear()
+	return false, d.where()
+}
+
+func (d *Debugger) helpCommand(_ []string) (bool, error) {
+	fmt.Fprint(d.out, `break (b) [addr]       set a breakpoint, list them without an address
+break addr if cond     break only when cond holds, as in R0 == 0 && mem[14] > 100
+watch (w) [addr|Rn]    break when a word is written or a register changes, list them without an argument
+rwatch addr            break when a word is read
+awatch addr            break when a word is read or written
+unwatch [addr|Rn]      remove watchpoints, all of them without an argument
+delete (d) [addr]      remove a breakpoint, all of them without an address
+step (s) [n]           execute n instructions
+next (n)               run until the instruction after the current one
+continue (c)           run until a breakpoint or STOP
+reverse-step (rs) [n]  undo n instructions
+reverse-continue (rc)  undo instructions until a breakpoint, a watchpoint or the first instruction
+goto [n]               go back or forward to where n instructions had run, show how many have without n
+regs (r)               show registers, PC and CIR
+mem (x) addr [n]       show n memory words from addr
+set R0|PC value        change a register or the PC
+set mem addr value     change a memory word
+list (l)               disassemble the whole memory
+reset                  put the registers back to power on, memory is kept, the history is cleared
+quit (q)               leave the debugger
+addresses and values can be numbers, labels or expressions such as loop + 1,
+watchpoints also take "if cond", going back does not undo set, input already
+read stays read
+`)
+	return false, nil
+}
+
+// guarded splits "loop + 1 if R0 == 0" into the location and its compiled condition
+func (d *Debugger) guarded(args []string) (string, *Condition, error) {
+	for idx, arg := range args {
+		if arg != "if" {
+			continue
+		}
+		if idx == len(args)-1 {
+			return "", nil, fmt.Errorf("if needs a condition")
+		}
+		condition, err := Compile(strings.Join(args[idx+1:], " "), len(d.Machine.Registers()), d.Symbols)
+		return strings.Join(args[:idx], " "), condition, err
+	}
+	return strings.Join(args, " "), nil, nil
+}
+
+// where prints the instruction at the PC, or that the machine halted
+func (d *Debugger) where() error {
+	if d.Machine.Halted() {
+		fmt.Fprintln(d.out, "halted")
+		return nil
+	}
+	pc := d.Machine.ProgramCounter()
+	word, err := d.Machine.ReadMemory(pc)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "=> %s  %s\n", d.describe(pc), d.instruction(word))
+	return nil
+}
+
+func (d *Debugger) instruction(word uint16) string {
+	return Instruction(d.Target, word)
+}
+
+func (d *Debugger) describe(address uint16) string {
+	return Describe(d.Symbols, address)
+}
+
+func (d *Debugger) label(address uint16) string {
+	return Label(d.Symbols, address)
+}
+
+func (d *Debugger) address(expression string) (uint16, error) {
+	val, err := assembler.Evaluate(expression, d.Symbols)
+	if err != nil {
+		return 0, err
+	}
+	if val < 0 || val >= int(d.Machine.MemorySize()) {
+		return 0, fmt.Errorf("address %d is out of range, max is %d", val, d.Machine.MemorySize()-1)
+	}
+	return uint16(val), nil
+}
+
+func (d *Debugger) value(expression string) (uint16, error) {
+	return Word(expression, d.Target, d.Symbols)
+}
+
+func (d *Debugger) register(name string) (int, error) {
+	registers := len(d.Machine.Registers())
+	if !strings.HasPrefix(name, "R") {
+		return 0, fmt.Errorf("unknown register %s, use R0 to R%d or PC", name, registers-1)
+	}
+	idx, err := strconv.Atoi(name[1:])
+	if err != nil || idx < 0 || idx >= registers {
+		return 0, fmt.Errorf("unknown register %s, use R0 to R%d or PC", name, registers-1)
+	}
+	return idx, nil
+}
+
+// Instruction disassembles word, "?" when it is no instruction of target
+func Instruction(target *assembler.Target, word uint16) string {
+	instruction, register, operand, ok := target.Decode(word)
+	if !ok {
+		return "?"
+	}
+	return target.Text(instruction, register, operand)
+}
+
+// Describe formats an address with its label, as in "0004 <loop>"
+func Describe(symbols map[string]assembler.Symbol, address uint16) string {
+	if label := Label(symbols, address); label != "" {
+		return fmt.Sprintf("%04d <%s>", address, label)
+	}
+	return fmt.Sprintf("%04d", address)
+}
+
+// Label returns the first code or data symbol at address
+func Label(symbols map[string]assembler.Symbol, address uint16) string {
+	for _, symbol := range assembler.Sorted(symbols) {
+		if symbol.Kind != assembler.ConstantSymbol && symbol.Value == int(address) {
+			return symbol.Name
+		}
+	}
+	return ""
+}
+
+// Word evaluates a number, label or expression into a word of target,
+// negative numbers are stored as two's complement
+func Word(expression string, target *assembler.Target, symbols map[string]assembler.Symbol) (uint16, error) {
+	val, err := assembler.Evaluate(expression, symbols)
+	if err != nil {
+		return 0, err
+	}
+	limit := 1 << target.WordBits
+	if val < -limit/2 || val >= limit {
+		return 0, fmt.Errorf("value %d does not fit in %d bits", val, target.WordBits)
+	}
+	if val < 0 {
+		val += limit
+	}
+	return uint16(val), nil
+}
@@ -0,0 +1,287 @@
+package debugger
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/utils"
+)
+
+const countdown = `
+        LOAD R0 count
+loop:   ADD R0 minus
+        STORE R0 count
+        JUMP R0 IF done
+        JUMP loop
+done:   OUT R0
+        STOP
+count:  .data 3
+minus:  .data -1
+`
+
+func newTestDebugger(t *testing.T) (*Debugger, *strings.Builder) {
+	program, err := assembler.Assemble(countdown, assembler.Targets["apache8"])
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := machines.New("apache8", strings.NewReader(""), &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machines.LoadWords(machine, program.Words))
+
+	var sb strings.Builder
+	return New(machine, program.Target, program.Symbols, &sb), &sb
+}
+
+func Test_Debugger(t *testing.T) {
+	testCases := map[string]struct {
+		commands  []string
+		output    string // last command output
+		registers []uint16
+		pc        uint16
+		halted    bool
+	}{
+		"step": {
+			commands:  []string{"step"},
+			output:    "=> 0001 <loop>  ADD R0 8\n",
+			registers: []uint16{3, 0},
+			pc:        1,
+		},
+		"step n": {
+			commands:  []string{"s 3"},
+			output:    "=> 0003  JUMP R0 IF 5\n",
+			registers: []uint16{2, 0},
+			pc:        3,
+		},
+		"break on label": {
+			commands:  []string{"break done", "continue"},
+			output:    "breakpoint 0005 <done>\n=> 0005 <done>  OUT R0\n",
+			registers: []uint16{0, 0},
+			pc:        5,
+		},
+		"break on expression": {
+			commands:  []string{"b loop + 2", "c", "c"},
+			output:    "breakpoint 0003\n=> 0003  JUMP R0 IF 5\n",
+			registers: []uint16{1, 0},
+			pc:        3,
+		},
+		"list breakpoints": {
+			commands:  []string{"b done", "b 2", "break"},
+			output:    "breakpoint 0002\nbreakpoint 0005 <done>\n",
+			registers: []uint16{0, 0},
+		},
+		"delete": {
+			commands: []string{"b loop", "delete loop", "c"},
+			output:   "halted\n",
+			pc:       7,
+			halted:   true,
+		},
+		"next runs the loop out": {
+			commands:  []string{"s 4", "n"},
+			output:    "=> 0005 <done>  OUT R0\n",
+			registers: []uint16{0, 0},
+			pc:        5,
+		},
+		"regs": {
+			commands:  []string{"s", "regs"},
+			output:    "R0 3  R1 0  PC 1  CIR 0000 0111\n",
+			registers: []uint16{3, 0},
+			pc:        1,
+		},
+		"mem": {
+			commands:  []string{"mem count 2"},
+			output:    "0007 <count>   0000 0011  3\n0008 <minus>   1111 1111  255\n",
+			registers: []uint16{0, 0},
+		},
+		"set registers": {
+			commands:  []string{"set R1 -2", "set PC done", "set R0 5"},
+			output:    "",
+			registers: []uint16{5, 254},
+			pc:        5,
+		},
+		"set memory": {
+			commands: []string{"set mem count 1", "c"},
+			output:   "halted\n",
+			pc:       7,
+			halted:   true,
+		},
+		"continue gives up": {
+			commands:  []string{"set mem minus 0", "c"},
+			output:    "stopped after 100000 instructions\n=> 0004  JUMP 1\n",
+			registers: []uint16{3, 0},
+			pc:        4,
+		},
+		"watch write": {
+			commands:  []string{"watch count", "c"},
+			output:    "watchpoint 0007 <count> written 3 -> 2\n=> 0003  JUMP R0 IF 5\n",
+			registers: []uint16{2, 0},
+			pc:        3,
+		},
+		"rwatch": {
+			commands:  []string{"rwatch minus", "c", "c"},
+			output:    "watchpoint 0008 <minus> read 255\n=> 0002  STORE R0 7\n",
+			registers: []uint16{1, 0},
+			pc:        2,
+		},
+		"awatch": {
+			commands:  []string{"awatch count", "c"},
+			output:    "watchpoint 0007 <count> read 3\n=> 0001 <loop>  ADD R0 8\n",
+			registers: []uint16{3, 0},
+			pc:        1,
+		},
+		"watch register if": {
+			commands:  []string{"watch R0 if R0 == 1", "c"},
+			output:    "watchpoint R0 2 -> 1\n=> 0002  STORE R0 7\n",
+			registers: []uint16{1, 0},
+			pc:        2,
+		},
+		"step stops on a watchpoint": {
+			commands:  []string{"watch count", "s 5"},
+			output:    "watchpoint 0007 <count> written 3 -> 2\n=> 0003  JUMP R0 IF 5\n",
+			registers: []uint16{2, 0},
+			pc:        3,
+		},
+		"list watchpoints": {
+			commands:  []string{"watch count", "rwatch minus if R0 > 1", "watch R0", "unwatch R0", "watch"},
+			output:    "watchpoint write 0007 <count>\nwatchpoint read 0008 <minus> if R0 > 1\n",
+			registers: []uint16{0, 0},
+		},
+		"unwatch all": {
+			commands: []string{"watch count", "watch R1", "unwatch", "c"},
+			output:   "halted\n",
+			pc:       7,
+			halted:   true,
+		},
+		"conditional breakpoint": {
+			commands:  []string{"b loop if mem[count] == 1 && R0 < 2", "c"},
+			output:    "breakpoint 0001 <loop> if mem[count] == 1 && R0 < 2\n=> 0001 <loop>  ADD R0 8\n",
+			registers: []uint16{1, 0},
+			pc:        1,
+		},
+		"failing condition stops": {
+			commands:  []string{"b loop if mem[R0 * 10] == 0", "c"},
+			output:    "breakpoint 0001 <loop> if mem[R0 * 10] == 0, condition \"mem[R0 * 10] == 0\" failed: address 30 is out of range, max is 15\n=> 0001 <loop>  ADD R0 8\n",
+			registers: []uint16{3, 0},
+			pc:        1,
+		},
+		"reverse-step": {
+			commands:  []string{"s 3", "rs"},
+			output:    "instruction 2\n=> 0002  STORE R0 7\n",
+			registers: []uint16{2, 0},
+			pc:        2,
+		},
+		"reverse-step restores memory": {
+			commands:  []string{"c", "rs 5", "mem count"},
+			output:    "0007 <count>   0000 0001  1\n",
+			registers: []uint16{1, 0},
+			pc:        1,
+		},
+		"reverse-step to the start": {
+			commands:  []string{"s 2", "reverse-step 5"},
+			output:    "reached the start of the history\ninstruction 0\n=> 0000  LOAD R0 7\n",
+			registers: []uint16{0, 0},
+		},
+		"reverse-continue to a breakpoint": {
+			commands:  []string{"c", "b 3", "rc"},
+			output:    "breakpoint 0003\ninstruction 11\n=> 0003  JUMP R0 IF 5\n",
+			registers: []uint16{0, 0},
+			pc:        3,
+		},
+		"reverse-continue to a watchpoint": {
+			commands:  []string{"c", "watch count", "reverse-continue"},
+			output:    "watchpoint 0007 <count> written 1 -> 0\ninstruction 10\n=> 0002  STORE R0 7\n",
+			registers: []uint16{0, 0},
+			pc:        2,
+		},
+		"goto": {
+			commands:  []string{"goto 12", "goto 4", "goto"},
+			output:    "instruction 4\n",
+			registers: []uint16{2, 0},
+			pc:        4,
+		},
+		"goto past STOP": {
+			commands: []string{"b done", "goto 20"},
+			output:   "instruction 14\nhalted\n",
+			pc:       7,
+			halted:   true,
+		},
+		"reset clears the history": {
+			commands:  []string{"s 3", "reset", "goto"},
+			output:    "instruction 0\n",
+			registers: []uint16{0, 0},
+		},
+		"reset": {
+			commands:  []string{"s 3", "reset"},
+			output:    "=> 0000  LOAD R0 7\n",
+			registers: []uint16{0, 0},
+		},
+	}
+
+	// counts are instructions whatever the instructions cost
+	for _, timing := range []*machines.Timing{machines.UnitTiming, machines.ClassicTiming} {
+		for name, tc := range testCases {
+			t.Run(timing.Name+" "+name, func(t *testing.T) {
+				d, out := newTestDebugger(t)
+				assert.NoError(t, d.Machine.SetTiming(timing))
+				for _, command := range tc.commands {
+					out.Reset()
+					quit, err := d.Execute(command)
+					assert.NoError(t, err)
+					assert.False(t, quit)
+				}
+				assert.Equal(t, tc.output, out.String())
+				if tc.registers != nil {
+					assert.Equal(t, tc.registers, d.Machine.Registers())
+				}
+				assert.Equal(t, tc.pc, d.Machine.ProgramCounter())
+				assert.Equal(t, tc.halted, d.Machine.Halted())
+				assert.Equal(t, d.History.Instruction(), d.Machine.Instructions())
+			})
+		}
+	}
+}
+
+func Test_Debugger_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		command string
+		err     string
+	}{
+		"unknown command":      {command: "jump 3", err: `unknown command "jump", try help`},
+		"unknown label":        {command: "b nowhere", err: `undefined symbol "nowhere"`},
+		"address too big":      {command: "b 16", err: "address 16 is out of range, max is 15"},
+		"no breakpoint":        {command: "delete 3", err: "no breakpoint at 3"},
+		"unknown register":     {command: "set R2 1", err: "unknown register R2, use R0 to R1 or PC"},
+		"value too big":        {command: "set R0 256", err: "value 256 does not fit in 8 bits"},
+		"mem usage":            {command: "mem", err: "usage: mem addr [count]"},
+		"step count":           {command: "step 0", err: "step count must be positive, got 0"},
+		"reverse count":        {command: "rs -1", err: "step count must be positive, got -1"},
+		"negative instruction": {command: "goto -1", err: "instruction must not be negative, got -1"},
+		"rwatch register":      {command: "rwatch R0", err: "registers can only be watched for changes, use watch R0"},
+		"no watchpoint":        {command: "unwatch 3", err: "no watchpoint on 3"},
+		"empty condition":      {command: "b loop if", err: "if needs a condition"},
+		"bad condition":        {command: "b loop if R5 == 0", err: "unknown register R5, use R0 to R1"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d, _ := newTestDebugger(t)
+			_, err := d.Execute(tc.command)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func Test_Debugger_Repl(t *testing.T) {
+	d, out := newTestDebugger(t)
+	err := d.Repl(bufio.NewReader(strings.NewReader("b done\nbogus\nc\nquit\nstep\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, "=> 0000  LOAD R0 7\n"+
+		"(apache) breakpoint 0005 <done>\n"+
+		"(apache) error: unknown command \"bogus\", try help\n"+
+		"(apache) breakpoint 0005 <done>\n=> 0005 <done>  OUT R0\n"+
+		"(apache) ", out.String())
+}
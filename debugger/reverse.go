@@ -0,0 +1,94 @@
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+func (d *Debugger) reverseStepCommand(args []string) (bool, error) {
+	count, err := d.count(args)
+	if err != nil {
+		return false, err
+	}
+	return false, d.back(count, false)
+}
+
+func (d *Debugger) reverseContinueCommand(_ []string) (bool, error) {
+	return false, d.back(d.History.Instruction(), true)
+}
+
+func (d *Debugger) gotoCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		fmt.Fprintf(d.out, "instruction %d\n", d.History.Instruction())
+		return false, nil
+	}
+	instruction, err := assembler.Evaluate(strings.Join(args, " "), d.Symbols)
+	if err != nil {
+		return false, err
+	}
+	if instruction < 0 {
+		return false, fmt.Errorf("instruction must not be negative, got %d", instruction)
+	}
+	if instruction < d.History.Oldest() {
+		return false, fmt.Errorf("instruction %d is no longer recorded, the oldest is %d", instruction, d.History.Oldest())
+	}
+	current := d.History.Instruction()
+	if instruction <= current {
+		return false, d.back(current-instruction, false)
+	}
+	// going forward ignores breakpoints and watchpoints, as going back does,
+	// and steps so instructions taking several cycles are counted once
+	for d.History.Instruction() < instruction && !d.Machine.Halted() {
+		if _, err := d.Machine.Step(); err != nil {
+			return false, err
+		}
+	}
+	fmt.Fprintf(d.out, "instruction %d\n", d.History.Instruction())
+	return false, d.where()
+}
+
+// back undoes up to count instructions, with stops it also ends at a
+// breakpoint or on the instruction a watchpoint saw
+func (d *Debugger) back(count int, stops bool) error {
+	for ; count > 0; count-- {
+		result, err := d.History.Back(d.Machine)
+		if errors.Is(err, machines.ErrNoHistory) {
+			fmt.Fprintln(d.out, "reached the start of the history")
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !stops {
+			continue
+		}
+		if reason := d.reverseCheck(result); reason != "" {
+			fmt.Fprintln(d.out, reason)
+			break
+		}
+	}
+	fmt.Fprintf(d.out, "instruction %d\n", d.History.Instruction())
+	return d.where()
+}
+
+// reverseCheck is check going backwards, the machine is already back before
+// the instruction in result
+func (d *Debugger) reverseCheck(result machines.StepResult) string {
+	for _, watchpoint := range d.Watchpoints {
+		if reason := d.hit(watchpoint, result); reason != "" {
+			if holds, failure := d.holds(watchpoint.Condition); holds {
+				return reason + failure
+			}
+		}
+	}
+	if condition, ok := d.Breakpoints[result.PCBefore]; ok {
+		if holds, failure := d.holds(condition); holds {
+			return d.describeBreakpoint(result.PCBefore) + failure
+		}
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+
+	"apache-instruction-set-simulator/machines"
+)
+
+// WatchKind tells what a watchpoint looks at
+type WatchKind int
+
+const (
+	WatchWrite    WatchKind = iota // memory word written
+	WatchRead                      // memory word read
+	WatchAccess                    // memory word read or written
+	WatchRegister                  // register changed
+)
+
+var watchKinds = []string{"write", "read", "access", "register"}
+
+func (k WatchKind) String() string {
+	return watchKinds[k]
+}
+
+type Watchpoint struct {
+	Kind      WatchKind
+	Address   uint16     // memory address, register index for WatchRegister
+	Condition *Condition // nil triggers on every hit
+}
+
+// watchCommand builds watch, rwatch and awatch, watch also takes a register
+func (d *Debugger) watchCommand(kind WatchKind) func(args []string) (bool, error) {
+	return func(args []string) (bool, error) {
+		if len(args) == 0 {
+			if len(d.Watchpoints) == 0 {
+				fmt.Fprintln(d.out, "no watchpoints")
+			}
+			for _, watchpoint := range d.Watchpoints {
+				fmt.Fprintln(d.out, d.describeWatchpoint(watchpoint))
+			}
+			return false, nil
+		}
+		location, condition, err := d.guarded(args)
+		if err != nil {
+			return false, err
+		}
+		watchpoint := &Watchpoint{Kind: kind, Condition: condition}
+		if register, ok := d.watchedRegister(location); ok {
+			if kind != WatchWrite {
+				return false, fmt.Errorf("registers can only be watched for changes, use watch %s", location)
+			}
+			watchpoint.Kind = WatchRegister
+			watchpoint.Address = register
+		} else if watchpoint.Address, err = d.address(location); err != nil {
+			return false, err
+		}
+		d.Watchpoints = append(d.Watchpoints, watchpoint)
+		fmt.Fprintln(d.out, d.describeWatchpoint(watchpoint))
+		return false, nil
+	}
+}
+
+func (d *Debugger) unwatchCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		d.Watchpoints = nil
+		return false, nil
+	}
+	location := strings.Join(args, " ")
+	address, isRegister := d.watchedRegister(location)
+	if !isRegister {
+		var err error
+		if address, err = d.address(location); err != nil {
+			return false, err
+		}
+	}
+	kept := make([]*Watchpoint, 0, len(d.Watchpoints))
+	for _, watchpoint := range d.Watchpoints {
+		if (watchpoint.Kind == WatchRegister) == isRegister && watchpoint.Address == address {
+			continue
+		}
+		kept = append(kept, watchpoint)
+	}
+	if len(kept) == len(d.Watchpoints) {
+		return false, fmt.Errorf("no watchpoint on %s", location)
+	}
+	d.Watchpoints = kept
+	return false, nil
+}
+
+// watchedRegister reads "R1" as register 1
+func (d *Debugger) watchedRegister(location string) (uint16, bool) {
+	if !registerRegex.MatchString(strings.ToUpper(location)) {
+		return 0, false
+	}
+	idx, err := d.register(strings.ToUpper(location))
+	return uint16(idx), err == nil
+}
+
+func (d *Debugger) describeWatchpoint(watchpoint *Watchpoint) string {
+	var text string
+	if watchpoint.Kind == WatchRegister {
+		text = fmt.Sprintf("watchpoint R%d", watchpoint.Address)
+	} else {
+		text = fmt.Sprintf("watchpoint %s %s", watchpoint.Kind, d.describe(watchpoint.Address))
+	}
+	if watchpoint.Condition != nil {
+		text += " if " + watchpoint.Condition.Text
+	}
+	return text
+}
+
+// hit describes what the instruction did to the watched word or register,
+// empty when it did not touch it
+func (d *Debugger) hit(watchpoint *Watchpoint, result machines.StepResult) string {
+	if watchpoint.Kind == WatchRegister {
+		idx := int(watchpoint.Address)
+		for _, changed := range result.ChangedRegisters() {
+			if changed == idx {
+				return fmt.Sprintf("watchpoint R%d %d -> %d", idx, result.RegistersBefore[idx], result.RegistersAfter[idx])
+			}
+		}
+		return ""
+	}
+	if watchpoint.Kind != WatchRead {
+		for _, write := range result.Writes {
+			if write.Address == watchpoint.Address {
+				return fmt.Sprintf("watchpoint %s written %d -> %d", d.describe(write.Address), write.Previous, write.Value)
+			}
+		}
+	}
+	if watchpoint.Kind != WatchWrite {
+		for _, read := range result.Reads {
+			if read.Address == watchpoint.Address {
+				return fmt.Sprintf("watchpoint %s read %d", d.describe(read.Address), read.Value)
+			}
+		}
+	}
+	return ""
+}
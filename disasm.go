@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+)
+
+// disasm [-machine apache8] image.txt
+func disasmCommand(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	machineName := flags.String("machine", "apache8", "machine the image was built for")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: disasm [-machine apache8] image.txt")
+	}
+
+	target, ok := assembler.Targets[*machineName]
+	if !ok {
+		return fmt.Errorf("no assembler target for machine: %s", *machineName)
+	}
+
+	image, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	words, err := disassembler.ParseImage(string(image), target)
+	if err != nil {
+		return err
+	}
+
+	return disassembler.Format(os.Stdout, disassembler.Disassemble(words, target))
+}
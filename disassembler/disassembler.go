@@ -0,0 +1,170 @@
+package disassembler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/utils"
+)
+
+// Line is one decoded word of a listing
+type Line struct {
+	Address     uint16
+	Word        uint16
+	Bits        string // word split by the target layout, e.g. "0011 1111"
+	Instruction string // e.g. "ADD R0 15", empty when the opcode is unknown
+	Data        bool   // the word can not be reached from address 0, it is likely data
+	Referenced  bool   // an instruction reads or writes this word
+	Signed      int    // word as a two's complement number, for data
+}
+
+// Disassemble decodes an image, guessing which words are data by following
+// every path from address 0 and collecting the addresses instructions access
+func Disassemble(words []uint16, target *assembler.Target) []Line {
+	reached, referenced := analyze(words, target)
+
+	lines := make([]Line, len(words))
+	for idx, word := range words {
+		line := Line{
+			Address:    uint16(idx),
+			Word:       word,
+			Bits:       target.FormatWord(word),
+			Data:       !reached[idx],
+			Referenced: referenced[idx],
+			Signed:     signed(word, target.WordBits),
+		}
+		if instruction, register, operand, ok := target.Decode(word); ok {
+			line.Instruction = target.Text(instruction, register, operand)
+		}
+		lines[idx] = line
+	}
+	return lines
+}
+
+// FromMachine disassembles the whole memory of a live machine
+func FromMachine(machine machines.Machine, target *assembler.Target) ([]Line, error) {
+	words := make([]uint16, machine.MemorySize())
+	for idx := range words {
+		word, err := machine.ReadMemory(uint16(idx))
+		if err != nil {
+			return nil, err
+		}
+		words[idx] = word
+	}
+	return Disassemble(words, target), nil
+}
+
+// ParseImage reads an image in the text format of the memories LoadProgram, one word per line
+func ParseImage(image string, target *assembler.Target) ([]uint16, error) {
+	var words []uint16
+	scanner := bufio.NewScanner(strings.NewReader(image))
+	for line := 1; scanner.Scan(); line++ {
+		txt := scanner.Text()
+		if strings.TrimSpace(txt) == "" {
+			continue
+		}
+		word, err := utils.CastStringToUint16(txt, 2)
+		if err != nil {
+			return nil, &extras.DecodeError{Line: line, Text: txt, Err: err}
+		}
+		if int(word) >= 1<<target.WordBits {
+			return nil, &extras.DecodeError{Line: line, Text: txt, Err: fmt.Errorf("word has more than %d bits", target.WordBits)}
+		}
+		words = append(words, word)
+	}
+	return words, scanner.Err()
+}
+
+// ImageLines gives the line of the image each word was read from, as ParseImage
+// skips blank lines
+func ImageLines(image string) []int {
+	var lines []int
+	scanner := bufio.NewScanner(strings.NewReader(image))
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Format writes a listing, words guessed as data are annotated with their value
+//
+//	0001  0011 1111  ADD R0 15
+//	0015  0000 0001  LOAD R0 1      ; data 1, referenced
+func Format(w io.Writer, lines []Line) error {
+	for _, line := range lines {
+		instruction := line.Instruction
+		if instruction == "" {
+			instruction = "?"
+		}
+		text := fmt.Sprintf("%04d  %s  %s", line.Address, line.Bits, instruction)
+		if line.Data {
+			text = fmt.Sprintf("%-*s ; %s", 22+len(line.Bits), text, line.DataGuess())
+		}
+		if _, err := fmt.Fprintln(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DataGuess describes the word as a number, e.g. "data 255 (-1), referenced"
+func (l Line) DataGuess() string {
+	guess := fmt.Sprintf("data %d", l.Word)
+	if l.Signed < 0 {
+		guess = fmt.Sprintf("%s (%d)", guess, l.Signed)
+	}
+	if l.Referenced {
+		guess += ", referenced"
+	}
+	return guess
+}
+
+func analyze(words []uint16, target *assembler.Target) (reached []bool, referenced []bool) {
+	reached = make([]bool, len(words))
+	referenced = make([]bool, len(words))
+
+	pending := []int{0}
+	for len(pending) > 0 {
+		pc := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for pc < len(words) && !reached[pc] {
+			reached[pc] = true
+			instruction, _, operand, ok := target.Decode(words[pc])
+			if !ok {
+				pc++
+				continue
+			}
+
+			switch instruction.Flow {
+			case assembler.FlowStop:
+				pc = len(words)
+			case assembler.FlowJump:
+				pc = int(operand)
+			case assembler.FlowBranch:
+				pending = append(pending, int(operand))
+				pc++
+			default:
+				if instruction.Operand == assembler.AddressOperand && int(operand) < len(words) {
+					referenced[operand] = true
+				}
+				pc++
+			}
+		}
+	}
+	return reached, referenced
+}
+
+func signed(word uint16, bits int) int {
+	if word&(1<<(bits-1)) != 0 {
+		return int(word) - 1<<bits
+	}
+	return int(word)
+}
@@ -0,0 +1,77 @@
+package disassembler
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/machines"
+)
+
+func Test_Disassemble(t *testing.T) {
+	image, err := os.ReadFile("../programs/sub.txt")
+	assert.NoError(t, err)
+
+	words, err := ParseImage(string(image), assembler.Apache8bits)
+	assert.NoError(t, err)
+	assert.Len(t, words, 12)
+
+	lines := Disassemble(words, assembler.Apache8bits)
+	assert.Equal(t, Line{Address: 6, Word: 0b1010_1000, Bits: "1010 1000", Instruction: "JUMP R1 IF 8", Signed: -88}, lines[6])
+	assert.Equal(t, Line{Address: 11, Word: 0b1111_1111, Bits: "1111 1111", Instruction: "IN 15", Data: true, Referenced: true, Signed: -1}, lines[11])
+	for _, line := range lines[:10] {
+		assert.False(t, line.Data, line.Instruction)
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, Format(&out, lines))
+	listing := strings.Split(out.String(), "\n")
+	assert.Equal(t, "0000  1111 1010  IN 10", listing[0])
+	assert.Equal(t, "0011  1111 1111  IN 15          ; data 255 (-1), referenced", listing[11])
+}
+
+func Test_FromMachine(t *testing.T) {
+	image, err := os.ReadFile("../programs/fibonacci16.txt")
+	assert.NoError(t, err)
+	words, err := ParseImage(string(image), assembler.Apache16bits)
+	assert.NoError(t, err)
+
+	memory := extras.NewMemory1024x16bits()
+	for idx, word := range words {
+		assert.NoError(t, memory.Set(uint16(idx), word))
+	}
+
+	machine, err := machines.NewApache16bits(memory, nil, nil)
+	assert.NoError(t, err)
+
+	lines, err := FromMachine(machine, assembler.Apache16bits)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1024)
+	assert.Equal(t, "JUMP R1 IF 10", lines[8].Instruction)
+	assert.False(t, lines[10].Data)
+	assert.True(t, lines[11].Data)
+	assert.True(t, lines[11].Referenced)
+	assert.True(t, lines[1023].Data)
+	assert.False(t, lines[1023].Referenced)
+}
+
+func Test_ParseImage_Errors(t *testing.T) {
+	var decodeErr *extras.DecodeError
+
+	_, err := ParseImage("0000 0000\nabc\n", assembler.Apache8bits)
+	assert.ErrorAs(t, err, &decodeErr)
+	assert.Equal(t, 2, decodeErr.Line)
+
+	_, err = ParseImage("1 0000 0000\n", assembler.Apache8bits)
+	assert.ErrorAs(t, err, &decodeErr)
+	assert.Equal(t, 1, decodeErr.Line)
+}
+
+func Test_ImageLines(t *testing.T) {
+	assert.Equal(t, []int{1, 3, 4}, ImageLines("0110 0000\n\n0111 0000\n  0000 0001\n\n"))
+}
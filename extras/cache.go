@@ -0,0 +1,268 @@
+package extras
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Replacement picks the line of a full set a miss evicts
+type Replacement int
+
+const (
+	LRU    Replacement = iota // the line used least recently
+	FIFO                      // the line filled first
+	Random                    // any line, from a seeded generator so runs repeat
+)
+
+var replacements = []string{"lru", "fifo", "random"}
+
+func (r Replacement) String() string {
+	return replacements[r]
+}
+
+// ParseReplacement reads the names printed by Replacement.String
+func ParseReplacement(name string) (Replacement, error) {
+	for idx, replacement := range replacements {
+		if replacement == name {
+			return Replacement(idx), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown replacement policy %q, use %s", name, strings.Join(replacements, ", "))
+}
+
+// WritePolicy picks when a write reaches the memory behind the cache
+type WritePolicy int
+
+const (
+	WriteBack    WritePolicy = iota // when its line is evicted, a write miss fills the line first
+	WriteThrough                    // right away, a write miss leaves the cache alone
+)
+
+var writePolicies = []string{"back", "through"}
+
+func (p WritePolicy) String() string {
+	return writePolicies[p]
+}
+
+// ParseWritePolicy reads the names printed by WritePolicy.String
+func ParseWritePolicy(name string) (WritePolicy, error) {
+	for idx, policy := range writePolicies {
+		if policy == name {
+			return WritePolicy(idx), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown write policy %q, use %s", name, strings.Join(writePolicies, " or "))
+}
+
+// CacheConfig is the shape of a cache, Ways 1 is direct mapped and Ways equal
+// to Size / LineSize is fully associative
+type CacheConfig struct {
+	Size          int // words held
+	LineSize      int // words moved to and from memory together
+	Ways          int // lines in every set
+	Replacement   Replacement
+	Write         WritePolicy
+	HitLatency    int   // extra cycles of every access
+	MemoryLatency int   // extra cycles of every transfer to or from memory, a line fill, a write back or a written through word
+	Seed          int64 // of the Random replacement
+}
+
+func (c CacheConfig) String() string {
+	return fmt.Sprintf("%d words, %d words per line, %d ways, %s, write %s", c.Size, c.LineSize, c.Ways, c.Replacement, c.Write)
+}
+
+// CacheStats counts what the accesses to a cache did
+type CacheStats struct {
+	Reads      int
+	Writes     int
+	Hits       int
+	Misses     int
+	WriteBacks int // dirty lines written to memory on eviction
+	Latency    int // extra cycles spent in total
+}
+
+// HitRatio is the share of accesses that hit, 0 before any access
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("%d reads, %d writes, %d hits, %d misses (%.1f%% hits), %d write backs, %d extra cycles",
+		s.Reads, s.Writes, s.Hits, s.Misses, 100*s.HitRatio(), s.WriteBacks, s.Latency)
+}
+
+// Latent is a memory whose accesses take longer than the timing table of the
+// machine says
+type Latent interface {
+	// Latency returns the extra cycles spent since it was last called
+	Latency() int
+}
+
+type cacheLine struct {
+	valid  bool
+	dirty  bool
+	tag    int
+	used   int // tick of the last access
+	filled int // tick of the fill
+}
+
+// Cache sits in front of a memory and keeps the tags only, the words always
+// live in the memory behind it so snapshots, debuggers and write back see the
+// same values, what the cache changes is the statistics and the latency
+type Cache[A Address, W Word] struct {
+	Memory  Memory[A, W]
+	Config  CacheConfig
+	Stats   CacheStats
+	sets    [][]cacheLine
+	tick    int
+	pending int
+	random  *rand.Rand
+}
+
+// NewCache wraps memory with a cache shaped by config
+func NewCache[A Address, W Word](memory Memory[A, W], config CacheConfig) (*Cache[A, W], error) {
+	if config.Size <= 0 || config.LineSize <= 0 || config.Ways <= 0 {
+		return nil, fmt.Errorf("cache size, line size and ways must be positive, got %d, %d and %d", config.Size, config.LineSize, config.Ways)
+	}
+	if config.Size%(config.LineSize*config.Ways) != 0 {
+		return nil, fmt.Errorf("cache size %d is not a multiple of %d ways of %d words", config.Size, config.Ways, config.LineSize)
+	}
+	cache := &Cache[A, W]{
+		Memory: memory,
+		Config: config,
+		sets:   make([][]cacheLine, config.Size/(config.LineSize*config.Ways)),
+		random: rand.New(rand.NewSource(config.Seed)),
+	}
+	cache.Invalidate()
+	return cache, nil
+}
+
+// Uncached is the memory behind a cache, or memory itself when it is not one
+func Uncached[A Address, W Word](memory Memory[A, W]) Memory[A, W] {
+	if cache, ok := memory.(*Cache[A, W]); ok {
+		return cache.Memory
+	}
+	return memory
+}
+
+// Invalidate empties every line without writing anything back, the words are
+// already in memory
+func (c *Cache[A, W]) Invalidate() {
+	for idx := range c.sets {
+		c.sets[idx] = make([]cacheLine, c.Config.Ways)
+	}
+}
+
+func (c *Cache[A, W]) Get(idx A) (W, error) {
+	val, err := c.Memory.Get(idx)
+	if err != nil {
+		return val, err
+	}
+	c.Stats.Reads++
+	c.charge(c.access(int(idx), false))
+	return val, nil
+}
+
+func (c *Cache[A, W]) Set(idx A, val W) error {
+	if err := c.Memory.Set(idx, val); err != nil {
+		return err
+	}
+	c.Stats.Writes++
+	c.charge(c.access(int(idx), true))
+	return nil
+}
+
+// access looks the line of address up, filling it on a miss, and returns the
+// extra cycles that took
+func (c *Cache[A, W]) access(address int, write bool) int {
+	c.tick++
+	latency := c.Config.HitLatency
+	line := address / c.Config.LineSize
+	set := c.sets[line%len(c.sets)]
+	tag := line / len(c.sets)
+
+	if write && c.Config.Write == WriteThrough {
+		latency += c.Config.MemoryLatency
+	}
+	for idx := range set {
+		if set[idx].valid && set[idx].tag == tag {
+			c.Stats.Hits++
+			set[idx].used = c.tick
+			set[idx].dirty = set[idx].dirty || write && c.Config.Write == WriteBack
+			return latency
+		}
+	}
+	c.Stats.Misses++
+	if write && c.Config.Write == WriteThrough {
+		return latency
+	}
+
+	victim := c.victim(set)
+	if set[victim].valid && set[victim].dirty {
+		c.Stats.WriteBacks++
+		latency += c.Config.MemoryLatency
+	}
+	latency += c.Config.MemoryLatency
+	set[victim] = cacheLine{valid: true, dirty: write, tag: tag, used: c.tick, filled: c.tick}
+	return latency
+}
+
+func (c *Cache[A, W]) charge(latency int) {
+	c.Stats.Latency += latency
+	c.pending += latency
+}
+
+// victim picks an empty line first, then follows the replacement policy
+func (c *Cache[A, W]) victim(set []cacheLine) int {
+	victim := 0
+	for idx := range set {
+		if !set[idx].valid {
+			return idx
+		}
+		switch c.Config.Replacement {
+		case LRU:
+			if set[idx].used < set[victim].used {
+				victim = idx
+			}
+		case FIFO:
+			if set[idx].filled < set[victim].filled {
+				victim = idx
+			}
+		}
+	}
+	if c.Config.Replacement == Random {
+		victim = c.random.Intn(len(set))
+	}
+	return victim
+}
+
+// Latency returns the extra cycles spent since it was last called
+func (c *Cache[A, W]) Latency() int {
+	latency := c.pending
+	c.pending = 0
+	return latency
+}
+
+func (c *Cache[A, W]) Size() A {
+	return c.Memory.Size()
+}
+
+func (c *Cache[A, W]) Snapshot() []W {
+	return c.Memory.Snapshot()
+}
+
+// Restore overwrites the memory and empties the cache
+func (c *Cache[A, W]) Restore(words []W) error {
+	c.Invalidate()
+	return c.Memory.Restore(words)
+}
+
+// LoadProgram loads into the memory and empties the cache
+func (c *Cache[A, W]) LoadProgram(programName string) error {
+	c.Invalidate()
+	return c.Memory.LoadProgram(programName)
+}
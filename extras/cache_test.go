@@ -0,0 +1,113 @@
+package extras
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCache(t *testing.T, config CacheConfig) *Cache[uint16, uint16] {
+	t.Helper()
+	cache, err := NewCache[uint16, uint16](NewMemory1024x16bits(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func Test_Cache_DirectMapped(t *testing.T) {
+	// 4 sets of one 2 word line, addresses 0 and 8 share set 0
+	cache := newCache(t, CacheConfig{Size: 8, LineSize: 2, Ways: 1})
+	for _, address := range []uint16{0, 1, 8, 0} {
+		mustGet(t, cache.Get, address)
+	}
+	assert.Equal(t, CacheStats{Reads: 4, Hits: 1, Misses: 3}, cache.Stats)
+	assertMemoryFaults[uint16, uint16](t, cache)
+}
+
+func Test_Cache_Replacement(t *testing.T) {
+	testCases := map[Replacement]int{
+		LRU:  2, // 4 evicts 2, used before the last 0
+		FIFO: 1, // 4 evicts 0, filled first
+	}
+
+	// 2 sets of 2 one word lines, the even addresses share set 0
+	for replacement, hits := range testCases {
+		cache := newCache(t, CacheConfig{Size: 4, LineSize: 1, Ways: 2, Replacement: replacement})
+		for _, address := range []uint16{0, 2, 0, 4, 0} {
+			mustGet(t, cache.Get, address)
+		}
+		assert.Equal(t, hits, cache.Stats.Hits, replacement)
+		assert.Equal(t, 5-hits, cache.Stats.Misses, replacement)
+	}
+
+	// the same seed evicts the same lines
+	var stats []CacheStats
+	for range []int{0, 1} {
+		cache := newCache(t, CacheConfig{Size: 4, LineSize: 1, Ways: 2, Replacement: Random, Seed: 7})
+		for address := uint16(0); address < 64; address += 2 {
+			mustGet(t, cache.Get, address%10)
+		}
+		stats = append(stats, cache.Stats)
+	}
+	assert.Equal(t, stats[0], stats[1])
+	assert.Equal(t, 32, stats[0].Hits+stats[0].Misses)
+}
+
+func Test_Cache_WritePolicy(t *testing.T) {
+	testCases := map[WritePolicy]CacheStats{
+		// the write miss fills 0 dirty, reading 2 writes it back before the fill
+		WriteBack: {Reads: 1, Writes: 2, Hits: 1, Misses: 2, WriteBacks: 1, Latency: 11 + 1 + 21},
+		// every write goes to memory, the misses leave nothing in the cache
+		WriteThrough: {Reads: 1, Writes: 2, Hits: 0, Misses: 3, Latency: 11 + 11 + 11},
+	}
+
+	for policy, expected := range testCases {
+		// 2 sets of one word, 0 and 2 share set 0
+		cache := newCache(t, CacheConfig{Size: 2, LineSize: 1, Ways: 1, Write: policy, HitLatency: 1, MemoryLatency: 10})
+		assert.NoError(t, cache.Set(0, 5))
+		assert.NoError(t, cache.Set(0, 6))
+		mustGet(t, cache.Get, 2)
+		assert.Equal(t, expected, cache.Stats, policy)
+		assert.Equal(t, expected.Latency, cache.Latency(), policy)
+		assert.Equal(t, 0, cache.Latency(), policy)
+
+		// the words are in memory whatever the policy
+		assert.Equal(t, uint16(6), mustGet(t, cache.Memory.Get, 0), policy)
+	}
+}
+
+func Test_Cache_Invalidate(t *testing.T) {
+	cache := newCache(t, CacheConfig{Size: 8, LineSize: 4, Ways: 2})
+	mustGet(t, cache.Get, 3)
+	assert.NoError(t, cache.Restore(cache.Snapshot()))
+	mustGet(t, cache.Get, 3)
+	assert.Equal(t, 2, cache.Stats.Misses)
+	assert.Same(t, cache.Memory, Uncached[uint16, uint16](cache))
+	assert.Equal(t, uint16(1024), cache.Size())
+}
+
+func Test_Cache_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		config   CacheConfig
+		expected string
+	}{
+		"no ways":      {CacheConfig{Size: 8, LineSize: 2}, "cache size, line size and ways must be positive, got 8, 2 and 0"},
+		"uneven split": {CacheConfig{Size: 8, LineSize: 3, Ways: 1}, "cache size 8 is not a multiple of 1 ways of 3 words"},
+	}
+
+	for name, testCase := range testCases {
+		_, err := NewCache[uint16, uint16](NewMemory1024x16bits(), testCase.config)
+		assert.EqualError(t, err, testCase.expected, name)
+	}
+
+	_, err := ParseReplacement("mru")
+	assert.EqualError(t, err, `unknown replacement policy "mru", use lru, fifo, random`)
+	_, err = ParseWritePolicy("around")
+	assert.EqualError(t, err, `unknown write policy "around", use back or through`)
+	for _, policy := range []WritePolicy{WriteBack, WriteThrough} {
+		parsed, err := ParseWritePolicy(policy.String())
+		assert.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+}
@@ -0,0 +1,28 @@
+package extras
+
+import "fmt"
+
+// MemoryFaultError is returned when an address falls outside of the memory
+type MemoryFaultError struct {
+	Address int
+	Size    int
+}
+
+func (e *MemoryFaultError) Error() string {
+	return fmt.Sprintf("memory overflow, idx: %d, size: %d", e.Address, e.Size)
+}
+
+// DecodeError is returned when a program line can not be turned into a word
+type DecodeError struct {
+	Line int // 1 based
+	Text string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("line %d: can not decode %q: %v", e.Line, e.Text, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
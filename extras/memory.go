@@ -1,8 +1,31 @@
 package extras
 
-type Memory interface {
-	Get(idx interface{}) interface{}
-	Set(idx interface{}, val interface{})
-	LoadProgram(programName string)
-	Size() interface{}
+import "fmt"
+
+// Address is the type used to index a memory
+type Address interface {
+	~uint8 | ~uint16
+}
+
+// Word is the type stored in each memory space
+type Word interface {
+	~uint8 | ~uint16
+}
+
+type Memory[A Address, W Word] interface {
+	Get(idx A) (W, error)
+	Set(idx A, val W) error
+	LoadProgram(programName string) error
+	Size() A
+	Snapshot() []W
+	Restore(words []W) error
+}
+
+// restore copies a snapshot over the words of a memory, it has to fill them exactly
+func restore[W Word](words []W, snapshot []W) error {
+	if len(snapshot) != len(words) {
+		return fmt.Errorf("snapshot holds %d words, memory has %d", len(snapshot), len(words))
+	}
+	copy(words, snapshot)
+	return nil
 }
@@ -0,0 +1,95 @@
+package extras
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"apache-instruction-set-simulator/utils"
+)
+
+// RAM size (11 bits), 1024 spaces
+const memory1024x16bitsSize uint16 = 0b10000000000
+
+type Memory1024x16bits struct {
+	MEMORY [memory1024x16bitsSize]uint16
+	SIZE   uint16
+}
+
+func (m *Memory1024x16bits) Get(idx uint16) (uint16, error) {
+	if idx >= m.SIZE {
+		return 0, &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
+	}
+	return m.MEMORY[idx], nil
+}
+
+func (m *Memory1024x16bits) Set(idx uint16, val uint16) error {
+	if idx >= m.SIZE {
+		return &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
+	}
+	m.MEMORY[idx] = val
+	return nil
+}
+
+func (m *Memory1024x16bits) Size() uint16 {
+	return m.SIZE
+}
+
+// Snapshot copies every word of the memory
+func (m *Memory1024x16bits) Snapshot() []uint16 {
+	return append([]uint16(nil), m.MEMORY[:m.SIZE]...)
+}
+
+// Restore overwrites every word with a snapshot of the same size
+func (m *Memory1024x16bits) Restore(words []uint16) error {
+	return restore(m.MEMORY[:m.SIZE], words)
+}
+
+// each line holds one word in the 4/2/10 bits layout used by Apache16bits
+// cmd  idx0 idx1
+// 0000 00   0000000000
+func (m *Memory1024x16bits) LoadProgram(programName string) error {
+	content, err := os.Open(fmt.Sprintf("./programs/%s", programName))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	return m.ReadProgram(content)
+}
+
+// ReadProgram loads a program from any reader, one word per line
+func (m *Memory1024x16bits) ReadProgram(content io.Reader) error {
+	var idx uint16 = 0
+	scanner := bufio.NewScanner(content)
+	for scanner.Scan() {
+		// a line past the end of memory is a fault whatever it holds
+		if idx >= m.SIZE {
+			return &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
+		}
+		txt := scanner.Text()
+		val, err := utils.CastStringToUint16(txt, 2)
+		if err != nil {
+			return &DecodeError{Line: int(idx) + 1, Text: txt, Err: err}
+		}
+		if err := m.Set(idx, val); err != nil {
+			return err
+		}
+		idx++
+	}
+
+	return scanner.Err()
+}
+
+func NewMemory1024x16bits() *Memory1024x16bits {
+	device := &Memory1024x16bits{}
+
+	// set size
+	device.SIZE = memory1024x16bitsSize
+
+	// RAM (2 kilobytes long), zeroed
+	device.MEMORY = [memory1024x16bitsSize]uint16{}
+
+	return device
+}
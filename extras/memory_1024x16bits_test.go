@@ -0,0 +1,25 @@
+package extras
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Memory1024x16bits(t *testing.T) {
+	memory := NewMemory1024x16bits()
+	assert.NotNil(t, memory)
+
+	assert.NoError(t, memory.LoadProgram("test16.txt"))
+
+	assert.Equal(t, uint16(1), mustGet(t, memory.Get, uint16(0)))
+	assert.Equal(t, uint16(2), mustGet(t, memory.Get, uint16(1)))
+	assert.Equal(t, uint16(4), mustGet(t, memory.Get, uint16(2)))
+	assert.Equal(t, uint16(65535), mustGet(t, memory.Get, uint16(3)))
+	assert.Equal(t, uint16(0), mustGet(t, memory.Get, uint16(4)))
+
+	assert.NoError(t, memory.Set(uint16(1023), uint16(8772)))
+	assert.Equal(t, uint16(8772), mustGet(t, memory.Get, uint16(1023)))
+
+	assert.Equal(t, memory.SIZE, memory.Size())
+}
@@ -3,7 +3,7 @@ package extras
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"io"
 	"os"
 
 	"apache-instruction-set-simulator/utils"
@@ -17,45 +17,66 @@ type Memory16x8bits struct {
 	SIZE   uint8
 }
 
-func (m *Memory16x8bits) Get(idx interface{}) interface{} {
-	i := utils.CastInterfaceToUint8(idx)
-	if i >= m.SIZE {
-		log.Fatalf("Memory overflow, idx: %+v", idx)
+func (m *Memory16x8bits) Get(idx uint8) (uint8, error) {
+	if idx >= m.SIZE {
+		return 0, &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
 	}
-	return m.MEMORY[i]
+	return m.MEMORY[idx], nil
 }
 
-func (m *Memory16x8bits) Set(idx interface{}, val interface{}) {
-	i := utils.CastInterfaceToUint8(idx)
-	if i >= m.SIZE {
-		log.Fatalf("Memory overflow, idx: %+v", idx)
+func (m *Memory16x8bits) Set(idx uint8, val uint8) error {
+	if idx >= m.SIZE {
+		return &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
 	}
-	v := utils.CastInterfaceToUint8(val)
-	m.MEMORY[i] = v
+	m.MEMORY[idx] = val
+	return nil
 }
 
-func (m *Memory16x8bits) Size() interface{} {
+func (m *Memory16x8bits) Size() uint8 {
 	return m.SIZE
 }
 
-func (m *Memory16x8bits) LoadProgram(programName string) {
+// Snapshot copies every word of the memory
+func (m *Memory16x8bits) Snapshot() []uint8 {
+	return append([]uint8(nil), m.MEMORY[:m.SIZE]...)
+}
+
+// Restore overwrites every word with a snapshot of the same size
+func (m *Memory16x8bits) Restore(words []uint8) error {
+	return restore(m.MEMORY[:m.SIZE], words)
+}
+
+func (m *Memory16x8bits) LoadProgram(programName string) error {
 	content, err := os.Open(fmt.Sprintf("./programs/%s", programName))
 	if err != nil {
-		log.Fatalf("File reading error: %+v", err)
+		return err
 	}
+	defer content.Close()
 
+	return m.ReadProgram(content)
+}
+
+// ReadProgram loads a program from any reader, one word per line
+func (m *Memory16x8bits) ReadProgram(content io.Reader) error {
 	var idx uint8 = 0
 	scanner := bufio.NewScanner(content)
 	for scanner.Scan() {
+		// a line past the end of memory is a fault whatever it holds
+		if idx >= m.SIZE {
+			return &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
+		}
 		txt := scanner.Text()
-		val := utils.CastStringToUint8(txt, 2)
-		m.Set(idx, val)
+		val, err := utils.CastStringToUint8(txt, 2)
+		if err != nil {
+			return &DecodeError{Line: int(idx) + 1, Text: txt, Err: err}
+		}
+		if err := m.Set(idx, val); err != nil {
+			return err
+		}
 		idx++
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("File scanning error: %+v", err)
-	}
+	return scanner.Err()
 }
 
 func NewMemory16x8bits() *Memory16x8bits {
@@ -1,24 +1,68 @@
 package extras
 
 import (
+	"bufio"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/utils"
 )
 
 func Test_Memory16x8bits(t *testing.T) {
 	memory := NewMemory16x8bits()
 	assert.NotNil(t, memory)
 
-	memory.LoadProgram("test.txt")
+	assert.NoError(t, memory.LoadProgram("test.txt"))
 
-	assert.Equal(t, uint8(1), memory.Get(uint8(0)))
-	assert.Equal(t, uint8(2), memory.Get(uint8(1)))
-	assert.Equal(t, uint8(4), memory.Get(uint8(2)))
-	assert.Equal(t, uint8(0), memory.Get(uint8(3)))
+	assert.Equal(t, uint8(1), mustGet(t, memory.Get, uint8(0)))
+	assert.Equal(t, uint8(2), mustGet(t, memory.Get, uint8(1)))
+	assert.Equal(t, uint8(4), mustGet(t, memory.Get, uint8(2)))
+	assert.Equal(t, uint8(0), mustGet(t, memory.Get, uint8(3)))
 
-	memory.Set(uint8(3), uint8(8))
-	assert.Equal(t, uint8(8), memory.Get(uint8(3)))
+	assert.NoError(t, memory.Set(uint8(3), uint8(8)))
+	assert.Equal(t, uint8(8), mustGet(t, memory.Get, uint8(3)))
 
 	assert.Equal(t, memory.SIZE, memory.Size())
 }
+
+func Fuzz_Memory16x8bits_ReadProgram(f *testing.F) {
+	addProgramSeeds(f, "programs/test.txt", "../programs/[a-z]*[a-z].txt")
+	f.Add("0000 0001\nxxxx\n")
+	f.Add(strings.Repeat("0111 0000\n", 17))
+	f.Add(strings.Repeat("0\n", 16) + "2\n")
+
+	f.Fuzz(func(t *testing.T, content string) {
+		memory := NewMemory16x8bits()
+		err := memory.ReadProgram(strings.NewReader(content))
+
+		var decodeErr *DecodeError
+		var fault *MemoryFaultError
+		if errors.As(err, &decodeErr) {
+			assert.LessOrEqual(t, decodeErr.Line, 16)
+			return
+		}
+		if errors.As(err, &fault) {
+			assert.Equal(t, 16, fault.Address)
+			return
+		}
+		if err != nil {
+			// only lines longer than the scanner takes are left
+			assert.ErrorIs(t, err, bufio.ErrTooLong)
+			return
+		}
+
+		// every line became the word at its index, the rest stay zero
+		lines := bufio.NewScanner(strings.NewReader(content))
+		words := memory.Snapshot()
+		idx := 0
+		for ; lines.Scan(); idx++ {
+			word, err := utils.CastStringToUint8(lines.Text(), 2)
+			assert.NoError(t, err)
+			assert.Equal(t, word, words[idx])
+		}
+		assert.Equal(t, make([]uint8, len(words)-idx), words[idx:])
+	})
+}
@@ -1,7 +1,6 @@
 package extras
 
 import (
-	"log"
 	"strings"
 
 	"apache-instruction-set-simulator/utils"
@@ -15,35 +14,50 @@ type Memory3x8bits struct {
 	SIZE   uint8
 }
 
-func (m *Memory3x8bits) Get(idx interface{}) interface{} {
-	i := utils.CastInterfaceToUint8(idx)
-	if i >= m.SIZE {
-		log.Fatalf("Memory overflow, idx: %+v", idx)
+func (m *Memory3x8bits) Get(idx uint8) (uint8, error) {
+	if idx >= m.SIZE {
+		return 0, &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
 	}
-	return m.MEMORY[i]
+	return m.MEMORY[idx], nil
 }
 
-func (m *Memory3x8bits) Set(idx interface{}, val interface{}) {
-	i := utils.CastInterfaceToUint8(idx)
-	if i >= m.SIZE {
-		log.Fatalf("Memory overflow, idx: %+v", idx)
+func (m *Memory3x8bits) Set(idx uint8, val uint8) error {
+	if idx >= m.SIZE {
+		return &MemoryFaultError{Address: int(idx), Size: int(m.SIZE)}
 	}
-	v := utils.CastInterfaceToUint8(val)
-	m.MEMORY[i] = v
+	m.MEMORY[idx] = val
+	return nil
 }
 
-func (m *Memory3x8bits) Size() interface{} {
+func (m *Memory3x8bits) Size() uint8 {
 	return m.SIZE
 }
 
-func (m *Memory3x8bits) LoadProgram(program string) {
+// Snapshot copies every word of the memory
+func (m *Memory3x8bits) Snapshot() []uint8 {
+	return append([]uint8(nil), m.MEMORY[:m.SIZE]...)
+}
+
+// Restore overwrites every word with a snapshot of the same size
+func (m *Memory3x8bits) Restore(words []uint8) error {
+	return restore(m.MEMORY[:m.SIZE], words)
+}
+
+func (m *Memory3x8bits) LoadProgram(program string) error {
 	pieces := strings.Split(program, "\n")
 	for idx, piece := range pieces {
 		if piece == "" {
 			continue
 		}
-		m.Set(uint8(idx), utils.CastStringToUint8(piece, 2))
+		val, err := utils.CastStringToUint8(piece, 2)
+		if err != nil {
+			return &DecodeError{Line: idx + 1, Text: piece, Err: err}
+		}
+		if err := m.Set(uint8(idx), val); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func NewMemory3x8bits() *Memory3x8bits {
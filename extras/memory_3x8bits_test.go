@@ -10,12 +10,12 @@ func Test_Memory3x8bits(t *testing.T) {
 	memory := NewMemory3x8bits()
 	assert.NotNil(t, memory)
 
-	memory.LoadProgram("0000 0001\n0000 0010\n0000 0011")
+	assert.NoError(t, memory.LoadProgram("0000 0001\n0000 0010\n0000 0011"))
 
-	assert.Equal(t, uint8(1), memory.Get(uint8(0)))
+	assert.Equal(t, uint8(1), mustGet(t, memory.Get, uint8(0)))
 
-	memory.Set(uint8(0), uint8(2))
-	assert.Equal(t, uint8(2), memory.Get(uint8(0)))
+	assert.NoError(t, memory.Set(uint8(0), uint8(2)))
+	assert.Equal(t, uint8(2), mustGet(t, memory.Get, uint8(0)))
 
 	assert.Equal(t, memory.SIZE, memory.Size())
 }
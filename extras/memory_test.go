@@ -0,0 +1,96 @@
+package extras
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustGet[A Address, W Word](t *testing.T, get func(A) (W, error), idx A) W {
+	t.Helper()
+	val, err := get(idx)
+	assert.NoError(t, err)
+	return val
+}
+
+// addProgramSeeds seeds a fuzz target with the text of every program matching
+// the patterns
+func addProgramSeeds(f *testing.F, patterns ...string) {
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(content))
+		}
+	}
+}
+
+func assertMemoryFaults[A Address, W Word](t *testing.T, memory Memory[A, W]) {
+	var fault *MemoryFaultError
+
+	_, err := memory.Get(memory.Size())
+	assert.ErrorAs(t, err, &fault)
+	assert.Equal(t, fault.Size, fault.Address)
+
+	err = memory.Set(memory.Size(), 0)
+	assert.ErrorAs(t, err, &fault)
+	assert.Equal(t, fault.Size, fault.Address)
+}
+
+func Test_Memory_Errors(t *testing.T) {
+	assertMemoryFaults[uint8, uint8](t, NewMemory3x8bits())
+	assertMemoryFaults[uint8, uint8](t, NewMemory16x8bits())
+	assertMemoryFaults[uint16, uint16](t, NewMemory1024x16bits())
+
+	var decodeErr *DecodeError
+	err := NewMemory3x8bits().LoadProgram("0000 0001\nxxxx\n")
+	assert.ErrorAs(t, err, &decodeErr)
+	assert.Equal(t, 2, decodeErr.Line)
+
+	var fault *MemoryFaultError
+	err = NewMemory3x8bits().LoadProgram("0\n0\n0\n0\n")
+	assert.ErrorAs(t, err, &fault)
+	assert.Equal(t, 3, fault.Address)
+
+	// a 17th line faults before it is decoded
+	err = NewMemory16x8bits().ReadProgram(strings.NewReader(strings.Repeat("0\n", 16) + "2\n"))
+	assert.ErrorAs(t, err, &fault)
+	assert.Equal(t, 16, fault.Address)
+
+	err = NewMemory16x8bits().LoadProgram("missing.txt")
+	assert.Error(t, err)
+}
+
+func Test_Memory_Snapshot(t *testing.T) {
+	memory := NewMemory16x8bits()
+	assert.NoError(t, memory.Set(3, 8))
+
+	snapshot := memory.Snapshot()
+	assert.Len(t, snapshot, 16)
+	assert.Equal(t, uint8(8), snapshot[3])
+
+	// the snapshot is a copy, later writes do not change it
+	assert.NoError(t, memory.Set(3, 9))
+	assert.Equal(t, uint8(8), snapshot[3])
+
+	assert.NoError(t, memory.Restore(snapshot))
+	assert.Equal(t, uint8(8), mustGet(t, memory.Get, uint8(3)))
+
+	err := NewMemory3x8bits().Restore(snapshot)
+	assert.EqualError(t, err, "snapshot holds 16 words, memory has 3")
+
+	wide := NewMemory1024x16bits()
+	assert.NoError(t, wide.Set(1023, 300))
+	other := NewMemory1024x16bits()
+	assert.NoError(t, other.Restore(wide.Snapshot()))
+	assert.Equal(t, uint16(300), mustGet(t, other.Get, uint16(1023)))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/gdbstub"
+	"apache-instruction-set-simulator/machines"
+)
+
+// gdb [-machine apache8] [-addr localhost:1234] program
+func gdbCommand(args []string) error {
+	flags := flag.NewFlagSet("gdb", flag.ExitOnError)
+	machineName := flags.String("machine", "apache8", "machine to run the program on")
+	addr := flags.String("addr", "localhost:1234", "loopback address gdb connects to")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: gdb [-machine apache8] [-addr localhost:1234] program.txt|source.masic")
+	}
+
+	target, ok := assembler.Targets[*machineName]
+	if !ok {
+		return fmt.Errorf("no assembler target for machine: %s", *machineName)
+	}
+
+	machine, err := machines.New(*machineName, os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if _, err := loadDebugProgram(machine, target, flags.Arg(0), ""); err != nil {
+		return err
+	}
+
+	fmt.Printf("waiting for gdb on %s\n", *addr)
+	return gdbstub.New(machine, target).ListenAndServe(*addr)
+}
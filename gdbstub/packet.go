@@ -0,0 +1,107 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// interrupt is what the reader hands over when gdb sends ctrl-c (0x03)
+const interrupt = "\x03"
+
+// conn frames RSP packets, "$data#checksum", and acknowledges them until gdb
+// asks for QStartNoAckMode
+type conn struct {
+	rw     io.ReadWriter
+	mu     sync.Mutex // acks are written by the reader goroutine
+	noAck  bool
+	last   string   // last packet sent, resent when gdb answers "-"
+	queued []string // packets gdb sent while the program ran, answered after its stop reply
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for idx := 0; idx < len(data); idx++ {
+		sum += data[idx]
+	}
+	return sum
+}
+
+func (c *conn) send(data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = data
+	_, err := fmt.Fprintf(c.rw, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+func (c *conn) write(raw string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := io.WriteString(c.rw, raw)
+	return err
+}
+
+// next hands over the queued packets before reading new ones, ok is false once
+// the connection ended
+func (c *conn) next(packets <-chan string) (packet string, ok bool) {
+	if len(c.queued) > 0 {
+		packet, c.queued = c.queued[0], c.queued[1:]
+		return packet, true
+	}
+	packet, ok = <-packets
+	return packet, ok
+}
+
+// read sends every packet gdb writes to packets, interrupts included, and
+// closes it when the connection ends
+func (c *conn) read(packets chan<- string) {
+	defer close(packets)
+	in := bufio.NewReader(c.rw)
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case '+':
+		case '-':
+			c.mu.Lock()
+			last := c.last
+			c.mu.Unlock()
+			if c.send(last) != nil {
+				return
+			}
+		case 0x03:
+			packets <- interrupt
+		case '$':
+			data, err := in.ReadString('#')
+			if err != nil {
+				return
+			}
+			data = data[:len(data)-1]
+			var sum [2]byte
+			if _, err := io.ReadFull(in, sum[:]); err != nil {
+				return
+			}
+			c.mu.Lock()
+			noAck := c.noAck
+			c.mu.Unlock()
+			if !noAck {
+				ack := "+"
+				if !strings.EqualFold(fmt.Sprintf("%02x", checksum(data)), string(sum[:])) {
+					ack = "-"
+				}
+				if c.write(ack) != nil {
+					return
+				}
+				if ack == "-" {
+					continue
+				}
+			}
+			packets <- data
+		}
+	}
+}
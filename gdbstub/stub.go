@@ -0,0 +1,384 @@
+package gdbstub
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/machines"
+)
+
+// chunk is the budget of each Run while continuing, gdb only gets its ctrl-c
+// seen between two of them
+const chunk = 1000
+
+// Stub serves the GDB remote serial protocol for a single machine
+//
+//	go run . gdb -machine apache8 fibonacci.txt
+//	gdb -ex "target remote localhost:1234"
+type Stub struct {
+	Machine     machines.Machine
+	Target      *assembler.Target
+	Breakpoints map[uint16]bool // word addresses
+	wordBytes   int
+	registers   []register
+	xml         string
+}
+
+func New(machine machines.Machine, target *assembler.Target) *Stub {
+	wordBytes := (target.WordBits + 7) / 8
+	list := registers(machine, wordBytes)
+	return &Stub{
+		Machine:     machine,
+		Target:      target,
+		Breakpoints: map[uint16]bool{},
+		wordBytes:   wordBytes,
+		registers:   list,
+		xml:         targetXML(target, list),
+	}
+}
+
+// ListenAndServe waits for gdb on addr and serves that session until gdb
+// detaches or kills the program, addr is kept to loopback addresses such as
+// localhost:1234 because a remote target takes register and memory writes
+// from whoever connects first
+func (s *Stub) ListenAndServe(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("gdb stub only listens on loopback addresses, got %q", addr)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts a single gdb connection on listener, closes the listener and
+// serves that session
+func (s *Stub) Serve(listener net.Listener) error {
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return s.ServeConn(conn)
+}
+
+// ServeConn answers gdb packets until the connection closes, gdb detaches or
+// kills the program
+func (s *Stub) ServeConn(rw io.ReadWriter) error {
+	c := &conn{rw: rw}
+	packets := make(chan string)
+	go c.read(packets)
+	for {
+		packet, ok := c.next(packets)
+		if !ok {
+			return nil
+		}
+		if packet == interrupt {
+			if err := c.send("S02"); err != nil {
+				return err
+			}
+			continue
+		}
+		reply, done := s.handle(c, packet, packets)
+		if err := c.send(reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// handle answers one packet, unknown packets get the empty reply gdb reads as
+// "not supported"
+func (s *Stub) handle(c *conn, packet string, packets <-chan string) (reply string, done bool) {
+	switch {
+	case packet == "?":
+		return s.stopReply(), false
+	case strings.HasPrefix(packet, "qSupported"):
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+", false
+	case packet == "QStartNoAckMode":
+		c.mu.Lock()
+		c.noAck = true
+		c.mu.Unlock()
+		return "OK", false
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		return s.features(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:")), false
+	case packet == "qAttached":
+		return "1", false
+	case packet == "qC":
+		return "QC1", false
+	case packet == "qfThreadInfo":
+		return "m1", false
+	case packet == "qsThreadInfo":
+		return "l", false
+	case strings.HasPrefix(packet, "qSymbol"):
+		return "OK", false
+	case strings.HasPrefix(packet, "H"):
+		return "OK", false
+	case packet == "g":
+		return s.readRegisters(), false
+	case strings.HasPrefix(packet, "G"):
+		return s.writeRegisters(packet[1:]), false
+	case strings.HasPrefix(packet, "p"):
+		return s.readRegister(packet[1:]), false
+	case strings.HasPrefix(packet, "P"):
+		return s.writeRegister(packet[1:]), false
+	case strings.HasPrefix(packet, "m"):
+		return s.readMemory(packet[1:]), false
+	case strings.HasPrefix(packet, "M"):
+		return s.writeMemory(packet[1:]), false
+	case strings.HasPrefix(packet, "Z0,") || strings.HasPrefix(packet, "Z1,"):
+		return s.breakpoint(packet[3:], true), false
+	case strings.HasPrefix(packet, "z0,") || strings.HasPrefix(packet, "z1,"):
+		return s.breakpoint(packet[3:], false), false
+	case strings.HasPrefix(packet, "s"):
+		return s.step(c), false
+	case strings.HasPrefix(packet, "c"):
+		return s.resume(c, packets), false
+	case packet == "D" || strings.HasPrefix(packet, "D;"):
+		return "OK", true
+	case packet == "k":
+		return "X09", true
+	}
+	return "", false
+}
+
+// stopReply tells gdb why the program is not running, W00 once STOP is set
+func (s *Stub) stopReply() string {
+	if s.Machine.Halted() {
+		return "W00"
+	}
+	return "S05"
+}
+
+// fault prints an execution error on the gdb console and turns it into a
+// signal, SIGSEGV for memory faults and SIGILL for anything else
+func (s *Stub) fault(c *conn, err error) string {
+	c.send("O" + hex.EncodeToString([]byte(err.Error()+"\n")))
+	var memoryFault *extras.MemoryFaultError
+	if errors.As(err, &memoryFault) {
+		return "S0b"
+	}
+	return "S04"
+}
+
+func (s *Stub) features(args string) string {
+	offset, length, err := parseRange(args)
+	if err != nil {
+		return "E01"
+	}
+	if offset >= len(s.xml) {
+		return "l"
+	}
+	end := offset + length
+	if end >= len(s.xml) {
+		return "l" + s.xml[offset:]
+	}
+	return "m" + s.xml[offset:end]
+}
+
+func (s *Stub) readRegisters() string {
+	var sb strings.Builder
+	for _, reg := range s.registers {
+		sb.WriteString(encode(reg.get(), reg.Bytes))
+	}
+	return sb.String()
+}
+
+func (s *Stub) writeRegisters(data string) string {
+	for _, reg := range s.registers {
+		if len(data) < reg.Bytes*2 {
+			return "E01"
+		}
+		val, err := decode(data[:reg.Bytes*2])
+		if err != nil || reg.set(val) != nil {
+			return "E01"
+		}
+		data = data[reg.Bytes*2:]
+	}
+	return "OK"
+}
+
+func (s *Stub) register(number string) (register, bool) {
+	idx, err := strconv.ParseUint(number, 16, 16)
+	if err != nil || int(idx) >= len(s.registers) {
+		return register{}, false
+	}
+	return s.registers[idx], true
+}
+
+func (s *Stub) readRegister(args string) string {
+	reg, ok := s.register(args)
+	if !ok {
+		return "E01"
+	}
+	return encode(reg.get(), reg.Bytes)
+}
+
+func (s *Stub) writeRegister(args string) string {
+	number, data, found := strings.Cut(args, "=")
+	reg, ok := s.register(number)
+	if !found || !ok || len(data) != reg.Bytes*2 {
+		return "E01"
+	}
+	val, err := decode(data)
+	if err != nil || reg.set(val) != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+// readMemory answers "addr,length" with the bytes of the words they cover,
+// a read running past the end returns what could be read
+func (s *Stub) readMemory(args string) string {
+	address, length, err := parseRange(args)
+	if err != nil {
+		return "E01"
+	}
+	var sb strings.Builder
+	for idx := address; idx < address+length; idx++ {
+		b, err := s.readByte(idx)
+		if err != nil {
+			break
+		}
+		fmt.Fprintf(&sb, "%02x", b)
+	}
+	if sb.Len() == 0 && length > 0 {
+		return "E01"
+	}
+	return sb.String()
+}
+
+// writeMemory handles "addr,length:bytes"
+func (s *Stub) writeMemory(args string) string {
+	rangeArgs, data, found := strings.Cut(args, ":")
+	address, length, err := parseRange(rangeArgs)
+	if !found || err != nil {
+		return "E01"
+	}
+	bytes, err := hex.DecodeString(data)
+	if err != nil || len(bytes) != length {
+		return "E01"
+	}
+	for idx, b := range bytes {
+		if err := s.writeByte(address+idx, b); err != nil {
+			return "E01"
+		}
+	}
+	return "OK"
+}
+
+// readByte picks a byte of a little endian word, address is a gdb byte address
+func (s *Stub) readByte(address int) (byte, error) {
+	if address/s.wordBytes >= int(s.Machine.MemorySize()) {
+		return 0, &extras.MemoryFaultError{Address: address / s.wordBytes, Size: int(s.Machine.MemorySize())}
+	}
+	word, err := s.Machine.ReadMemory(uint16(address / s.wordBytes))
+	return byte(word >> (8 * (address % s.wordBytes))), err
+}
+
+func (s *Stub) writeByte(address int, b byte) error {
+	if address/s.wordBytes >= int(s.Machine.MemorySize()) {
+		return &extras.MemoryFaultError{Address: address / s.wordBytes, Size: int(s.Machine.MemorySize())}
+	}
+	idx := uint16(address / s.wordBytes)
+	word, err := s.Machine.ReadMemory(idx)
+	if err != nil {
+		return err
+	}
+	shift := 8 * (address % s.wordBytes)
+	word = word&^(0xFF<<shift) | uint16(b)<<shift
+	return s.Machine.WriteMemory(idx, word)
+}
+
+// breakpoint handles Z0 and z0 arguments, "addr,kind", hardware breakpoints
+// (Z1) are served the same way
+func (s *Stub) breakpoint(args string, insert bool) string {
+	sAddress, _, _ := strings.Cut(args, ",")
+	address, err := strconv.ParseUint(sAddress, 16, 16)
+	if err != nil || int(address)%s.wordBytes != 0 || address/uint64(s.wordBytes) >= uint64(s.Machine.MemorySize()) {
+		return "E01"
+	}
+	if insert {
+		s.Breakpoints[uint16(address)/uint16(s.wordBytes)] = true
+	} else {
+		delete(s.Breakpoints, uint16(address)/uint16(s.wordBytes))
+	}
+	return "OK"
+}
+
+func (s *Stub) step(c *conn) string {
+	if s.Machine.Halted() {
+		return "W00"
+	}
+	if _, err := s.Machine.Step(); err != nil {
+		return s.fault(c, err)
+	}
+	return s.stopReply()
+}
+
+// resume runs until a breakpoint, STOP, an error or ctrl-c, the machine only
+// checks breakpoints when there are some, any other packet gdb sends meanwhile
+// waits for the stop reply
+func (s *Stub) resume(c *conn, packets <-chan string) string {
+	if s.Machine.Halted() {
+		return "W00"
+	}
+	if len(s.Breakpoints) > 0 {
+		s.Machine.SetWatch(func(result machines.StepResult) (string, bool) {
+			return "breakpoint", s.Breakpoints[result.PCAfter]
+		})
+		defer s.Machine.SetWatch(nil)
+	}
+	for {
+		err := s.Machine.Run(chunk)
+		var pause *machines.BreakError
+		switch {
+		case errors.As(err, &pause):
+			return "S05"
+		case err != nil:
+			return s.fault(c, err)
+		case s.Machine.Halted():
+			return "W00"
+		}
+		select {
+		case packet, ok := <-packets:
+			if !ok || packet == interrupt {
+				return "S02"
+			}
+			c.queued = append(c.queued, packet)
+		default:
+		}
+	}
+}
+
+// parseRange reads the hex "addr,length" pair used by m, M and qXfer
+func parseRange(args string) (int, int, error) {
+	sAddress, sLength, found := strings.Cut(args, ",")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid range %q", args)
+	}
+	address, err := strconv.ParseUint(sAddress, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(sLength, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(address), int(length), nil
+}
@@ -0,0 +1,252 @@
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/utils"
+)
+
+// client plays gdb over a loopback connection
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	in   *bufio.Reader
+}
+
+func (c *client) send(packet string) {
+	_, err := fmt.Fprintf(c.conn, "$%s#%02x", packet, checksum(packet))
+	assert.NoError(c.t, err)
+}
+
+// receive returns the next packet, skipping acks
+func (c *client) receive() string {
+	for {
+		b, err := c.in.ReadByte()
+		assert.NoError(c.t, err)
+		if b != '$' {
+			continue
+		}
+		data, err := c.in.ReadString('#')
+		assert.NoError(c.t, err)
+		sum := make([]byte, 2)
+		_, err = c.in.Read(sum)
+		assert.NoError(c.t, err)
+		data = data[:len(data)-1]
+		assert.Equal(c.t, fmt.Sprintf("%02x", checksum(data)), string(sum))
+		return data
+	}
+}
+
+func (c *client) ask(packet string) string {
+	c.send(packet)
+	return c.receive()
+}
+
+func newTestStub(t *testing.T, machineName string, source string) (*Stub, *client, chan error) {
+	target := assembler.Targets[machineName]
+	program, err := assembler.Assemble(source, target)
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := machines.New(machineName, strings.NewReader(""), &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machines.LoadWords(machine, program.Words))
+
+	stub := New(machine, target)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- stub.Serve(listener) }()
+	gdb, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gdb.Close() })
+	return stub, &client{t: t, conn: gdb, in: bufio.NewReader(gdb)}, done
+}
+
+const countdown = `
+        LOAD R0 count
+loop:   ADD R0 minus
+        JUMP R0 IF done
+        JUMP loop
+done:   STOP
+count:  .data 3
+minus:  .data -1
+`
+
+func Test_Stub_Apache8bits(t *testing.T) {
+	stub, gdb, done := newTestStub(t, "apache8", countdown)
+
+	testCases := []struct {
+		packet   string
+		expected string
+	}{
+		{packet: "qSupported:multiprocess+;swbreak+", expected: "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+"},
+		{packet: "?", expected: "S05"},
+		{packet: "Hg0", expected: "OK"},
+		{packet: "qAttached", expected: "1"},
+		{packet: "vMustReplyEmpty", expected: ""},
+		// R0 R1 PC CIR STOP
+		{packet: "g", expected: "0000000000"},
+		{packet: "m5,2", expected: "03ff"},
+		{packet: "m0,1", expected: "05"},
+		{packet: "mf,4", expected: "00"},
+		{packet: "m10,1", expected: "E01"},
+		{packet: "s", expected: "S05"},
+		{packet: "g", expected: "0300010500"},
+		{packet: "p2", expected: "01"},
+		{packet: "Z0,3,1", expected: "OK"},
+		{packet: "c", expected: "S05"},
+		{packet: "p2", expected: "03"},
+		{packet: "p0", expected: "02"},
+		{packet: "z0,3,1", expected: "OK"},
+		{packet: "P1=2a", expected: "OK"},
+		{packet: "p1", expected: "2a"},
+		{packet: "P9=00", expected: "E01"},
+		{packet: "M5,1:07", expected: "OK"},
+		{packet: "m5,1", expected: "07"},
+		{packet: "M20,1:07", expected: "E01"},
+		{packet: "c", expected: "W00"},
+		{packet: "?", expected: "W00"},
+		{packet: "p4", expected: "01"},
+		{packet: "s", expected: "W00"},
+		// clearing STOP lets the program go on
+		{packet: "G0000000000", expected: "OK"},
+		{packet: "?", expected: "S05"},
+		{packet: "D", expected: "OK"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, gdb.ask(tc.packet), tc.packet)
+	}
+	assert.NoError(t, <-done)
+	assert.Empty(t, stub.Breakpoints)
+}
+
+func Test_Stub_Apache16bits(t *testing.T) {
+	_, gdb, done := newTestStub(t, "apache16", `
+        LOAD R2 value
+        >>R2 4
+        STOP
+value:  .data 0x1234
+`)
+
+	testCases := []struct {
+		packet   string
+		expected string
+	}{
+		// R0 R1 R2 R3 PC CIR STOP, words are little endian
+		{packet: "g", expected: "00000000000000000000000000"},
+		// memory is byte addressed, word 3 lives at 6 and 7
+		{packet: "m6,2", expected: "3412"},
+		{packet: "m7,2", expected: "1200"},
+		{packet: "Z0,4,2", expected: "OK"},
+		{packet: "Z0,3,2", expected: "E01"},
+		{packet: "c", expected: "S05"},
+		{packet: "p2", expected: "2301"},
+		{packet: "p4", expected: "0400"},
+		{packet: "p5", expected: "0478"},
+		{packet: "P4=0100", expected: "E01"},
+		// back to the LOAD, which now reads the patched word
+		{packet: "P4=0000", expected: "OK"},
+		{packet: "M7,1:56", expected: "OK"},
+		{packet: "m6,2", expected: "3456"},
+		{packet: "s", expected: "S05"},
+		{packet: "p2", expected: "3456"},
+		{packet: "k", expected: "X09"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, gdb.ask(tc.packet), tc.packet)
+	}
+	assert.NoError(t, <-done)
+}
+
+func Test_Stub_TargetXML(t *testing.T) {
+	_, gdb, _ := newTestStub(t, "apache16", "STOP")
+
+	var xml strings.Builder
+	for offset := 0; ; offset += 0x40 {
+		reply := gdb.ask(fmt.Sprintf("qXfer:features:read:target.xml:%x,40", offset))
+		xml.WriteString(reply[1:])
+		if reply[0] == 'l' {
+			break
+		}
+		assert.Equal(t, byte('m'), reply[0])
+	}
+	assert.Equal(t, `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.apache-iss.apache16">
+    <reg name="R0" bitsize="16" type="int" regnum="0"/>
+    <reg name="R1" bitsize="16" type="int" regnum="1"/>
+    <reg name="R2" bitsize="16" type="int" regnum="2"/>
+    <reg name="R3" bitsize="16" type="int" regnum="3"/>
+    <reg name="PC" bitsize="16" type="code_ptr" regnum="4"/>
+    <reg name="CIR" bitsize="16" type="int" regnum="5"/>
+    <reg name="STOP" bitsize="8" type="int" regnum="6"/>
+  </feature>
+</target>
+`, xml.String())
+}
+
+func Test_Stub_Interrupt(t *testing.T) {
+	_, gdb, _ := newTestStub(t, "apache8", "loop: JUMP loop")
+
+	gdb.send("c")
+	_, err := gdb.conn.Write([]byte{0x03})
+	assert.NoError(t, err)
+	assert.Equal(t, "S02", gdb.receive())
+	assert.Equal(t, "00", gdb.ask("p2"))
+
+	// a packet sent while the program runs is answered after the stop reply
+	gdb.send("c")
+	gdb.send("p2")
+	_, err = gdb.conn.Write([]byte{0x03})
+	assert.NoError(t, err)
+	assert.Equal(t, "S02", gdb.receive())
+	assert.Equal(t, "00", gdb.receive())
+}
+
+func Test_Stub_Fault(t *testing.T) {
+	_, gdb, _ := newTestStub(t, "apache8", "IN 5\nSTOP")
+
+	gdb.send("s")
+	message := gdb.receive()
+	assert.Equal(t, byte('O'), message[0])
+	text, err := hex.DecodeString(message[1:])
+	assert.NoError(t, err)
+	assert.Contains(t, string(text), "invalid input")
+	assert.Equal(t, "S04", gdb.receive())
+}
+
+func Test_Stub_NoAck(t *testing.T) {
+	_, gdb, _ := newTestStub(t, "apache8", "STOP")
+
+	assert.Equal(t, "OK", gdb.ask("QStartNoAckMode"))
+	gdb.send("p0")
+	b, err := gdb.in.ReadByte()
+	assert.NoError(t, err)
+	assert.Equal(t, byte('$'), b)
+	assert.NoError(t, gdb.in.UnreadByte())
+	assert.Equal(t, "00", gdb.receive())
+}
+
+func Test_Stub_Loopback(t *testing.T) {
+	machine, err := machines.New("apache8", nil, nil)
+	assert.NoError(t, err)
+	err = New(machine, assembler.Targets["apache8"]).ListenAndServe("0.0.0.0:1234")
+	assert.EqualError(t, err, `gdb stub only listens on loopback addresses, got "0.0.0.0:1234"`)
+}
@@ -0,0 +1,110 @@
+package gdbstub
+
+import (
+	"fmt"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+// register is one entry of the g packet, in target description order
+type register struct {
+	Name  string
+	Bytes int
+	Type  string
+	get   func() uint16
+	set   func(val uint16) error
+}
+
+// registers lists R0 to Rn, PC, CIR and STOP, each as wide as a machine word
+// but STOP, which is a single byte
+//
+// gdb addresses bytes while Apache memories address words, the PC is shown to
+// gdb as a byte address (word index times word size) so it matches memory reads
+func registers(machine machines.Machine, wordBytes int) []register {
+	var list []register
+	for idx := range machine.Registers() {
+		idx := idx
+		list = append(list, register{
+			Name:  fmt.Sprintf("R%d", idx),
+			Bytes: wordBytes,
+			Type:  "int",
+			get:   func() uint16 { return machine.Registers()[idx] },
+			set:   func(val uint16) error { return machine.SetRegister(idx, val) },
+		})
+	}
+	return append(list,
+		register{
+			Name:  "PC",
+			Bytes: wordBytes,
+			Type:  "code_ptr",
+			get:   func() uint16 { return machine.ProgramCounter() * uint16(wordBytes) },
+			set: func(val uint16) error {
+				if int(val)%wordBytes != 0 || val/uint16(wordBytes) >= machine.MemorySize() {
+					return fmt.Errorf("pc %d is not a word address", val)
+				}
+				return machine.SetProgramCounter(val / uint16(wordBytes))
+			},
+		},
+		register{
+			Name:  "CIR",
+			Bytes: wordBytes,
+			Type:  "int",
+			get:   machine.InstructionRegister,
+			set:   machine.SetInstructionRegister,
+		},
+		register{
+			Name:  "STOP",
+			Bytes: 1,
+			Type:  "int",
+			get: func() uint16 {
+				if machine.Halted() {
+					return 1
+				}
+				return 0
+			},
+			set: func(val uint16) error { machine.SetHalted(val != 0); return nil },
+		},
+	)
+}
+
+// targetXML describes the registers so gdb can show them by name
+func targetXML(target *assembler.Target, list []register) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0"?>` + "\n")
+	sb.WriteString(`<!DOCTYPE target SYSTEM "gdb-target.dtd">` + "\n")
+	sb.WriteString(`<target version="1.0">` + "\n")
+	fmt.Fprintf(&sb, `  <feature name="org.apache-iss.%s">`+"\n", target.Name)
+	for idx, reg := range list {
+		fmt.Fprintf(&sb, `    <reg name="%s" bitsize="%d" type="%s" regnum="%d"/>`+"\n", reg.Name, reg.Bytes*8, reg.Type, idx)
+	}
+	sb.WriteString("  </feature>\n")
+	sb.WriteString("</target>\n")
+	return sb.String()
+}
+
+// encode writes val as little endian hex, the byte order of the g and p packets
+func encode(val uint16, bytes int) string {
+	var sb strings.Builder
+	for idx := 0; idx < bytes; idx++ {
+		fmt.Fprintf(&sb, "%02x", byte(val>>(8*idx)))
+	}
+	return sb.String()
+}
+
+// decode reads a little endian hex value written by encode
+func decode(hex string) (uint16, error) {
+	if len(hex)%2 != 0 || len(hex) > 4 {
+		return 0, fmt.Errorf("invalid register value %q", hex)
+	}
+	var val uint16
+	for idx := 0; idx < len(hex); idx += 2 {
+		var b byte
+		if _, err := fmt.Sscanf(hex[idx:idx+2], "%02x", &b); err != nil {
+			return 0, fmt.Errorf("invalid register value %q", hex)
+		}
+		val |= uint16(b) << (4 * idx)
+	}
+	return val, nil
+}
@@ -0,0 +1,183 @@
+package legacy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+
+	"apache-instruction-set-simulator/extras"
+)
+
+// RAM size
+const MemorySize int = 16
+
+// Machine is the first 8 bits interpreter, the global variables of
+// legacy_version gathered in a struct and its fatal errors returned, what it
+// does is left as it was so it can be checked against machines.Apache8bits
+type Machine struct {
+	// RAM (16 bytes long)
+	Memory [MemorySize]uint8
+	// 2 General Purpose Registers (1 byte long each)
+	Registers [2]uint8
+	// Program Counter (4 bits [should be seen as a] long Special Purpose Register, max memory of 16 spaces)
+	PC uint8
+	// Current Instruction Register (1 byte long Special Purpose Register)
+	CIR uint8
+	// Stop Register (1 bit [should be seen as a] long Special Purpose Register)
+	Stop uint8
+	// MASIC Instruction Set
+	instructions map[uint8]func(uint8) error
+	in           *bufio.Reader
+	out          io.Writer
+}
+
+func New(in io.Reader, out io.Writer) *Machine {
+	if in == nil {
+		in = os.Stdin
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	m := &Machine{in: bufio.NewReader(in), out: out}
+
+	// BINARY | OPCODE     | COMMENT
+	m.instructions = map[uint8]func(uint8) error{
+		// 0000   | LOAD R0    | Load the ADDRESS into register 0
+		0b0000: func(a uint8) error { m.Registers[0] = m.Memory[a]; return nil },
+		// 0001   | STORE R0   | Store content of register 0 into ADDRESS
+		0b0001: func(a uint8) error { m.Memory[a] = m.Registers[0]; return nil },
+		// 0010   | JUMP R0 IF | Jump to line ADDRESS if register 0 is equal to 0
+		0b0010: func(a uint8) error {
+			if m.Registers[0] == 0b00000000 {
+				m.PC = a
+			}
+			return nil
+		},
+		// 0011   | ADD R0     | Add contents at ADDRESS to register 0
+		0b0011: func(a uint8) error { m.Registers[0] += m.Memory[a]; return nil },
+		// 0100   | <<R0       | Bitwise shift register 0 left
+		0b0100: func(a uint8) error { m.Registers[0] <<= 1; return nil },
+		// 0101   | NOT R0     | Bitwise NOT register 0
+		0b0101: func(a uint8) error { m.Registers[0] = ^m.Registers[0]; return nil },
+		// 0110   | JUMP       | Jump to line OPERAND
+		0b0110: func(a uint8) error { m.PC = a; return nil },
+		// 0111   | STOP       | Terminate the program (NOP)
+		0b0111: func(a uint8) error { m.Stop = 0b1; return nil },
+		// 1000   | LOAD R1    | Load the ADDRESS into register 1
+		0b1000: func(a uint8) error { m.Registers[1] = m.Memory[a]; return nil },
+		// 1001   | STORE R1   | Store contents of register 1 into ADDRESS
+		0b1001: func(a uint8) error { m.Memory[a] = m.Registers[1]; return nil },
+		// 1010   | JUMP R1 IF | Jump to line ADDRESS if register 1 is equal to 0
+		0b1010: func(a uint8) error {
+			if m.Registers[1] == 0b00000000 {
+				m.PC = a
+			}
+			return nil
+		},
+		// 1011   | ADD R1     | Add ADDRESS to register 1
+		0b1011: func(a uint8) error { m.Registers[1] += m.Memory[a]; return nil },
+		// 1100   | <<R1       | Bitwise shift register 1 left
+		0b1100: func(a uint8) error { m.Registers[1] <<= 1; return nil },
+		// 1101   | NOT R1     | Bitwise NOT register 1
+		0b1101: func(a uint8) error { m.Registers[1] = ^m.Registers[1]; return nil },
+		// 1110   | OUT R0     | Outputs register 0
+		0b1110: func(a uint8) error {
+			_, err := fmt.Fprintln(m.out, m.Registers[0])
+			return err
+		},
+		// 1111   | IN         | Input into ADDRESS
+		0b1111: func(a uint8) error {
+			fmt.Fprint(m.out, "> ")
+			sVal, err := m.in.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("reading string error: %w", err)
+			}
+			val, err := CastStringToUint8(sVal, 10)
+			if err != nil {
+				return err
+			}
+			m.Memory[a] = val
+			return nil
+		},
+	}
+
+	return m
+}
+
+var nonNumericRegex = regexp.MustCompile(`[^0-9]+`)
+
+// Halted tells whether STOP ran
+func (m *Machine) Halted() bool {
+	return m.Stop == 0b1
+}
+
+// Step runs a single instruction, the body of the loop in Run
+func (m *Machine) Step() error {
+	// fetch
+	if int(m.PC) >= MemorySize {
+		return &extras.MemoryFaultError{Address: int(m.PC), Size: MemorySize}
+	}
+	m.CIR = m.Memory[m.PC]
+	m.PC++
+	// decode
+	var instruction uint8 = m.CIR >> 4
+	var address uint8 = m.CIR & 0b1111
+	// execute
+	return m.instructions[instruction](address)
+}
+
+func (m *Machine) Run(cycles int) error {
+	for m.Stop == 0b0 && cycles > 0 {
+		cycles--
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadProgram reads programs/programName, lines past the end of memory are
+// ignored
+func (m *Machine) LoadProgram(programName string) error {
+	content, err := os.Open(fmt.Sprintf("./programs/%s", programName))
+	if err != nil {
+		return fmt.Errorf("file reading error: %w", err)
+	}
+	defer content.Close()
+
+	scanner := bufio.NewScanner(content)
+	memoryCount := 0
+	for scanner.Scan() {
+		if memoryCount == MemorySize {
+			break
+		}
+		val, err := CastStringToUint8(scanner.Text(), 2)
+		if err != nil {
+			return err
+		}
+		m.Memory[memoryCount] = val
+		memoryCount++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("file scanning error: %w", err)
+	}
+	return nil
+}
+
+// CastStringToUint8 drops every character that is not a digit before parsing,
+// values wrap around past 255
+func CastStringToUint8(sVal string, base int) (uint8, error) {
+	sVal = nonNumericRegex.ReplaceAllString(sVal, "")
+	nVal, err := strconv.ParseInt(sVal, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing string to int error: %w", err)
+	}
+
+	return uint8(nVal), nil
+}
@@ -0,0 +1,140 @@
+package legacy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/machines"
+)
+
+// Divergence is the first difference found between the legacy interpreter and
+// machines.Apache8bits
+type Divergence struct {
+	Instructions int    // instructions both started when it showed, 0 right after loading
+	PC           uint16 // where the instruction that diverged started
+	Field        string // load, error, halted, pc, cir, registers, memory[idx] or output
+	Legacy       string
+	Machine      string
+}
+
+func (e *Divergence) Error() string {
+	return fmt.Sprintf("after %d instructions, the one at %d: %s differs, legacy %s, machine %s", e.Instructions, e.PC, e.Field, e.Legacy, e.Machine)
+}
+
+// Lockstep runs the legacy interpreter and machines.Apache8bits side by side on
+// the same program and input, comparing PC, registers, memory and output after
+// every instruction
+type Lockstep struct {
+	Legacy       *Machine
+	Machine      *machines.Apache8bits
+	Instructions int // instructions both started, the last one may have failed
+	legacyOut    bytes.Buffer
+	machineOut   bytes.Buffer
+}
+
+// NewLockstep builds both interpreters, each one reads its own copy of input
+func NewLockstep(input string) (*Lockstep, error) {
+	l := &Lockstep{}
+	l.Legacy = New(strings.NewReader(input), &l.legacyOut)
+	machine, err := machines.NewApache8bits(extras.NewMemory16x8bits(), strings.NewReader(input), &l.machineOut)
+	if err != nil {
+		return nil, err
+	}
+	l.Machine = machine
+	return l, nil
+}
+
+// LoadProgram loads programs/programName in both, a program only one of them
+// takes is a Divergence
+func (l *Lockstep) LoadProgram(programName string) error {
+	legacyErr := l.Legacy.LoadProgram(programName)
+	machineErr := l.Machine.LoadProgram(programName)
+	if legacyErr != nil && machineErr != nil {
+		return machineErr
+	}
+	if legacyErr != nil || machineErr != nil {
+		return &Divergence{Field: "load", Legacy: describe(legacyErr), Machine: describe(machineErr)}
+	}
+	return l.compare(0, nil, nil)
+}
+
+// LoadWords writes a program straight into both memories
+func (l *Lockstep) LoadWords(words []uint8) error {
+	if len(words) > MemorySize {
+		return fmt.Errorf("program has %d words, memory has %d", len(words), MemorySize)
+	}
+	for idx, word := range words {
+		l.Legacy.Memory[idx] = word
+		if err := l.Machine.WriteMemory(uint16(idx), uint16(word)); err != nil {
+			return err
+		}
+	}
+	return l.compare(0, nil, nil)
+}
+
+// Step runs one instruction on both, it returns a Divergence when they
+// disagree after it and the error both got when they fail alike
+func (l *Lockstep) Step() error {
+	pc := uint16(l.Machine.PC)
+	legacyErr := l.Legacy.Step()
+	_, machineErr := l.Machine.Step()
+	l.Instructions++
+	if err := l.compare(pc, legacyErr, machineErr); err != nil {
+		return err
+	}
+	return machineErr
+}
+
+// Run steps both until they halt together or cycles instructions ran
+func (l *Lockstep) Run(cycles int) error {
+	for ; cycles > 0 && !l.Machine.Halted(); cycles-- {
+		if err := l.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Output is what both printed, they are the same while no Divergence was found
+func (l *Lockstep) Output() string {
+	return l.machineOut.String()
+}
+
+func (l *Lockstep) compare(pc uint16, legacyErr error, machineErr error) error {
+	diverged := func(field string, legacy interface{}, machine interface{}) error {
+		return &Divergence{Instructions: l.Instructions, PC: pc, Field: field, Legacy: fmt.Sprint(legacy), Machine: fmt.Sprint(machine)}
+	}
+	if (legacyErr == nil) != (machineErr == nil) {
+		return diverged("error", describe(legacyErr), describe(machineErr))
+	}
+	if l.Legacy.Halted() != l.Machine.Halted() {
+		return diverged("halted", l.Legacy.Halted(), l.Machine.Halted())
+	}
+	if l.Legacy.PC != l.Machine.PC {
+		return diverged("pc", l.Legacy.PC, l.Machine.PC)
+	}
+	if l.Legacy.CIR != l.Machine.CIR {
+		return diverged("cir", l.Legacy.CIR, l.Machine.CIR)
+	}
+	if l.Legacy.Registers != l.Machine.REGISTERS {
+		return diverged("registers", l.Legacy.Registers, l.Machine.REGISTERS)
+	}
+	for idx, word := range l.Machine.MEMORY.Snapshot() {
+		if l.Legacy.Memory[idx] != word {
+			return diverged(fmt.Sprintf("memory[%d]", idx), l.Legacy.Memory[idx], word)
+		}
+	}
+	if l.legacyOut.String() != l.machineOut.String() {
+		return diverged("output", fmt.Sprintf("%q", l.legacyOut.String()), fmt.Sprintf("%q", l.machineOut.String()))
+	}
+	return nil
+}
+
+func describe(err error) string {
+	if err == nil {
+		return "no error"
+	}
+	return fmt.Sprintf("%q", err.Error())
+}
@@ -0,0 +1,70 @@
+package legacy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/extras"
+)
+
+// IN 14, LOAD R0 14, ADD R0 15, STORE R0 15, OUT R0, JUMP R1 IF 7, NOT R1, STOP, ..., data 5
+var addInput = []uint8{0b1111_1110, 0b0000_1110, 0b0011_1111, 0b0001_1111, 0b1110_0000, 0b1010_0111, 0b1101_0000, 0b0111_0000, 15: 5}
+
+func Test_Lockstep(t *testing.T) {
+	lockstep, err := NewLockstep("10\n")
+	assert.NoError(t, err)
+	assert.NoError(t, lockstep.LoadWords(addInput))
+
+	assert.NoError(t, lockstep.Run(99))
+	assert.True(t, lockstep.Machine.Halted())
+	assert.True(t, lockstep.Legacy.Halted())
+	assert.Equal(t, 7, lockstep.Instructions)
+	assert.Equal(t, "> 15\n", lockstep.Output())
+}
+
+func Test_Lockstep_Divergence(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected Divergence
+	}{
+		// the legacy interpreter reads whole lines, the machine reads words
+		"two numbers on a line": {
+			input:    "3 4\n",
+			expected: Divergence{Instructions: 1, PC: 0, Field: "memory[14]", Legacy: "34", Machine: "3"},
+		},
+		// the legacy interpreter needs the line to end
+		"no newline": {
+			input:    "10",
+			expected: Divergence{Instructions: 1, PC: 0, Field: "error", Legacy: `"reading string error: EOF"`, Machine: "no error"},
+		},
+	}
+
+	for name, testCase := range testCases {
+		lockstep, err := NewLockstep(testCase.input)
+		assert.NoError(t, err, name)
+		assert.NoError(t, lockstep.LoadWords(addInput), name)
+
+		err = lockstep.Run(99)
+		var divergence *Divergence
+		assert.ErrorAs(t, err, &divergence, name)
+		assert.Equal(t, &testCase.expected, divergence, name)
+	}
+
+	assert.EqualError(t, &Divergence{Instructions: 3, PC: 2, Field: "pc", Legacy: "4", Machine: "7"}, "after 3 instructions, the one at 2: pc differs, legacy 4, machine 7")
+}
+
+func Test_Lockstep_Fault(t *testing.T) {
+	// LOAD R0 0 everywhere, both run off the end of memory alike
+	lockstep, err := NewLockstep("")
+	assert.NoError(t, err)
+	assert.NoError(t, lockstep.LoadWords(make([]uint8, MemorySize)))
+
+	err = lockstep.Run(99)
+	var fault *extras.MemoryFaultError
+	assert.ErrorAs(t, err, &fault)
+	assert.Equal(t, 16, fault.Address)
+	assert.Equal(t, 17, lockstep.Instructions)
+
+	assert.EqualError(t, lockstep.LoadWords(make([]uint8, MemorySize+1)), "program has 17 words, memory has 16")
+}
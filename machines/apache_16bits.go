@@ -3,7 +3,6 @@ package machines
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 
 	"apache-instruction-set-simulator/extras"
@@ -12,54 +11,196 @@ import (
 
 const apache16bitsMaxPCbits uint16 = 0b10000000000
 
+const apache16bitsName = "apache16"
+
+func init() {
+	Register(apache16bitsName, func(in io.Reader, out io.Writer) (Machine, error) {
+		return NewApache16bits(extras.NewMemory1024x16bits(), in, out)
+	})
+}
+
 type Apache16bits struct {
-	REGISTERS    [4]uint16                     // 2 General Purpose Registers (1 word each)
+	REGISTERS    [4]uint16                     // 4 General Purpose Registers (1 word each)
 	PC           uint16                        // Program Counter (1 word Special Purpose Register, max memory of 1024 spaces)
 	CIR          uint16                        // Current Instruction Register (1 word long Special Purpose Register)
 	STOP         uint8                         // Stop Register (1 bit [should be seen as a] long Special Purpose Register)
-	INSTRUCTIONS map[uint8]func(uint8, uint16) // MASIC Instruction Set
-	MEMORY       extras.Memory
+	INSTRUCTIONS [16]func(uint8, uint16) error // MASIC Instruction Set, indexed by opcode
+	MEMORY       extras.Memory[uint16, uint16] // replace it through SetCache, the machine keeps state about it
+	record       *StepResult                   // filled while Step runs, nil otherwise
+	watch        Watch                         // checked by Run after every instruction when set
+	history      *History                      // undo log filled by Step and Run when set
+	timing       *Timing                       // prices every instruction in clock cycles
+	costs        []int                         // cycles of each opcode under timing
+	cycles       int                           // clock cycles since Reset
+	instructions int                           // instructions executed since Reset
+	decoded      predecoded                    // words already fetched and decoded, nil while the memory has to see every fetch
+	latent       extras.Latent                 // the memory when its accesses add cycles
 }
 
 // it will break the 16 bits in 3 pieces
 // first 4 bits are for command, tue next 2 are for index 0 and the last 10 are for index 1
 // cmd  idx0   idx1
 // 0000 00     0000000000
-func (m *Apache16bits) Run(cycles int) {
-	for m.STOP == 0b0 && cycles > 0 {
-		cycles--
-		// fetch
-		m.CIR = utils.CastInterfaceToUint16(m.MEMORY.Get(m.PC))
-		m.PC++
+func (m *Apache16bits) step() error {
+	// fetch, words decoded before skip the memory
+	word, ok := m.decoded.get(int(m.PC))
+	if !ok {
+		cir, err := m.MEMORY.Get(m.PC)
+		if err != nil {
+			return err
+		}
 		// decode
-		var instruction uint8 = uint8(m.CIR >> 12)
-		var addresses uint16 = m.CIR & 0b111111111111
-		var address0 uint8 = uint8(addresses >> 10)
-		var address1 uint16 = addresses & 0b1111111111
-		// execute
-		m.INSTRUCTIONS[instruction](address0, address1)
+		var addresses uint16 = cir & 0b111111111111
+		word = decoded{valid: true, cir: cir, opcode: uint8(cir >> 12), register: uint8(addresses >> 10), operand: addresses & 0b1111111111}
+		m.decoded.put(int(m.PC), word)
+	}
+	m.CIR = word.cir
+	m.PC++
+	if m.record != nil {
+		m.record.CIR = word.cir
+		m.record.Opcode = word.opcode
+		m.record.Register = word.register
+		m.record.Operand = word.operand
+	}
+	// execute
+	err := m.INSTRUCTIONS[word.opcode](word.register, word.operand)
+	cycles := m.costs[word.opcode]
+	if m.latent != nil {
+		cycles += m.latent.Latency()
+	}
+	m.instructions++
+	m.cycles += cycles
+	if m.record != nil {
+		m.record.Cycles = cycles
 	}
+	return err
 }
 
-func NewApache16bits(memory extras.Memory, in *os.File, out io.Writer) *Apache16bits {
-	if in == nil {
-		in = os.Stdin
+// Step executes a single instruction and reports what it did
+func (m *Apache16bits) Step() (StepResult, error) {
+	result := StepResult{
+		PCBefore:        m.PC,
+		RegistersBefore: m.Registers(),
 	}
+	undo := Undo{CIR: m.CIR, Halted: m.Halted(), Cycles: m.cycles, Instructions: m.instructions}
+	m.record = &result
+	err := m.step()
+	m.record = nil
+	result.PCAfter = m.PC
+	result.RegistersAfter = m.Registers()
+	result.Halted = m.Halted()
+	result.Fault = err
+	if m.history != nil {
+		undo.Result = result
+		m.history.record(undo)
+	}
+	return result, err
+}
 
-	if out == nil {
-		out = os.Stdout
+// Run executes instructions until they used up cycles clock cycles, as priced
+// by the timing, the last one may go over, it stops at the first error or
+// when the watch asks for it, with a watch or a history every instruction goes
+// through Step
+func (m *Apache16bits) Run(cycles int) error {
+	if m.watch != nil || m.history != nil {
+		return runWatched(m, m.watch, cycles)
 	}
+	for m.STOP == 0b0 && cycles > 0 {
+		before := m.cycles
+		if err := m.step(); err != nil {
+			return err
+		}
+		cycles -= m.cycles - before
+	}
+	return nil
+}
+
+// SetWatch installs a watch consulted by Run, nil removes it
+func (m *Apache16bits) SetWatch(watch Watch) {
+	m.watch = watch
+}
 
-	if !(utils.CastInterfaceToUint16(memory.Size()) <= apache16bitsMaxPCbits) {
-		log.Fatalf("Memory is too big, max is: %d", apache16bitsMaxPCbits)
+// SetTiming prices instructions with timing, nil goes back to UnitTiming
+func (m *Apache16bits) SetTiming(timing *Timing) error {
+	if timing == nil {
+		timing = UnitTiming
 	}
+	costs, err := timing.costs(apache16bitsWork)
+	if err != nil {
+		return err
+	}
+	m.timing, m.costs = timing, costs
+	return nil
+}
 
-	machine := &Apache16bits{
-		MEMORY: memory,
+func (m *Apache16bits) Timing() *Timing {
+	return m.timing
+}
+
+// Cycles counts the clock cycles spent since Reset
+func (m *Apache16bits) Cycles() int {
+	return m.cycles
+}
+
+// Instructions counts the instructions executed since Reset
+func (m *Apache16bits) Instructions() int {
+	return m.instructions
+}
+
+// SetClock puts back the cycle and instruction counters, as stepping back does
+func (m *Apache16bits) SetClock(cycles int, instructions int) {
+	m.cycles, m.instructions = cycles, instructions
+}
+
+// SetCache puts a cache shaped by config in front of the memory, replacing
+// the one already there, nil takes it away
+func (m *Apache16bits) SetCache(config *extras.CacheConfig) error {
+	memory := extras.Uncached(m.MEMORY)
+	if config == nil {
+		m.attach(memory)
+		return nil
+	}
+	cache, err := extras.NewCache(memory, *config)
+	if err != nil {
+		return err
 	}
+	m.attach(cache)
+	return nil
+}
+
+// attach makes memory the memory of the machine, a memory adding latency has
+// to see every fetch so nothing is predecoded for it
+func (m *Apache16bits) attach(memory extras.Memory[uint16, uint16]) {
+	m.MEMORY = memory
+	m.latent, _ = memory.(extras.Latent)
+	m.decoded = nil
+	if m.latent == nil {
+		m.decoded = make(predecoded, memory.Size())
+	}
+}
+
+// CacheStats are the statistics of the cache in front of the memory, nil without one
+func (m *Apache16bits) CacheStats() *extras.CacheStats {
+	if cache, ok := m.MEMORY.(*extras.Cache[uint16, uint16]); ok {
+		return &cache.Stats
+	}
+	return nil
+}
+
+// SetHistory starts recording an undo log of every instruction, nil stops it
+func (m *Apache16bits) SetHistory(history *History) {
+	m.history = history
+}
+
+func (m *Apache16bits) LoadProgram(programName string) error {
+	defer m.attach(m.MEMORY)
+	return m.MEMORY.LoadProgram(programName)
+}
 
+// Reset puts every register back to its power on value, memory is left untouched
+func (m *Apache16bits) Reset() {
 	// 4 General Purpose Registers
-	machine.REGISTERS = [4]uint16{
+	m.REGISTERS = [4]uint16{
 		0b0000000000000000,
 		0b0000000000000000,
 		0b0000000000000000,
@@ -67,68 +208,254 @@ func NewApache16bits(memory extras.Memory, in *os.File, out io.Writer) *Apache16
 	}
 
 	// Program Counter
-	machine.PC = 0b00000000
+	m.PC = 0b00000000
 
 	// Current Instruction Register
-	machine.CIR = 0b0000000000000000
+	m.CIR = 0b0000000000000000
 
 	// Stop Register
-	machine.STOP = 0b0
+	m.STOP = 0b0
+
+	// Clock
+	m.cycles = 0
+	m.instructions = 0
+}
+
+func (m *Apache16bits) Halted() bool {
+	return m.STOP == 0b1
+}
+
+func (m *Apache16bits) Registers() []uint16 {
+	return append([]uint16{}, m.REGISTERS[:]...)
+}
+
+func (m *Apache16bits) SetRegister(idx int, val uint16) error {
+	if idx < 0 || idx >= len(m.REGISTERS) {
+		return fmt.Errorf("register R%d does not exist", idx)
+	}
+	m.REGISTERS[idx] = val
+	return nil
+}
+
+func (m *Apache16bits) ProgramCounter() uint16 {
+	return m.PC
+}
+
+func (m *Apache16bits) SetProgramCounter(pc uint16) error {
+	m.PC = pc
+	return nil
+}
+
+func (m *Apache16bits) InstructionRegister() uint16 {
+	return m.CIR
+}
+
+func (m *Apache16bits) SetInstructionRegister(cir uint16) error {
+	m.CIR = cir
+	return nil
+}
+
+// SetHalted raises or clears the STOP register, clearing it lets a halted program go on
+func (m *Apache16bits) SetHalted(halted bool) {
+	m.STOP = 0b0
+	if halted {
+		m.STOP = 0b1
+	}
+}
+
+func (m *Apache16bits) MemorySize() uint16 {
+	return m.MEMORY.Size()
+}
+
+func (m *Apache16bits) ReadMemory(idx uint16) (uint16, error) {
+	return extras.Uncached(m.MEMORY).Get(idx)
+}
+
+func (m *Apache16bits) WriteMemory(idx uint16, val uint16) error {
+	if err := extras.Uncached(m.MEMORY).Set(idx, val); err != nil {
+		return err
+	}
+	m.decoded.invalidate(int(idx))
+	return nil
+}
+
+// Snapshot copies the registers and the memory
+func (m *Apache16bits) Snapshot() Snapshot {
+	return Snapshot{
+		Version:   SnapshotVersion,
+		Machine:   apache16bitsName,
+		Registers: m.Registers(),
+		PC:        m.PC,
+		CIR:       m.CIR,
+		Halted:    m.Halted(),
+		Memory:    m.MEMORY.Snapshot(),
+	}
+}
+
+// Restore puts the machine back in a snapshotted state, nothing changes when
+// the snapshot does not fit
+func (m *Apache16bits) Restore(snapshot Snapshot) error {
+	if err := snapshot.check(apache16bitsName, len(m.REGISTERS), int(m.MemorySize())); err != nil {
+		return err
+	}
+	if err := m.MEMORY.Restore(snapshot.Memory); err != nil {
+		return err
+	}
+	m.attach(m.MEMORY)
+	copy(m.REGISTERS[:], snapshot.Registers)
+	m.PC = snapshot.PC
+	m.CIR = snapshot.CIR
+	m.SetHalted(snapshot.Halted)
+	return nil
+}
+
+func (m *Apache16bits) load(idx uint16) (uint16, error) {
+	val, err := m.MEMORY.Get(idx)
+	if err == nil && m.record != nil {
+		m.record.Reads = append(m.record.Reads, MemoryAccess{Address: idx, Value: val, Previous: val})
+	}
+	return val, err
+}
+
+// store writes memory, forgetting what was predecoded at idx so code writing
+// code runs what it wrote
+func (m *Apache16bits) store(idx uint16, val uint16) error {
+	if m.record == nil {
+		if err := m.MEMORY.Set(idx, val); err != nil {
+			return err
+		}
+		m.decoded.invalidate(int(idx))
+		return nil
+	}
+	previous, err := extras.Uncached(m.MEMORY).Get(idx)
+	if err != nil {
+		return err
+	}
+	if err := m.MEMORY.Set(idx, val); err != nil {
+		return err
+	}
+	m.decoded.invalidate(int(idx))
+	m.record.Writes = append(m.record.Writes, MemoryAccess{Address: idx, Value: val, Previous: previous})
+	return nil
+}
+
+func NewApache16bits(memory extras.Memory[uint16, uint16], in io.Reader, out io.Writer) (*Apache16bits, error) {
+	if in == nil {
+		in = os.Stdin
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if !(memory.Size() <= apache16bitsMaxPCbits) {
+		return nil, &ConfigError{Reason: fmt.Sprintf("memory is too big, max is: %d", apache16bitsMaxPCbits)}
+	}
+
+	machine := &Apache16bits{}
+
+	machine.attach(memory)
+	machine.Reset()
+	machine.SetTiming(UnitTiming)
 
 	//     BINARY | OPCODE      | COMMENT
-	machine.INSTRUCTIONS = map[uint8]func(uint8, uint16){
+	machine.INSTRUCTIONS = [16]func(uint8, uint16) error{
 		// 0000   | LOAD RX AX  | Load the ADDRESS X into register X
-		0b0000: func(idx0 uint8, idx1 uint16) {
-			machine.REGISTERS[idx0] = utils.CastInterfaceToUint16(machine.MEMORY.Get(idx1))
+		0b0000: func(idx0 uint8, idx1 uint16) error {
+			val, err := machine.load(idx1)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[idx0] = val
+			return nil
 		},
 		// 0001   | STORE RX AX | Store content of register X into ADDRESS X
-		0b0001: func(idx0 uint8, idx1 uint16) { machine.MEMORY.Set(idx1, machine.REGISTERS[idx0]) },
+		0b0001: func(idx0 uint8, idx1 uint16) error { return machine.store(idx1, machine.REGISTERS[idx0]) },
 		// 0010   | JUMP RX IF  | Jump to line ADDRESS X if register X is equal to 0
-		0b0010: func(idx0 uint8, idx1 uint16) {
+		0b0010: func(idx0 uint8, idx1 uint16) error {
 			if machine.REGISTERS[idx0] == 0b0000000000000000 {
 				machine.PC = idx1
 			}
+			return nil
 		},
 		// 0011   | ADD RX AX   | Add contents at ADDRESS X to register X
-		0b0011: func(idx0 uint8, idx1 uint16) {
-			machine.REGISTERS[idx0] += utils.CastInterfaceToUint16(machine.MEMORY.Get(idx1))
+		0b0011: func(idx0 uint8, idx1 uint16) error {
+			val, err := machine.load(idx1)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[idx0] += val
+			return nil
 		},
 		// 0100   | SUB RX AX   | Sub contents at ADDRESS X to register X
-		0b0100: func(idx0 uint8, idx1 uint16) {
-			machine.REGISTERS[idx0] -= utils.CastInterfaceToUint16(machine.MEMORY.Get(idx1))
+		0b0100: func(idx0 uint8, idx1 uint16) error {
+			val, err := machine.load(idx1)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[idx0] -= val
+			return nil
 		},
 		// 0101   | MUT RX AX   | Mut contents at ADDRESS X to register X
-		0b0101: func(idx0 uint8, idx1 uint16) {
-			machine.REGISTERS[idx0] *= utils.CastInterfaceToUint16(machine.MEMORY.Get(idx1))
+		0b0101: func(idx0 uint8, idx1 uint16) error {
+			val, err := machine.load(idx1)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[idx0] *= val
+			return nil
 		},
 		// 0110   | DIV RX AX   | Div contents at ADDRESS X to register X
-		0b0110: func(idx0 uint8, idx1 uint16) {
-			machine.REGISTERS[idx0] /= utils.CastInterfaceToUint16(machine.MEMORY.Get(idx1))
+		0b0110: func(idx0 uint8, idx1 uint16) error {
+			val, err := machine.load(idx1)
+			if err != nil {
+				return err
+			}
+			if val == 0 {
+				return &ExecutionError{PC: machine.PC - 1, Address: idx1, Value: val, Reason: "division by zero"}
+			}
+			machine.REGISTERS[idx0] /= val
+			return nil
 		},
-		// 0111   | >>RX X      | Bitwise shift register X left, X times
-		0b0111: func(idx0 uint8, idx1 uint16) { machine.REGISTERS[idx0] >>= uint16(idx1) },
+		// 0111   | >>RX X      | Bitwise shift register X right, X times
+		0b0111: func(idx0 uint8, idx1 uint16) error { machine.REGISTERS[idx0] >>= uint16(idx1); return nil },
 		// 1000   | <<RX X      | Bitwise shift register X left, X times
-		0b1000: func(idx0 uint8, idx1 uint16) { machine.REGISTERS[idx0] <<= uint16(idx1) },
+		0b1000: func(idx0 uint8, idx1 uint16) error { machine.REGISTERS[idx0] <<= uint16(idx1); return nil },
 		// 1001   | NOT RX      | Bitwise NOT register X
-		0b1001: func(idx0 uint8, _ uint16) { machine.REGISTERS[idx0] = ^machine.REGISTERS[idx0] },
+		0b1001: func(idx0 uint8, _ uint16) error { machine.REGISTERS[idx0] = ^machine.REGISTERS[idx0]; return nil },
 		// 1010   | JUMP        | Jump to line OPERAND
-		0b1010: func(_ uint8, idx1 uint16) { machine.PC = idx1 },
-		// 1010   |             |
-		0b1011: func(_ uint8, _ uint16) {},
-		// 1010   |             |
-		0b1100: func(_ uint8, _ uint16) {},
-		// 1011   | STOP        | Terminate the program (NOP)
-		0b1101: func(_ uint8, _ uint16) { machine.STOP = 0b1 },
+		0b1010: func(_ uint8, idx1 uint16) error { machine.PC = idx1; return nil },
+		// 1011   |             |
+		0b1011: func(_ uint8, _ uint16) error { return nil },
+		// 1100   |             |
+		0b1100: func(_ uint8, _ uint16) error { return nil },
+		// 1101   | STOP        | Terminate the program (NOP)
+		0b1101: func(_ uint8, _ uint16) error { machine.STOP = 0b1; return nil },
 		// 1110   | OUT RX      | Outputs register X
-		0b1110: func(idx0 uint8, _ uint16) { fmt.Fprintf(out, "%d\n", machine.REGISTERS[idx0]) },
+		0b1110: func(idx0 uint8, _ uint16) error {
+			if machine.record != nil {
+				machine.record.Output = true
+			}
+			_, err := fmt.Fprintf(out, "%d\n", machine.REGISTERS[idx0])
+			return err
+		},
 		// 1111   | IN AX       | Input into ADDRESS
-		0b1111: func(_ uint8, idx1 uint16) {
+		0b1111: func(_ uint8, idx1 uint16) error {
+			if machine.record != nil {
+				machine.record.Input = true
+			}
 			var sVal string
 			fmt.Fprint(out, "> ")
-			fmt.Fscanf(in, "%s", &sVal)
-			machine.MEMORY.Set(idx1, utils.CastStringToUint8(sVal, 10))
+			if _, err := fmt.Fscan(in, &sVal); err != nil {
+				return &utils.InputError{Value: sVal, Base: 10, Err: err}
+			}
+			val, err := utils.CastStringToUint16(sVal, 10)
+			if err != nil {
+				return err
+			}
+			return machine.store(idx1, val)
 		},
 	}
 
-	return machine
+	return machine, nil
 }
@@ -0,0 +1,272 @@
+package machines
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/utils"
+)
+
+func Test_Apache16bits(t *testing.T) {
+	testCases := map[string]struct {
+		program   []uint16
+		init      func(*Apache16bits)
+		evaluator func(*testing.T, *Apache16bits, *os.File, bytes.Buffer)
+	}{
+		"LOAD RX AX": { // Load the ADDRESS X into register X
+			init:    func(machine *Apache16bits) {},
+			program: []uint16{0b0000_10_0000000001, 0b0000_00_1111101000}, // memory at 1 is 1000
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(1000), machine.REGISTERS[2])
+			},
+		},
+		"STORE RX AX": { // Store content of register X into ADDRESS X
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[3] = 1000
+			},
+			program: []uint16{0b0001_11_1111111111},
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				val, err := machine.MEMORY.Get(uint16(1023))
+				assert.NoError(t, err)
+				assert.Equal(t, uint16(1000), val)
+			},
+		},
+		"JUMP RX IF": { // Jump to line ADDRESS X if register X is equal to 0
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[0] = 1
+			},
+			program: []uint16{0b0010_01_1000000000}, // register at 1 is 0
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(512), machine.PC)
+			},
+		},
+		"ADD RX AX": { // Add contents at ADDRESS X to register X
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[1] = 300
+			},
+			program: []uint16{0b0011_01_0000000001, 0b0000_00_0100101100}, // memory at 1 is 300
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(600), machine.REGISTERS[1])
+			},
+		},
+		"SUB RX AX": { // Sub contents at ADDRESS X to register X
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[1] = 300
+			},
+			program: []uint16{0b0100_01_0000000001, 0b0000_00_0000001010}, // memory at 1 is 10
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(290), machine.REGISTERS[1])
+			},
+		},
+		"MUT RX AX": { // Mut contents at ADDRESS X to register X
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[2] = 300
+			},
+			program: []uint16{0b0101_10_0000000001, 0b0000_00_0000001010}, // memory at 1 is 10
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(3000), machine.REGISTERS[2])
+			},
+		},
+		"DIV RX AX": { // Div contents at ADDRESS X to register X
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[3] = 300
+			},
+			program: []uint16{0b0110_11_0000000001, 0b0000_00_0000001010}, // memory at 1 is 10
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(30), machine.REGISTERS[3])
+			},
+		},
+		">>RX X": { // Bitwise shift register X right, X times
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[0] = 0b1000000000000001
+			},
+			program: []uint16{0b0111_00_0000000011},
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(0b0001000000000000), machine.REGISTERS[0])
+			},
+		},
+		"<<RX X": { // Bitwise shift register X left, X times
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[0] = 0b1000000000000001
+			},
+			program: []uint16{0b1000_00_0000000011},
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(0b0000000000001000), machine.REGISTERS[0])
+			},
+		},
+		"NOT RX": { // Bitwise NOT register X
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[1] = 0b0000000010010001
+			},
+			program: []uint16{0b1001_01_0000000000},
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(0b1111111101101110), machine.REGISTERS[1])
+			},
+		},
+		"JUMP": { // Jump to line OPERAND
+			init:    func(machine *Apache16bits) {},
+			program: []uint16{0b1010_00_1111111111},
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint16(1023), machine.PC)
+			},
+		},
+		"STOP": { // Terminate the program (NOP)
+			init:    func(machine *Apache16bits) {},
+			program: []uint16{0b1101_00_0000000000},
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, _ bytes.Buffer) {
+				assert.Equal(t, uint8(1), machine.STOP)
+			},
+		},
+		"OUT RX": { // Outputs register X
+			init: func(machine *Apache16bits) {
+				machine.REGISTERS[3] = 8772
+			},
+			program: []uint16{0b1110_11_0000000000},
+			evaluator: func(t *testing.T, machine *Apache16bits, _ *os.File, out bytes.Buffer) {
+				assert.Equal(t, "8772\n", utils.ClearOutputForTesting(out.String()))
+			},
+		},
+		"IN AX": { // Input into ADDRESS
+			init:    func(machine *Apache16bits) {},
+			program: []uint16{0b1111_00_0000000010},
+			evaluator: func(t *testing.T, machine *Apache16bits, in *os.File, _ bytes.Buffer) {
+				val, err := machine.MEMORY.Get(uint16(2))
+				assert.NoError(t, err)
+				assert.Equal(t, uint16(1000), val)
+			},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			memory := extras.NewMemory1024x16bits()
+			for idx, word := range testCase.program {
+				memory.Set(uint16(idx), word)
+			}
+
+			in, err := utils.NewTestInput("1000\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			out := utils.NewTestOutput()
+
+			machine, err := NewApache16bits(memory, in, &out)
+			assert.NoError(t, err)
+
+			testCase.init(machine)
+
+			err = machine.Run(1)
+			assert.NoError(t, err)
+
+			testCase.evaluator(t, machine, in, out)
+		})
+	}
+}
+
+func Test_Apache16bits_DivisionByZero(t *testing.T) {
+	memory := extras.NewMemory1024x16bits()
+	// NOT R1, DIV R1 5, ..., data 0
+	assert.NoError(t, memory.Set(0, 0b1001_01_0000000000))
+	assert.NoError(t, memory.Set(1, 0b0110_01_0000000101))
+
+	machine, err := NewApache16bits(memory, nil, nil)
+	assert.NoError(t, err)
+
+	err = machine.Run(99)
+	var execErr *ExecutionError
+	assert.ErrorAs(t, err, &execErr)
+	assert.Equal(t, &ExecutionError{PC: 1, Address: 5, Value: 0, Reason: "division by zero"}, execErr)
+	assert.EqualError(t, err, "instruction at 1: division by zero, address: 5, value: 0")
+	assert.Equal(t, []uint16{0, 0xFFFF, 0, 0}, machine.Registers())
+}
+
+func benchmarkApache16bits(b *testing.B) *Apache16bits {
+	memory := extras.NewMemory1024x16bits()
+	// LOAD R0 1023, ADD R0 1022, STORE R0 1023, NOT R1, JUMP 0, ..., data 1, data 0
+	program := []uint16{0b0000_00_1111111111, 0b0011_00_1111111110, 0b0001_00_1111111111, 0b1001_01_0000000000, 0b1010_00_0000000000}
+	for idx, word := range program {
+		if err := memory.Set(uint16(idx), word); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := memory.Set(uint16(1022), uint16(1)); err != nil {
+		b.Fatal(err)
+	}
+
+	machine, err := NewApache16bits(memory, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return machine
+}
+
+func Benchmark_Apache16bits_Run(b *testing.B) {
+	benchmarkRun(b, benchmarkApache16bits(b))
+}
+
+// Benchmark_Apache16bits_Run_Fetching fetches and decodes every instruction, as
+// the machine does with a cache in front of the memory
+func Benchmark_Apache16bits_Run_Fetching(b *testing.B) {
+	machine := benchmarkApache16bits(b)
+	machine.decoded = nil
+	benchmarkRun(b, machine)
+}
+
+// Benchmark_Apache16bits_Run_MapDispatch is the baseline the arrays replaced,
+// the Run loop as it was with INSTRUCTIONS a map[uint8]func(uint8, uint16) error
+func Benchmark_Apache16bits_Run_MapDispatch(b *testing.B) {
+	machine := benchmarkApache16bits(b)
+	instructions := map[uint8]func(uint8, uint16) error{}
+	for opcode, instruction := range machine.INSTRUCTIONS {
+		instructions[uint8(opcode)] = instruction
+	}
+	benchmarkLoop(b, machine, func(cycles int) error {
+		for machine.STOP == 0b0 && cycles > 0 {
+			cir, err := machine.MEMORY.Get(machine.PC)
+			if err != nil {
+				return err
+			}
+			machine.CIR = cir
+			machine.PC++
+			opcode := uint8(cir >> 12)
+			if err := instructions[opcode](uint8(cir>>10)&0b11, cir&0b1111111111); err != nil {
+				return err
+			}
+			cost := machine.costs[opcode]
+			if latent, ok := machine.MEMORY.(extras.Latent); ok {
+				cost += latent.Latency()
+			}
+			machine.instructions++
+			machine.cycles += cost
+			cycles -= cost
+		}
+		return nil
+	})
+}
+
+func Fuzz_Apache16bits_Run(f *testing.F) {
+	addImageSeeds(f, "../programs/*16.txt", func(content []byte) ([]byte, error) {
+		memory := extras.NewMemory1024x16bits()
+		err := memory.ReadProgram(bytes.NewReader(content))
+		image := make([]byte, 0, 2*int(memory.Size()))
+		for _, word := range memory.Snapshot() {
+			image = binary.BigEndian.AppendUint16(image, word)
+		}
+		return image, err
+	})
+
+	f.Fuzz(func(t *testing.T, image []byte, input string) {
+		words := make([]uint16, 0, 1024)
+		for idx := 0; idx+1 < len(image) && idx < 2048; idx += 2 {
+			words = append(words, binary.BigEndian.Uint16(image[idx:]))
+		}
+		fuzzRun(t, apache16bitsName, words, input, 10000)
+	})
+}
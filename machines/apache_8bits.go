@@ -3,7 +3,6 @@ package machines
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 
 	"apache-instruction-set-simulator/extras"
@@ -12,113 +11,478 @@ import (
 
 const apache8bitsMaxPCbits uint8 = 0b10000
 
+const apache8bitsName = "apache8"
+
+func init() {
+	Register(apache8bitsName, func(in io.Reader, out io.Writer) (Machine, error) {
+		return NewApache8bits(extras.NewMemory16x8bits(), in, out)
+	})
+}
+
 type Apache8bits struct {
-	REGISTERS    [2]uint8              // 2 General Purpose Registers (1 byte long each)
-	PC           uint8                 // Program Counter (4 bits [should be seen as a] long Special Purpose Register, max memory of 16 spaces)
-	CIR          uint8                 // Current Instruction Register (1 byte long Special Purpose Register)
-	STOP         uint8                 // Stop Register (1 bit [should be seen as a] long Special Purpose Register)
-	INSTRUCTIONS map[uint8]func(uint8) // MASIC Instruction Set
-	MEMORY       extras.Memory
+	REGISTERS    [2]uint8                    // 2 General Purpose Registers (1 byte long each)
+	PC           uint8                       // Program Counter (4 bits [should be seen as a] long Special Purpose Register, max memory of 16 spaces)
+	CIR          uint8                       // Current Instruction Register (1 byte long Special Purpose Register)
+	STOP         uint8                       // Stop Register (1 bit [should be seen as a] long Special Purpose Register)
+	INSTRUCTIONS [16]func(uint8) error       // MASIC Instruction Set, indexed by opcode
+	MEMORY       extras.Memory[uint8, uint8] // replace it through SetCache, the machine keeps state about it
+	record       *StepResult                 // filled while Step runs, nil otherwise
+	watch        Watch                       // checked by Run after every instruction when set
+	history      *History                    // undo log filled by Step and Run when set
+	timing       *Timing                     // prices every instruction in clock cycles
+	costs        []int                       // cycles of each opcode under timing
+	cycles       int                         // clock cycles since Reset
+	instructions int                         // instructions executed since Reset
+	decoded      predecoded                  // words already fetched and decoded, nil while the memory has to see every fetch
+	latent       extras.Latent               // the memory when its accesses add cycles
 }
 
 // it will break the 8 bits in 2 pieces
 // first 4 bits are for command and the last 4 for index
 // cmd  idx
 // 0000 0000
-func (m *Apache8bits) Run(cycles int) {
-	for m.STOP == 0b0 && cycles > 0 {
-		cycles--
-		// fetch
-		m.CIR = utils.CastInterfaceToUint8(m.MEMORY.Get(m.PC))
-		m.PC++
+func (m *Apache8bits) step() error {
+	// fetch, words decoded before skip the memory
+	word, ok := m.decoded.get(int(m.PC))
+	if !ok {
+		cir, err := m.MEMORY.Get(m.PC)
+		if err != nil {
+			return err
+		}
 		// decode
-		var instruction uint8 = m.CIR >> 4
-		var address uint8 = m.CIR & 0b1111
-		// execute
-		m.INSTRUCTIONS[instruction](address)
+		word = decoded{valid: true, cir: uint16(cir), opcode: cir >> 4, operand: uint16(cir & 0b1111)}
+		m.decoded.put(int(m.PC), word)
 	}
+	m.CIR = uint8(word.cir)
+	m.PC++
+	if m.record != nil {
+		m.record.CIR = word.cir
+		m.record.Opcode = word.opcode
+		m.record.Operand = word.operand
+	}
+	// execute
+	err := m.INSTRUCTIONS[word.opcode](uint8(word.operand))
+	cycles := m.costs[word.opcode]
+	if m.latent != nil {
+		cycles += m.latent.Latency()
+	}
+	m.instructions++
+	m.cycles += cycles
+	if m.record != nil {
+		m.record.Cycles = cycles
+	}
+	return err
 }
 
-func NewApache8bits(memory extras.Memory, in *os.File, out io.Writer) *Apache8bits {
-	if in == nil {
-		in = os.Stdin
+// Step executes a single instruction and reports what it did
+func (m *Apache8bits) Step() (StepResult, error) {
+	result := StepResult{
+		PCBefore:        uint16(m.PC),
+		RegistersBefore: m.Registers(),
+	}
+	undo := Undo{CIR: uint16(m.CIR), Halted: m.Halted(), Cycles: m.cycles, Instructions: m.instructions}
+	m.record = &result
+	err := m.step()
+	m.record = nil
+	result.PCAfter = uint16(m.PC)
+	result.RegistersAfter = m.Registers()
+	result.Halted = m.Halted()
+	result.Fault = err
+	if m.history != nil {
+		undo.Result = result
+		m.history.record(undo)
 	}
+	return result, err
+}
 
-	if out == nil {
-		out = os.Stdout
+// Run executes instructions until they used up cycles clock cycles, as priced
+// by the timing, the last one may go over, it stops at the first error or
+// when the watch asks for it, with a watch or a history every instruction goes
+// through Step
+func (m *Apache8bits) Run(cycles int) error {
+	if m.watch != nil || m.history != nil {
+		return runWatched(m, m.watch, cycles)
+	}
+	for m.STOP == 0b0 && cycles > 0 {
+		before := m.cycles
+		if err := m.step(); err != nil {
+			return err
+		}
+		cycles -= m.cycles - before
 	}
+	return nil
+}
+
+// SetWatch installs a watch consulted by Run, nil removes it
+func (m *Apache8bits) SetWatch(watch Watch) {
+	m.watch = watch
+}
 
-	if !(utils.CastInterfaceToUint8(memory.Size()) <= apache8bitsMaxPCbits) {
-		log.Fatalf("Memory is too big, max is: %d", apache8bitsMaxPCbits)
+// SetTiming prices instructions with timing, nil goes back to UnitTiming
+func (m *Apache8bits) SetTiming(timing *Timing) error {
+	if timing == nil {
+		timing = UnitTiming
+	}
+	costs, err := timing.costs(apache8bitsWork)
+	if err != nil {
+		return err
 	}
+	m.timing, m.costs = timing, costs
+	return nil
+}
+
+func (m *Apache8bits) Timing() *Timing {
+	return m.timing
+}
 
-	machine := &Apache8bits{
-		MEMORY: memory,
+// Cycles counts the clock cycles spent since Reset
+func (m *Apache8bits) Cycles() int {
+	return m.cycles
+}
+
+// Instructions counts the instructions executed since Reset
+func (m *Apache8bits) Instructions() int {
+	return m.instructions
+}
+
+// SetClock puts back the cycle and instruction counters, as stepping back does
+func (m *Apache8bits) SetClock(cycles int, instructions int) {
+	m.cycles, m.instructions = cycles, instructions
+}
+
+// SetCache puts a cache shaped by config in front of the memory, replacing
+// the one already there, nil takes it away
+func (m *Apache8bits) SetCache(config *extras.CacheConfig) error {
+	memory := extras.Uncached(m.MEMORY)
+	if config == nil {
+		m.attach(memory)
+		return nil
+	}
+	cache, err := extras.NewCache(memory, *config)
+	if err != nil {
+		return err
 	}
+	m.attach(cache)
+	return nil
+}
 
+// attach makes memory the memory of the machine, a memory adding latency has
+// to see every fetch so nothing is predecoded for it
+func (m *Apache8bits) attach(memory extras.Memory[uint8, uint8]) {
+	m.MEMORY = memory
+	m.latent, _ = memory.(extras.Latent)
+	m.decoded = nil
+	if m.latent == nil {
+		m.decoded = make(predecoded, memory.Size())
+	}
+}
+
+// CacheStats are the statistics of the cache in front of the memory, nil without one
+func (m *Apache8bits) CacheStats() *extras.CacheStats {
+	if cache, ok := m.MEMORY.(*extras.Cache[uint8, uint8]); ok {
+		return &cache.Stats
+	}
+	return nil
+}
+
+// SetHistory starts recording an undo log of every instruction, nil stops it
+func (m *Apache8bits) SetHistory(history *History) {
+	m.history = history
+}
+
+func (m *Apache8bits) LoadProgram(programName string) error {
+	defer m.attach(m.MEMORY)
+	return m.MEMORY.LoadProgram(programName)
+}
+
+// Reset puts every register back to its power on value, memory is left untouched
+func (m *Apache8bits) Reset() {
 	// 2 General Purpose Registers
-	machine.REGISTERS = [2]uint8{
+	m.REGISTERS = [2]uint8{
 		0b00000000,
 		0b00000000,
 	}
 
 	// Program Counter
-	machine.PC = 0b0000
+	m.PC = 0b0000
 
 	// Current Instruction Register
-	machine.CIR = 0b00000000
+	m.CIR = 0b00000000
 
 	// Stop Register
-	machine.STOP = 0b0
+	m.STOP = 0b0
+
+	// Clock
+	m.cycles = 0
+	m.instructions = 0
+}
+
+func (m *Apache8bits) Halted() bool {
+	return m.STOP == 0b1
+}
+
+func (m *Apache8bits) Registers() []uint16 {
+	return []uint16{uint16(m.REGISTERS[0]), uint16(m.REGISTERS[1])}
+}
+
+func (m *Apache8bits) SetRegister(idx int, val uint16) error {
+	if idx < 0 || idx >= len(m.REGISTERS) {
+		return fmt.Errorf("register R%d does not exist", idx)
+	}
+	if err := fitsUint8(val); err != nil {
+		return err
+	}
+	m.REGISTERS[idx] = uint8(val)
+	return nil
+}
+
+func (m *Apache8bits) ProgramCounter() uint16 {
+	return uint16(m.PC)
+}
+
+func (m *Apache8bits) SetProgramCounter(pc uint16) error {
+	if err := fitsUint8(pc); err != nil {
+		return err
+	}
+	m.PC = uint8(pc)
+	return nil
+}
+
+func (m *Apache8bits) InstructionRegister() uint16 {
+	return uint16(m.CIR)
+}
+
+func (m *Apache8bits) SetInstructionRegister(cir uint16) error {
+	if err := fitsUint8(cir); err != nil {
+		return err
+	}
+	m.CIR = uint8(cir)
+	return nil
+}
+
+// SetHalted raises or clears the STOP register, clearing it lets a halted program go on
+func (m *Apache8bits) SetHalted(halted bool) {
+	m.STOP = 0b0
+	if halted {
+		m.STOP = 0b1
+	}
+}
+
+func (m *Apache8bits) MemorySize() uint16 {
+	return uint16(m.MEMORY.Size())
+}
+
+func (m *Apache8bits) ReadMemory(idx uint16) (uint16, error) {
+	if idx >= m.MemorySize() {
+		return 0, &extras.MemoryFaultError{Address: int(idx), Size: int(m.MemorySize())}
+	}
+	val, err := extras.Uncached(m.MEMORY).Get(uint8(idx))
+	return uint16(val), err
+}
+
+func (m *Apache8bits) WriteMemory(idx uint16, val uint16) error {
+	if idx >= m.MemorySize() {
+		return &extras.MemoryFaultError{Address: int(idx), Size: int(m.MemorySize())}
+	}
+	if err := fitsUint8(val); err != nil {
+		return err
+	}
+	if err := extras.Uncached(m.MEMORY).Set(uint8(idx), uint8(val)); err != nil {
+		return err
+	}
+	m.decoded.invalidate(int(idx))
+	return nil
+}
+
+// Snapshot copies the registers and the memory
+func (m *Apache8bits) Snapshot() Snapshot {
+	words := m.MEMORY.Snapshot()
+	memory := make([]uint16, len(words))
+	for idx, word := range words {
+		memory[idx] = uint16(word)
+	}
+	return Snapshot{
+		Version:   SnapshotVersion,
+		Machine:   apache8bitsName,
+		Registers: m.Registers(),
+		PC:        uint16(m.PC),
+		CIR:       uint16(m.CIR),
+		Halted:    m.Halted(),
+		Memory:    memory,
+	}
+}
+
+// Restore puts the machine back in a snapshotted state, nothing changes when
+// the snapshot does not fit
+func (m *Apache8bits) Restore(snapshot Snapshot) error {
+	if err := snapshot.check(apache8bitsName, len(m.REGISTERS), int(m.MemorySize())); err != nil {
+		return err
+	}
+	values := append(append([]uint16{snapshot.PC, snapshot.CIR}, snapshot.Registers...), snapshot.Memory...)
+	for _, val := range values {
+		if err := fitsUint8(val); err != nil {
+			return &SnapshotError{Reason: "not taken on an 8 bits machine", Err: err}
+		}
+	}
+	words := make([]uint8, len(snapshot.Memory))
+	for idx, word := range snapshot.Memory {
+		words[idx] = uint8(word)
+	}
+	if err := m.MEMORY.Restore(words); err != nil {
+		return err
+	}
+	m.attach(m.MEMORY)
+	for idx, val := range snapshot.Registers {
+		m.REGISTERS[idx] = uint8(val)
+	}
+	m.PC = uint8(snapshot.PC)
+	m.CIR = uint8(snapshot.CIR)
+	m.SetHalted(snapshot.Halted)
+	return nil
+}
+
+func (m *Apache8bits) load(idx uint8) (uint8, error) {
+	val, err := m.MEMORY.Get(idx)
+	if err == nil && m.record != nil {
+		m.record.Reads = append(m.record.Reads, MemoryAccess{Address: uint16(idx), Value: uint16(val), Previous: uint16(val)})
+	}
+	return val, err
+}
+
+// store writes memory, forgetting what was predecoded at idx so code writing
+// code runs what it wrote
+func (m *Apache8bits) store(idx uint8, val uint8) error {
+	if m.record == nil {
+		if err := m.MEMORY.Set(idx, val); err != nil {
+			return err
+		}
+		m.decoded.invalidate(int(idx))
+		return nil
+	}
+	previous, err := extras.Uncached(m.MEMORY).Get(idx)
+	if err != nil {
+		return err
+	}
+	if err := m.MEMORY.Set(idx, val); err != nil {
+		return err
+	}
+	m.decoded.invalidate(int(idx))
+	m.record.Writes = append(m.record.Writes, MemoryAccess{Address: uint16(idx), Value: uint16(val), Previous: uint16(previous)})
+	return nil
+}
+
+func NewApache8bits(memory extras.Memory[uint8, uint8], in io.Reader, out io.Writer) (*Apache8bits, error) {
+	if in == nil {
+		in = os.Stdin
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if !(memory.Size() <= apache8bitsMaxPCbits) {
+		return nil, &ConfigError{Reason: fmt.Sprintf("memory is too big, max is: %d", apache8bitsMaxPCbits)}
+	}
+
+	machine := &Apache8bits{}
+
+	machine.attach(memory)
+	machine.Reset()
+	machine.SetTiming(UnitTiming)
 
 	//     BINARY | OPCODE     | COMMENT
-	machine.INSTRUCTIONS = map[uint8]func(uint8){
+	machine.INSTRUCTIONS = [16]func(uint8) error{
 		// 0000   | LOAD R0    | Load the ADDRESS into register 0
-		0b0000: func(idx uint8) { machine.REGISTERS[0] = utils.CastInterfaceToUint8(machine.MEMORY.Get(idx)) },
+		0b0000: func(idx uint8) error {
+			val, err := machine.load(idx)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[0] = val
+			return nil
+		},
 		// 0001   | STORE R0   | Store content of register 0 into ADDRESS
-		0b0001: func(idx uint8) { machine.MEMORY.Set(idx, machine.REGISTERS[0]) },
+		0b0001: func(idx uint8) error { return machine.store(idx, machine.REGISTERS[0]) },
 		// 0010   | JUMP R0 IF | Jump to line ADDRESS if register 0 is equal to 0
-		0b0010: func(idx uint8) {
+		0b0010: func(idx uint8) error {
 			if machine.REGISTERS[0] == 0b00000000 {
 				machine.PC = idx
 			}
+			return nil
 		},
 		// 0011   | ADD R0     | Add contents at ADDRESS to register 0
-		0b0011: func(idx uint8) { machine.REGISTERS[0] += utils.CastInterfaceToUint8(machine.MEMORY.Get(idx)) },
+		0b0011: func(idx uint8) error {
+			val, err := machine.load(idx)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[0] += val
+			return nil
+		},
 		// 0100   | <<R0       | Bitwise shift register 0 left
-		0b0100: func(_ uint8) { machine.REGISTERS[0] <<= 1 },
+		0b0100: func(_ uint8) error { machine.REGISTERS[0] <<= 1; return nil },
 		// 0101   | NOT R0     | Bitwise NOT register 0
-		0b0101: func(_ uint8) { machine.REGISTERS[0] = ^machine.REGISTERS[0] },
+		0b0101: func(_ uint8) error { machine.REGISTERS[0] = ^machine.REGISTERS[0]; return nil },
 		// 0110   | JUMP       | Jump to line OPERAND
-		0b0110: func(idx uint8) { machine.PC = idx },
+		0b0110: func(idx uint8) error { machine.PC = idx; return nil },
 		// 0111   | STOP       | Terminate the program (NOP)
-		0b0111: func(_ uint8) { machine.STOP = 0b1 },
+		0b0111: func(_ uint8) error { machine.STOP = 0b1; return nil },
 		// 1000   | LOAD R1    | Load the ADDRESS into register 1
-		0b1000: func(idx uint8) { machine.REGISTERS[1] = utils.CastInterfaceToUint8(machine.MEMORY.Get(idx)) },
+		0b1000: func(idx uint8) error {
+			val, err := machine.load(idx)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[1] = val
+			return nil
+		},
 		// 1001   | STORE R1   | Store contents of register 1 into ADDRESS
-		0b1001: func(idx uint8) { machine.MEMORY.Set(idx, machine.REGISTERS[1]) },
+		0b1001: func(idx uint8) error { return machine.store(idx, machine.REGISTERS[1]) },
 		// 1010   | JUMP R1 IF | Jump to line ADDRESS if register 1 is equal to 0
-		0b1010: func(idx uint8) {
+		0b1010: func(idx uint8) error {
 			if machine.REGISTERS[1] == 0b00000000 {
 				machine.PC = idx
 			}
+			return nil
 		},
 		// 1011   | ADD R1     | Add ADDRESS to register 1
-		0b1011: func(idx uint8) { machine.REGISTERS[1] += utils.CastInterfaceToUint8(machine.MEMORY.Get(idx)) },
+		0b1011: func(idx uint8) error {
+			val, err := machine.load(idx)
+			if err != nil {
+				return err
+			}
+			machine.REGISTERS[1] += val
+			return nil
+		},
 		// 1100   | <<R1       | Bitwise shift register 1 left
-		0b1100: func(_ uint8) { machine.REGISTERS[1] <<= 1 },
+		0b1100: func(_ uint8) error { machine.REGISTERS[1] <<= 1; return nil },
 		// 1101   | NOT R1     | Bitwise NOT register 1
-		0b1101: func(_ uint8) { machine.REGISTERS[1] = ^machine.REGISTERS[1] },
+		0b1101: func(_ uint8) error { machine.REGISTERS[1] = ^machine.REGISTERS[1]; return nil },
 		// 1110   | OUT R0     | Outputs register 0
-		0b1110: func(_ uint8) { fmt.Fprintf(out, "%d\n", machine.REGISTERS[0]) },
+		0b1110: func(_ uint8) error {
+			if machine.record != nil {
+				machine.record.Output = true
+			}
+			_, err := fmt.Fprintf(out, "%d\n", machine.REGISTERS[0])
+			return err
+		},
 		// 1111   | IN         | Input into ADDRESS
-		0b1111: func(idx uint8) {
+		0b1111: func(idx uint8) error {
+			if machine.record != nil {
+				machine.record.Input = true
+			}
 			var sVal string
 			fmt.Fprint(out, "> ")
-			fmt.Fscanf(in, "%s", &sVal)
-			machine.MEMORY.Set(idx, utils.CastStringToUint8(sVal, 10))
+			if _, err := fmt.Fscan(in, &sVal); err != nil {
+				return &utils.InputError{Value: sVal, Base: 10, Err: err}
+			}
+			val, err := utils.CastStringToUint8(sVal, 10)
+			if err != nil {
+				return err
+			}
+			return machine.store(idx, val)
 		},
 	}
 
-	return machine
+	return machine, nil
 }
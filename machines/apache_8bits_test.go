@@ -2,7 +2,9 @@ package machines
 
 import (
 	"bytes"
+	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -35,7 +37,9 @@ func Test_Apache8bits(t *testing.T) {
 			},
 			program: "0001 0001\n0000 1111", // memory at 1 is 15, register at 0 is 3
 			evaluator: func(t *testing.T, machine *Apache8bits, _ *os.File, _ bytes.Buffer) {
-				assert.Equal(t, uint8(3), machine.MEMORY.Get(uint8(1)))
+				val, err := machine.MEMORY.Get(uint8(1))
+				assert.NoError(t, err)
+				assert.Equal(t, uint8(3), val)
 			},
 		},
 		"JUMP R0 IF": { // Jump to line ADDRESS if register 0 is equal to 0
@@ -101,7 +105,9 @@ func Test_Apache8bits(t *testing.T) {
 			},
 			program: "1001 0001\n0000 1111", // memory at 1 is 15, register at 1 is 3
 			evaluator: func(t *testing.T, machine *Apache8bits, _ *os.File, _ bytes.Buffer) {
-				assert.Equal(t, uint8(3), machine.MEMORY.Get(uint8(1)))
+				val, err := machine.MEMORY.Get(uint8(1))
+				assert.NoError(t, err)
+				assert.Equal(t, uint8(3), val)
 			},
 		},
 		"JUMP R1 IF": { // Jump to line ADDRESS if register 1 is equal to 0
@@ -151,14 +157,17 @@ func Test_Apache8bits(t *testing.T) {
 			init:    func(machine *Apache8bits) {},
 			program: "1111 0010\n",
 			evaluator: func(t *testing.T, machine *Apache8bits, in *os.File, _ bytes.Buffer) {
-				assert.Equal(t, uint8(100), machine.MEMORY.Get(uint8(2)))
+				val, err := machine.MEMORY.Get(uint8(2))
+				assert.NoError(t, err)
+				assert.Equal(t, uint8(100), val)
 			},
 		},
 	}
 
 	for name, testCase := range testCases {
 		t.Run(name, func(t *testing.T) {
-			memory.LoadProgram(testCase.program)
+			err := memory.LoadProgram(testCase.program)
+			assert.NoError(t, err)
 
 			in, err := utils.NewTestInput("100\n")
 			if err != nil {
@@ -168,14 +177,180 @@ func Test_Apache8bits(t *testing.T) {
 
 			out := utils.NewTestOutput()
 
-			machine := NewApache8bits(memory, in, &out)
-			assert.NotNil(t, machine)
+			machine, err := NewApache8bits(memory, in, &out)
+			assert.NoError(t, err)
 
 			testCase.init(machine)
 
-			machine.Run(1)
+			err = machine.Run(1)
+			assert.NoError(t, err)
 
 			testCase.evaluator(t, machine, in, out)
 		})
 	}
 }
+
+type oversizedMemory struct {
+	*extras.Memory16x8bits
+}
+
+func (oversizedMemory) Size() uint8 {
+	return 0b10001
+}
+
+func Test_Apache8bits_Input(t *testing.T) {
+	// IN reads the next number separated by spaces or newlines, Fscanf read a
+	// file that way too but failed on the newline left by a reader that can unread
+	file, err := utils.NewTestInput("9 4\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	testCases := map[string]io.Reader{
+		"file":   file,
+		"reader": strings.NewReader("9\n4\n"),
+	}
+
+	for name, in := range testCases {
+		memory := extras.NewMemory16x8bits()
+		// IN 14, IN 15, STOP
+		assert.NoError(t, memory.Set(0, 0b1111_1110))
+		assert.NoError(t, memory.Set(1, 0b1111_1111))
+		assert.NoError(t, memory.Set(2, 0b0111_0000))
+
+		out := utils.NewTestOutput()
+		machine, err := NewApache8bits(memory, in, &out)
+		assert.NoError(t, err, name)
+		assert.NoError(t, machine.Run(99), name)
+		assert.Equal(t, []uint8{9, 4}, machine.MEMORY.Snapshot()[14:], name)
+	}
+}
+
+func Test_Apache8bits_Errors(t *testing.T) {
+	_, err := NewApache8bits(oversizedMemory{extras.NewMemory16x8bits()}, nil, nil)
+	var configErr *ConfigError
+	assert.ErrorAs(t, err, &configErr)
+
+	testCases := map[string]struct {
+		program, input string
+		target         interface{}
+	}{
+		"memory fault": {
+			program: "0000 1111\n", // LOAD R0 15, memory has 3 spaces
+			target:  new(*extras.MemoryFaultError),
+		},
+		"bad input": {
+			program: "1111 0010\n",
+			input:   "abc\n",
+			target:  new(*utils.InputError),
+		},
+		"missing input": {
+			program: "1111 0010\n",
+			target:  new(*utils.InputError),
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			memory := extras.NewMemory3x8bits()
+			err := memory.LoadProgram(testCase.program)
+			assert.NoError(t, err)
+
+			in, err := utils.NewTestInput(testCase.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			out := utils.NewTestOutput()
+
+			machine, err := NewApache8bits(memory, in, &out)
+			assert.NoError(t, err)
+
+			err = machine.Run(999)
+			assert.ErrorAs(t, err, testCase.target)
+			assert.False(t, machine.Halted())
+		})
+	}
+}
+
+func benchmarkApache8bits(b *testing.B) *Apache8bits {
+	memory := extras.NewMemory16x8bits()
+	// LOAD R0 15, ADD R0 14, STORE R0 15, NOT R1, JUMP 0, ..., data 1, data 0
+	program := []uint8{0b0000_1111, 0b0011_1110, 0b0001_1111, 0b1101_0000, 0b0110_0000}
+	for idx, word := range program {
+		if err := memory.Set(uint8(idx), word); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := memory.Set(uint8(14), uint8(1)); err != nil {
+		b.Fatal(err)
+	}
+
+	machine, err := NewApache8bits(memory, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return machine
+}
+
+func Benchmark_Apache8bits_Run(b *testing.B) {
+	benchmarkRun(b, benchmarkApache8bits(b))
+}
+
+// Benchmark_Apache8bits_Run_Fetching fetches and decodes every instruction, as
+// the machine does with a cache in front of the memory
+func Benchmark_Apache8bits_Run_Fetching(b *testing.B) {
+	machine := benchmarkApache8bits(b)
+	machine.decoded = nil
+	benchmarkRun(b, machine)
+}
+
+// Benchmark_Apache8bits_Run_MapDispatch is the baseline the arrays replaced,
+// the Run loop as it was with INSTRUCTIONS a map[uint8]func(uint8) error
+func Benchmark_Apache8bits_Run_MapDispatch(b *testing.B) {
+	machine := benchmarkApache8bits(b)
+	instructions := map[uint8]func(uint8) error{}
+	for opcode, instruction := range machine.INSTRUCTIONS {
+		instructions[uint8(opcode)] = instruction
+	}
+	benchmarkLoop(b, machine, func(cycles int) error {
+		for machine.STOP == 0b0 && cycles > 0 {
+			cir, err := machine.MEMORY.Get(machine.PC)
+			if err != nil {
+				return err
+			}
+			machine.CIR = cir
+			machine.PC++
+			opcode := cir >> 4
+			if err := instructions[opcode](cir & 0b1111); err != nil {
+				return err
+			}
+			cost := machine.costs[opcode]
+			if latent, ok := machine.MEMORY.(extras.Latent); ok {
+				cost += latent.Latency()
+			}
+			machine.instructions++
+			machine.cycles += cost
+			cycles -= cost
+		}
+		return nil
+	})
+}
+
+func Fuzz_Apache8bits_Run(f *testing.F) {
+	addImageSeeds(f, "../programs/[a-z]*[a-z].txt", func(content []byte) ([]byte, error) {
+		memory := extras.NewMemory16x8bits()
+		err := memory.ReadProgram(bytes.NewReader(content))
+		return memory.Snapshot(), err
+	})
+
+	f.Fuzz(func(t *testing.T, image []byte, input string) {
+		words := make([]uint16, 0, 16)
+		for idx := 0; idx < len(image) && idx < 16; idx++ {
+			words = append(words, uint16(image[idx]))
+		}
+		fuzzRun(t, apache8bitsName, words, input, 1000)
+	})
+}
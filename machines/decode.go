@@ -0,0 +1,37 @@
+package machines
+
+// decoded is a fetched word split into its fields, machines keep one per
+// address so a loop is fetched from memory and decoded only once
+type decoded struct {
+	valid    bool
+	cir      uint16
+	opcode   uint8
+	register uint8
+	operand  uint16
+}
+
+// predecoded holds the decoded words of a memory by address, every write to
+// the memory has to invalidate its address, a nil predecoded turns it off
+// for memories that have to see every fetch
+type predecoded []decoded
+
+// get returns the word decoded at idx, ok is false when it was never decoded
+// or was written since
+func (p predecoded) get(idx int) (word decoded, ok bool) {
+	if idx < len(p) && p[idx].valid {
+		return p[idx], true
+	}
+	return decoded{}, false
+}
+
+func (p predecoded) put(idx int, word decoded) {
+	if idx < len(p) {
+		p[idx] = word
+	}
+}
+
+func (p predecoded) invalidate(idx int) {
+	if idx < len(p) {
+		p[idx].valid = false
+	}
+}
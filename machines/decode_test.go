@@ -0,0 +1,62 @@
+package machines
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/utils"
+)
+
+func Test_Machine_SelfModifyingCode(t *testing.T) {
+	testCases := map[string][]uint16{
+		// OUT R0, LOAD R0 14, STORE R0 0, JUMP 0, ..., data STOP
+		apache8bitsName:  {0b1110_0000, 0b0000_1110, 0b0001_0000, 0b0110_0000, 14: 0b0111_0000},
+		apache16bitsName: {0b1110_00_0000000000, 0b0000_00_0000001110, 0b0001_00_0000000000, 0b1010_00_0000000000, 14: 0b1101_00_0000000000},
+	}
+
+	for name, program := range testCases {
+		for _, slow := range []bool{false, true} {
+			out := utils.NewTestOutput()
+			machine, err := New(name, strings.NewReader(""), &out)
+			assert.NoError(t, err)
+			assert.NoError(t, LoadWords(machine, program))
+			if slow {
+				machine.SetHistory(NewHistory(0))
+			}
+
+			// the OUT at 0 ran and was decoded, the STORE turns it into STOP
+			assert.NoError(t, machine.Run(99), name)
+			assert.True(t, machine.Halted(), name)
+			assert.Equal(t, 5, machine.Instructions(), name)
+			assert.Equal(t, "0\n", utils.ClearOutputForTesting(out.String()), name)
+
+			// so do writes from outside, as a debugger patching code
+			assert.NoError(t, machine.WriteMemory(0, program[3]), name)
+			machine.SetHalted(false)
+			machine.SetProgramCounter(0)
+			result, err := machine.Step()
+			assert.NoError(t, err, name)
+			assert.Equal(t, program[3], result.CIR, name)
+		}
+	}
+}
+
+// benchmarkRun runs b.N cycles of a program that never halts and reports the
+// instructions executed per second
+func benchmarkRun(b *testing.B, machine Machine) {
+	benchmarkLoop(b, machine, machine.Run)
+}
+
+// benchmarkLoop is benchmarkRun for a run loop other than Run, as the map
+// dispatch the machines had before the arrays
+func benchmarkLoop(b *testing.B, machine Machine, run func(cycles int) error) {
+	b.ResetTimer()
+	start := time.Now()
+	if err := run(b.N); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(machine.Instructions())/time.Since(start).Seconds(), "instructions/s")
+}
@@ -0,0 +1,62 @@
+package machines
+
+import "fmt"
+
+// ConfigError is returned when a machine can not be built with the given parts
+type ConfigError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid machine configuration: %s: %v", e.Reason, e.Err)
+	}
+	return fmt.Sprintf("invalid machine configuration: %s", e.Reason)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// BreakError is returned by Run when a Watch paused the program, the machine
+// can be resumed with another Run
+type BreakError struct {
+	PC     uint16 // address of the next instruction
+	Reason string
+}
+
+func (e *BreakError) Error() string {
+	return fmt.Sprintf("paused at %d: %s", e.PC, e.Reason)
+}
+
+// SnapshotError is returned when a snapshot can not be read or does not fit the
+// machine it is restored on
+type SnapshotError struct {
+	Reason string
+	Err    error
+}
+
+func (e *SnapshotError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid snapshot: %s: %v", e.Reason, e.Err)
+	}
+	return fmt.Sprintf("invalid snapshot: %s", e.Reason)
+}
+
+func (e *SnapshotError) Unwrap() error {
+	return e.Err
+}
+
+// ExecutionError is returned when an instruction can not run on the operands
+// it was given, such as a DIV by a word holding 0
+type ExecutionError struct {
+	PC      uint16 // address of the instruction
+	Address uint16 // memory word it read
+	Value   uint16 // what the word held
+	Reason  string
+}
+
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("instruction at %d: %s, address: %d, value: %d", e.PC, e.Reason, e.Address, e.Value)
+}
@@ -0,0 +1,101 @@
+package machines
+
+import "errors"
+
+// ErrNoHistory is returned by History.Back when there is nothing left to undo
+var ErrNoHistory = errors.New("no recorded instruction to step back over")
+
+// Undo is what a single instruction changed, the step result already holds the
+// PC, registers and memory words it replaced, CIR, Halted and the clock are
+// the values they had before the instruction
+type Undo struct {
+	Result       StepResult
+	CIR          uint16
+	Halted       bool
+	Cycles       int
+	Instructions int
+}
+
+// History is an undo log with an entry per executed instruction, set it on a
+// machine to step back through what Step and Run did
+//
+// Input already read by IN is not given back and output stays written, edits
+// made through the setters are not recorded
+type History struct {
+	Limit   int // entries kept, the oldest are dropped past it, 0 keeps everything
+	undos   []Undo
+	dropped int
+}
+
+func NewHistory(limit int) *History {
+	return &History{Limit: limit}
+}
+
+// Instruction counts the instructions executed since the history was set,
+// stepping back lowers it
+func (h *History) Instruction() int {
+	return h.dropped + len(h.undos)
+}
+
+// Oldest is the first instruction still recorded, Back can not go further
+func (h *History) Oldest() int {
+	return h.dropped
+}
+
+// Last returns the most recent entry, the one Back would undo
+func (h *History) Last() (Undo, bool) {
+	if len(h.undos) == 0 {
+		return Undo{}, false
+	}
+	return h.undos[len(h.undos)-1], true
+}
+
+func (h *History) record(undo Undo) {
+	if h.Limit > 0 && len(h.undos) >= h.Limit {
+		// drop a chunk at once so long runs do not copy on every instruction
+		drop := len(h.undos) - h.Limit + 1 + h.Limit/4
+		if drop > len(h.undos) {
+			drop = len(h.undos)
+		}
+		h.undos = append(h.undos[:0], h.undos[drop:]...)
+		h.dropped += drop
+	}
+	h.undos = append(h.undos, undo)
+}
+
+// Back undoes the last recorded instruction on machine and returns what that
+// instruction had done
+func (h *History) Back(machine Machine) (StepResult, error) {
+	undo, ok := h.Last()
+	if !ok {
+		return StepResult{}, ErrNoHistory
+	}
+	result := undo.Result
+	for idx := len(result.Writes) - 1; idx >= 0; idx-- {
+		write := result.Writes[idx]
+		if err := machine.WriteMemory(write.Address, write.Previous); err != nil {
+			return StepResult{}, err
+		}
+	}
+	for idx, val := range result.RegistersBefore {
+		if err := machine.SetRegister(idx, val); err != nil {
+			return StepResult{}, err
+		}
+	}
+	if err := machine.SetProgramCounter(result.PCBefore); err != nil {
+		return StepResult{}, err
+	}
+	if err := machine.SetInstructionRegister(undo.CIR); err != nil {
+		return StepResult{}, err
+	}
+	machine.SetHalted(undo.Halted)
+	machine.SetClock(undo.Cycles, undo.Instructions)
+	h.undos = h.undos[:len(h.undos)-1]
+	return result, nil
+}
+
+// Clear forgets every entry and starts counting instructions from 0 again
+func (h *History) Clear() {
+	h.undos = nil
+	h.dropped = 0
+}
@@ -0,0 +1,123 @@
+package machines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/utils"
+)
+
+type state struct {
+	registers []uint16
+	pc, cir   uint16
+	halted    bool
+	memory    []uint16
+}
+
+func snapshot(t *testing.T, machine Machine) state {
+	s := state{registers: machine.Registers(), pc: machine.ProgramCounter(), cir: machine.InstructionRegister(), halted: machine.Halted()}
+	for idx := uint16(0); idx < machine.MemorySize(); idx++ {
+		val, err := machine.ReadMemory(idx)
+		assert.NoError(t, err)
+		s.memory = append(s.memory, val)
+	}
+	return s
+}
+
+func Test_History(t *testing.T) {
+	out := utils.NewTestOutput()
+	machine, err := New("apache8", nil, &out)
+	assert.NoError(t, err)
+	// LOAD R0 5, ADD R0 5, STORE R0 5, JUMP R0 IF 6, JUMP 1, data 1, STOP
+	assert.NoError(t, LoadWords(machine, []uint16{0b00000101, 0b00110101, 0b00010101, 0b00100110, 0b01100001, 0b00000001, 0b01110000}))
+
+	history := NewHistory(0)
+	machine.SetHistory(history)
+	_, err = history.Back(machine)
+	assert.ErrorIs(t, err, ErrNoHistory)
+
+	// mem[5] doubles until it wraps to 0, then the program halts
+	states := []state{snapshot(t, machine)}
+	for !machine.Halted() {
+		_, err := machine.Step()
+		assert.NoError(t, err)
+		states = append(states, snapshot(t, machine))
+	}
+	assert.Equal(t, len(states)-1, history.Instruction())
+
+	for cycle := len(states) - 2; cycle >= 0; cycle-- {
+		_, err := history.Back(machine)
+		assert.NoError(t, err)
+		assert.Equal(t, states[cycle], snapshot(t, machine), "cycle %d", cycle)
+		assert.Equal(t, cycle, history.Instruction())
+	}
+
+	// Run records as Step does, going back and forth replays the same states
+	assert.NoError(t, machine.Run(10))
+	assert.Equal(t, states[10], snapshot(t, machine))
+	result, err := history.Back(machine)
+	assert.NoError(t, err)
+	assert.Equal(t, states[9].pc, result.PCBefore)
+	assert.Equal(t, states[9], snapshot(t, machine))
+
+	machine.SetHistory(nil)
+	assert.NoError(t, machine.Run(1))
+	assert.Equal(t, 9, history.Instruction())
+}
+
+func Test_History_Limit(t *testing.T) {
+	out := utils.NewTestOutput()
+	machine, err := New("apache8", nil, &out)
+	assert.NoError(t, err)
+	// JUMP 0
+	assert.NoError(t, machine.WriteMemory(0, 0b01100000))
+
+	history := NewHistory(8)
+	machine.SetHistory(history)
+	assert.NoError(t, machine.Run(100))
+	assert.Equal(t, 100, history.Instruction())
+	assert.LessOrEqual(t, 100-history.Oldest(), 8)
+
+	for history.Instruction() > history.Oldest() {
+		_, err := history.Back(machine)
+		assert.NoError(t, err)
+	}
+	_, err = history.Back(machine)
+	assert.ErrorIs(t, err, ErrNoHistory)
+
+	history.Clear()
+	assert.Equal(t, 0, history.Instruction())
+}
+
+func Test_History_Clock(t *testing.T) {
+	out := utils.NewTestOutput()
+	machine, err := New("apache8", nil, &out)
+	assert.NoError(t, err)
+	// LOAD R0 5, ADD R0 5, NOT R1, ..., data 1
+	assert.NoError(t, LoadWords(machine, []uint16{0b00000101, 0b00110101, 0b11010000, 5: 0b00000001}))
+	assert.NoError(t, machine.SetTiming(ClassicTiming))
+	history := NewHistory(0)
+	machine.SetHistory(history)
+
+	cycles := []int{machine.Cycles()}
+	for idx := 0; idx < 3; idx++ {
+		_, err := machine.Step()
+		assert.NoError(t, err)
+		cycles = append(cycles, machine.Cycles())
+	}
+	assert.Equal(t, []int{0, 4, 9, 12}, cycles)
+
+	// stepping back puts the clock back too
+	for idx := 2; idx >= 0; idx-- {
+		_, err := history.Back(machine)
+		assert.NoError(t, err)
+		assert.Equal(t, cycles[idx], machine.Cycles())
+		assert.Equal(t, idx, machine.Instructions())
+	}
+
+	// so a budget given after going back runs what it ran the first time
+	assert.NoError(t, machine.Run(9))
+	assert.Equal(t, 2, machine.Instructions())
+	assert.Equal(t, 9, machine.Cycles())
+}
@@ -0,0 +1,56 @@
+package machines
+
+import (
+	"fmt"
+
+	"apache-instruction-set-simulator/extras"
+)
+
+// Machine is the behaviour shared by every Apache simulator, registers, PC and
+// memory are widened to uint16 so callers do not need to know the word size
+type Machine interface {
+	LoadProgram(programName string) error
+	Run(cycles int) error
+	Step() (StepResult, error)
+	SetWatch(watch Watch)
+	SetHistory(history *History)
+	SetTiming(timing *Timing) error
+	Timing() *Timing
+	Cycles() int
+	Instructions() int
+	SetClock(cycles int, instructions int)
+	SetCache(config *extras.CacheConfig) error
+	CacheStats() *extras.CacheStats
+	Reset()
+	Halted() bool
+	Registers() []uint16
+	SetRegister(idx int, val uint16) error
+	ProgramCounter() uint16
+	SetProgramCounter(pc uint16) error
+	InstructionRegister() uint16
+	SetInstructionRegister(cir uint16) error
+	SetHalted(halted bool)
+	MemorySize() uint16
+	ReadMemory(idx uint16) (uint16, error)
+	WriteMemory(idx uint16, val uint16) error
+	Snapshot() Snapshot
+	Restore(snapshot Snapshot) error
+}
+
+// LoadWords writes an assembled program into the memory of machine from address 0
+func LoadWords(machine Machine, words []uint16) error {
+	for idx, word := range words {
+		if err := machine.WriteMemory(uint16(idx), word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fitsUint8 checks a widened value can be written to an 8 bits register or word
+func fitsUint8(val uint16) error {
+	if val > 0xFF {
+		return fmt.Errorf("value %d does not fit in 8 bits", val)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package machines
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fuzzInputs are the inputs every program seed is paired with
+var fuzzInputs = []string{"", "9\n4\n", "3 4\n", "abc\n"}
+
+// addImageSeeds seeds a fuzz target with the programs matching pattern, each
+// one turned into an image by read and paired with every fuzzInputs
+func addImageSeeds(f *testing.F, pattern string, read func(content []byte) ([]byte, error)) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		image, err := read(content)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, input := range fuzzInputs {
+			f.Add(image, input)
+		}
+	}
+}
+
+// fuzzRun writes an image into two fresh machines and runs both on the same
+// input, neither may panic or leave the PC past the end of memory, and both
+// have to end the same way
+func fuzzRun(t *testing.T, name string, words []uint16, input string, cycles int) {
+	run := func() (string, string, Snapshot) {
+		var out bytes.Buffer
+		machine, err := New(name, strings.NewReader(input), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadWords(machine, words); err != nil {
+			t.Fatal(err)
+		}
+
+		err = machine.Run(cycles)
+		assert.LessOrEqual(t, machine.ProgramCounter(), machine.MemorySize())
+		return fmt.Sprint(err), out.String(), machine.Snapshot()
+	}
+
+	err, out, snapshot := run()
+	otherErr, otherOut, otherSnapshot := run()
+	assert.Equal(t, err, otherErr)
+	assert.Equal(t, out, otherOut)
+	assert.Equal(t, snapshot, otherSnapshot)
+}
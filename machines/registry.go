@@ -0,0 +1,40 @@
+package machines
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Factory builds a machine wired to its default memory device
+type Factory func(in io.Reader, out io.Writer) (Machine, error)
+
+var registry = map[string]Factory{}
+
+// Register makes a machine available by name, it panics if the name is taken
+func Register(name string, factory Factory) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("machine already registered: %s", name))
+	}
+	registry[name] = factory
+}
+
+// New builds the machine registered under name
+func New(name string, in io.Reader, out io.Writer) (Machine, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown machine: %s, available: %s", name, strings.Join(Names(), ", "))
+	}
+	return factory(in, out)
+}
+
+// Names returns the registered machine names in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
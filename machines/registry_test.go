@@ -0,0 +1,99 @@
+package machines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/utils"
+)
+
+func Test_Registry(t *testing.T) {
+	assert.Equal(t, []string{"apache16", "apache8"}, Names())
+
+	_, err := New("apache32", nil, nil)
+	assert.Error(t, err)
+
+	machine, err := New("apache16", nil, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &Apache16bits{}, machine)
+	assert.Equal(t, uint16(1024), machine.MemorySize())
+}
+
+func Test_Machine_Apache8bits(t *testing.T) {
+	memory := extras.NewMemory3x8bits()
+	err := memory.LoadProgram("0000 0010\n0111 0000\n0000 1010") // LOAD R0 2, STOP, data 10
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := NewApache8bits(memory, nil, &out)
+	assert.NoError(t, err)
+	var _ Machine = machine
+	assert.Equal(t, uint16(3), machine.MemorySize())
+
+	_, err = machine.Step()
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{10, 0}, machine.Registers())
+	assert.Equal(t, uint16(1), machine.ProgramCounter())
+	assert.Equal(t, uint16(0b00000010), machine.InstructionRegister())
+	assert.False(t, machine.Halted())
+
+	assert.NoError(t, machine.Run(999))
+	assert.True(t, machine.Halted())
+	assert.Equal(t, uint16(2), machine.ProgramCounter())
+	val, err := machine.ReadMemory(2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(10), val)
+
+	machine.Reset()
+	assert.False(t, machine.Halted())
+	assert.Equal(t, []uint16{0, 0}, machine.Registers())
+	assert.Equal(t, uint16(0), machine.ProgramCounter())
+	val, err = machine.ReadMemory(2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(10), val)
+
+	_, err = machine.ReadMemory(3)
+	var fault *extras.MemoryFaultError
+	assert.ErrorAs(t, err, &fault)
+}
+
+func Test_Machine_Setters(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			machine, err := New(name, nil, nil)
+			assert.NoError(t, err)
+
+			assert.NoError(t, machine.SetRegister(1, 200))
+			assert.Equal(t, uint16(200), machine.Registers()[1])
+			assert.Error(t, machine.SetRegister(len(machine.Registers()), 1))
+
+			assert.NoError(t, machine.SetProgramCounter(3))
+			assert.Equal(t, uint16(3), machine.ProgramCounter())
+
+			assert.NoError(t, machine.SetInstructionRegister(0b01110000))
+			assert.Equal(t, uint16(0b01110000), machine.InstructionRegister())
+
+			machine.SetHalted(true)
+			assert.True(t, machine.Halted())
+			machine.SetHalted(false)
+			assert.False(t, machine.Halted())
+
+			assert.NoError(t, machine.WriteMemory(machine.MemorySize()-1, 7))
+			val, err := machine.ReadMemory(machine.MemorySize() - 1)
+			assert.NoError(t, err)
+			assert.Equal(t, uint16(7), val)
+
+			var fault *extras.MemoryFaultError
+			assert.ErrorAs(t, machine.WriteMemory(machine.MemorySize(), 7), &fault)
+		})
+	}
+
+	machine, err := New("apache8", nil, nil)
+	assert.NoError(t, err)
+	assert.Error(t, machine.SetRegister(0, 256))
+	assert.Error(t, machine.SetProgramCounter(256))
+	assert.Error(t, machine.WriteMemory(0, 256))
+	assert.Error(t, machine.SetInstructionRegister(256))
+}
@@ -0,0 +1,209 @@
+package machines
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SnapshotVersion is written in every snapshot, it goes up whenever the
+// layout changes so older files are refused instead of misread
+const SnapshotVersion = 1
+
+// snapshotMagic opens binary snapshots, JSON ones open with '{'
+const snapshotMagic = "AISS"
+
+// Snapshot is everything needed to resume a machine, registers, PC and memory
+// are widened to uint16 as in Machine, the watch and the history are left out
+type Snapshot struct {
+	Version   int      `json:"version"`
+	Machine   string   `json:"machine"` // name the machine is registered under
+	Registers []uint16 `json:"registers"`
+	PC        uint16   `json:"pc"`
+	CIR       uint16   `json:"cir"`
+	Halted    bool     `json:"halted"`
+	Memory    []uint16 `json:"memory"`
+}
+
+// check tells whether the snapshot fits the machine it is restored on
+func (s Snapshot) check(machine string, registers int, memorySize int) error {
+	switch {
+	case s.Version != SnapshotVersion:
+		return &SnapshotError{Reason: fmt.Sprintf("unsupported version %d, expected %d", s.Version, SnapshotVersion)}
+	case s.Machine != machine:
+		return &SnapshotError{Reason: fmt.Sprintf("taken on %s, not %s", s.Machine, machine)}
+	case len(s.Registers) != registers:
+		return &SnapshotError{Reason: fmt.Sprintf("%d registers, %s has %d", len(s.Registers), machine, registers)}
+	case len(s.Memory) != memorySize:
+		return &SnapshotError{Reason: fmt.Sprintf("%d memory words, %s has %d", len(s.Memory), machine, memorySize)}
+	}
+	return nil
+}
+
+// SnapshotFormat picks how a snapshot is written, ReadSnapshot tells them apart
+// on its own
+type SnapshotFormat int
+
+const (
+	SnapshotJSON   SnapshotFormat = iota // readable and diffable
+	SnapshotBinary                       // compact, one byte per word on 8 bits machines
+)
+
+var snapshotFormats = []string{"json", "binary"}
+
+func (f SnapshotFormat) String() string {
+	return snapshotFormats[f]
+}
+
+// ParseSnapshotFormat reads the names printed by SnapshotFormat.String
+func ParseSnapshotFormat(name string) (SnapshotFormat, error) {
+	for idx, format := range snapshotFormats {
+		if format == name {
+			return SnapshotFormat(idx), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown snapshot format %q, use %s", name, strings.Join(snapshotFormats, " or "))
+}
+
+// Write encodes the snapshot in format
+//
+// The binary layout is little endian: "AISS", version (1 byte), machine name
+// length (1 byte) and name, word size in bytes (1 byte), halted (1 byte),
+// register count (1 byte), the registers, PC and CIR as words, memory word
+// count (2 bytes) and the memory words
+func (s Snapshot) Write(w io.Writer, format SnapshotFormat) error {
+	if format == SnapshotJSON {
+		return json.NewEncoder(w).Encode(s)
+	}
+	wordBytes := s.wordBytes()
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	buf.WriteByte(uint8(s.Version))
+	buf.WriteByte(uint8(len(s.Machine)))
+	buf.WriteString(s.Machine)
+	buf.WriteByte(uint8(wordBytes))
+	if s.Halted {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	buf.WriteByte(uint8(len(s.Registers)))
+	write := func(words ...uint16) {
+		for _, word := range words {
+			if wordBytes == 1 {
+				buf.WriteByte(uint8(word))
+			} else {
+				binary.Write(&buf, binary.LittleEndian, word)
+			}
+		}
+	}
+	write(s.Registers...)
+	write(s.PC, s.CIR)
+	binary.Write(&buf, binary.LittleEndian, uint16(len(s.Memory)))
+	write(s.Memory...)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// wordBytes is 1 when every value fits in a byte
+func (s Snapshot) wordBytes() int {
+	for _, words := range [][]uint16{s.Registers, {s.PC, s.CIR}, s.Memory} {
+		for _, word := range words {
+			if word > 0xFF {
+				return 2
+			}
+		}
+	}
+	return 1
+}
+
+// ReadSnapshot decodes a snapshot in either format
+func ReadSnapshot(r io.Reader) (Snapshot, error) {
+	in := bufio.NewReader(r)
+	first, err := in.Peek(1)
+	if err != nil {
+		return Snapshot{}, &SnapshotError{Reason: "empty file", Err: err}
+	}
+	var s Snapshot
+	if first[0] == '{' {
+		if err := json.NewDecoder(in).Decode(&s); err != nil {
+			return Snapshot{}, &SnapshotError{Reason: "malformed JSON", Err: err}
+		}
+		return s, nil
+	}
+	if err := readBinarySnapshot(in, &s); err != nil {
+		return Snapshot{}, &SnapshotError{Reason: "malformed binary", Err: err}
+	}
+	return s, nil
+}
+
+func readBinarySnapshot(in *bufio.Reader, s *Snapshot) error {
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(in, magic); err != nil {
+		return err
+	}
+	if string(magic) != snapshotMagic {
+		return fmt.Errorf("does not start with %q", snapshotMagic)
+	}
+	var header struct {
+		Version, NameLength uint8
+	}
+	if err := binary.Read(in, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	name := make([]byte, header.NameLength)
+	if _, err := io.ReadFull(in, name); err != nil {
+		return err
+	}
+	var layout struct {
+		WordBytes, Halted, Registers uint8
+	}
+	if err := binary.Read(in, binary.LittleEndian, &layout); err != nil {
+		return err
+	}
+	if layout.WordBytes != 1 && layout.WordBytes != 2 {
+		return fmt.Errorf("word size %d, expected 1 or 2", layout.WordBytes)
+	}
+	word := func() (uint16, error) {
+		if layout.WordBytes == 1 {
+			val, err := in.ReadByte()
+			return uint16(val), err
+		}
+		var val uint16
+		err := binary.Read(in, binary.LittleEndian, &val)
+		return val, err
+	}
+	s.Version, s.Machine, s.Halted = int(header.Version), string(name), layout.Halted != 0
+	s.Registers = make([]uint16, layout.Registers)
+	for idx := range s.Registers {
+		val, err := word()
+		if err != nil {
+			return err
+		}
+		s.Registers[idx] = val
+	}
+	var err error
+	if s.PC, err = word(); err != nil {
+		return err
+	}
+	if s.CIR, err = word(); err != nil {
+		return err
+	}
+	var size uint16
+	if err := binary.Read(in, binary.LittleEndian, &size); err != nil {
+		return err
+	}
+	s.Memory = make([]uint16, size)
+	for idx := range s.Memory {
+		val, err := word()
+		if err != nil {
+			return err
+		}
+		s.Memory[idx] = val
+	}
+	return nil
+}
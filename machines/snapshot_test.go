@@ -0,0 +1,114 @@
+package machines
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/utils"
+)
+
+func Test_Snapshot_Round_Trip(t *testing.T) {
+	// LOAD R0 5, ADD R0 5, STORE R0 5, JUMP R0 IF 6, JUMP 1, data 1, STOP
+	program := []uint16{0b00000101, 0b00110101, 0b00010101, 0b00100110, 0b01100001, 0b00000001, 0b01110000}
+
+	for _, format := range []SnapshotFormat{SnapshotJSON, SnapshotBinary} {
+		t.Run(format.String(), func(t *testing.T) {
+			out := utils.NewTestOutput()
+			machine, err := New("apache8", nil, &out)
+			assert.NoError(t, err)
+			assert.NoError(t, LoadWords(machine, program))
+			assert.NoError(t, machine.Run(12))
+
+			var buf bytes.Buffer
+			assert.NoError(t, machine.Snapshot().Write(&buf, format))
+			snapshot, err := ReadSnapshot(&buf)
+			assert.NoError(t, err)
+			assert.Equal(t, machine.Snapshot(), snapshot)
+
+			restored, err := New("apache8", nil, &out)
+			assert.NoError(t, err)
+			assert.NoError(t, restored.Restore(snapshot))
+
+			assert.NoError(t, machine.Run(999))
+			assert.NoError(t, restored.Run(999))
+			assert.True(t, restored.Halted())
+			assert.Equal(t, machine.Snapshot(), restored.Snapshot())
+		})
+	}
+}
+
+func Test_Snapshot_Binary(t *testing.T) {
+	out := utils.NewTestOutput()
+	machine, err := New("apache16", nil, &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machine.WriteMemory(1023, 300))
+	assert.NoError(t, machine.SetRegister(3, 1000))
+	machine.SetHalted(true)
+
+	var buf bytes.Buffer
+	assert.NoError(t, machine.Snapshot().Write(&buf, SnapshotBinary))
+	// magic, version, name, word size, halted, register count, 4 registers,
+	// PC, CIR, memory size and 1024 words of 2 bytes
+	assert.Equal(t, 4+1+1+8+1+1+1+4*2+2*2+2+1024*2, buf.Len())
+
+	snapshot, err := ReadSnapshot(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, machine.Snapshot(), snapshot)
+
+	var small bytes.Buffer
+	eight, err := New("apache8", nil, &out)
+	assert.NoError(t, err)
+	assert.NoError(t, eight.Snapshot().Write(&small, SnapshotBinary))
+	assert.Equal(t, 4+1+1+7+1+1+1+2+2+2+16, small.Len())
+}
+
+func Test_Snapshot_Errors(t *testing.T) {
+	out := utils.NewTestOutput()
+	eight, err := New("apache8", nil, &out)
+	assert.NoError(t, err)
+	sixteen, err := New("apache16", nil, &out)
+	assert.NoError(t, err)
+
+	newer := eight.Snapshot()
+	newer.Version = 2
+
+	wide := sixteen.Snapshot()
+	wide.Machine = "apache8"
+	wide.Registers = wide.Registers[:2]
+	wide.Memory = wide.Memory[:16]
+	wide.Memory[3] = 300
+
+	testCases := map[string]struct {
+		machine  Machine
+		snapshot Snapshot
+		err      string
+	}{
+		"version":   {machine: eight, snapshot: newer, err: "invalid snapshot: unsupported version 2, expected 1"},
+		"machine":   {machine: eight, snapshot: sixteen.Snapshot(), err: "invalid snapshot: taken on apache16, not apache8"},
+		"too wide":  {machine: eight, snapshot: wide, err: "invalid snapshot: not taken on an 8 bits machine: value 300 does not fit in 8 bits"},
+		"registers": {machine: sixteen, snapshot: Snapshot{Version: SnapshotVersion, Machine: "apache16"}, err: "invalid snapshot: 0 registers, apache16 has 4"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			before := tc.machine.Snapshot()
+			var snapshotErr *SnapshotError
+			err := tc.machine.Restore(tc.snapshot)
+			assert.ErrorAs(t, err, &snapshotErr)
+			assert.EqualError(t, err, tc.err)
+			assert.Equal(t, before, tc.machine.Snapshot())
+		})
+	}
+
+	_, err = ReadSnapshot(strings.NewReader(""))
+	assert.ErrorContains(t, err, "invalid snapshot: empty file")
+	_, err = ReadSnapshot(strings.NewReader("{\"version\": "))
+	assert.ErrorContains(t, err, "invalid snapshot: malformed JSON")
+	_, err = ReadSnapshot(strings.NewReader("AISS\x01\x07apache8\x03"))
+	assert.ErrorContains(t, err, "invalid snapshot: malformed binary")
+	_, err = ParseSnapshotFormat("xml")
+	assert.EqualError(t, err, `unknown snapshot format "xml", use json or binary`)
+}
@@ -0,0 +1,45 @@
+package machines
+
+// MemoryAccess is a data read or write done by an instruction
+type MemoryAccess struct {
+	Address  uint16 `json:"address"`
+	Value    uint16 `json:"value"`
+	Previous uint16 `json:"previous"` // value held before a write, same as Value on reads
+}
+
+// StepResult describes what a single instruction did, the instruction fetch
+// itself is not listed in Reads
+type StepResult struct {
+	PCBefore        uint16
+	PCAfter         uint16
+	CIR             uint16
+	Opcode          uint8
+	Register        uint8 // register encoded in the instruction, always 0 on Apache8bits
+	Operand         uint16
+	RegistersBefore []uint16
+	RegistersAfter  []uint16
+	Reads           []MemoryAccess
+	Writes          []MemoryAccess
+	Halted          bool
+	Input           bool
+	Output          bool
+	Cycles          int   // clock cycles the instruction took under the machine timing
+	Fault           error // what stopped the instruction, Step returns it too
+}
+
+// Fetched tells whether the instruction was read from memory, a fault fetching
+// it leaves the PC where it was and CIR, Opcode and Operand empty
+func (r StepResult) Fetched() bool {
+	return r.Fault == nil || r.PCAfter != r.PCBefore
+}
+
+// ChangedRegisters returns the indexes of the registers the instruction modified
+func (r StepResult) ChangedRegisters() []int {
+	var changed []int
+	for idx := range r.RegistersAfter {
+		if idx >= len(r.RegistersBefore) || r.RegistersBefore[idx] != r.RegistersAfter[idx] {
+			changed = append(changed, idx)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,128 @@
+package machines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/utils"
+)
+
+func Test_Apache8bits_Step(t *testing.T) {
+	memory := extras.NewMemory16x8bits()
+	// IN 14, LOAD R0 14, ADD R0 15, STORE R0 15, OUT R0, JUMP R1 IF 7, NOT R1, STOP
+	program := []uint8{0b1111_1110, 0b0000_1110, 0b0011_1111, 0b0001_1111, 0b1110_0000, 0b1010_0111, 0b1101_0000, 0b0111_0000}
+	for idx, word := range program {
+		assert.NoError(t, memory.Set(uint8(idx), word))
+	}
+	assert.NoError(t, memory.Set(15, 5))
+
+	in, err := utils.NewTestInput("10\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	out := utils.NewTestOutput()
+
+	machine, err := NewApache8bits(memory, in, &out)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		expected StepResult
+	}{
+		{
+			name: "IN",
+			expected: StepResult{
+				PCBefore: 0, PCAfter: 1, CIR: 0b1111_1110, Opcode: 0b1111, Operand: 14,
+				RegistersBefore: []uint16{0, 0}, RegistersAfter: []uint16{0, 0}, Cycles: 1,
+				Writes: []MemoryAccess{{Address: 14, Value: 10, Previous: 0}},
+				Input:  true,
+			},
+		},
+		{
+			name: "LOAD R0",
+			expected: StepResult{
+				PCBefore: 1, PCAfter: 2, CIR: 0b0000_1110, Opcode: 0b0000, Operand: 14,
+				RegistersBefore: []uint16{0, 0}, RegistersAfter: []uint16{10, 0}, Cycles: 1,
+				Reads: []MemoryAccess{{Address: 14, Value: 10, Previous: 10}},
+			},
+		},
+		{
+			name: "ADD R0",
+			expected: StepResult{
+				PCBefore: 2, PCAfter: 3, CIR: 0b0011_1111, Opcode: 0b0011, Operand: 15,
+				RegistersBefore: []uint16{10, 0}, RegistersAfter: []uint16{15, 0}, Cycles: 1,
+				Reads: []MemoryAccess{{Address: 15, Value: 5, Previous: 5}},
+			},
+		},
+		{
+			name: "STORE R0",
+			expected: StepResult{
+				PCBefore: 3, PCAfter: 4, CIR: 0b0001_1111, Opcode: 0b0001, Operand: 15,
+				RegistersBefore: []uint16{15, 0}, RegistersAfter: []uint16{15, 0}, Cycles: 1,
+				Writes: []MemoryAccess{{Address: 15, Value: 15, Previous: 5}},
+			},
+		},
+		{
+			name: "OUT R0",
+			expected: StepResult{
+				PCBefore: 4, PCAfter: 5, CIR: 0b1110_0000, Opcode: 0b1110,
+				RegistersBefore: []uint16{15, 0}, RegistersAfter: []uint16{15, 0}, Cycles: 1,
+				Output: true,
+			},
+		},
+		{
+			name: "JUMP R1 IF",
+			expected: StepResult{
+				PCBefore: 5, PCAfter: 7, CIR: 0b1010_0111, Opcode: 0b1010, Operand: 7,
+				RegistersBefore: []uint16{15, 0}, RegistersAfter: []uint16{15, 0}, Cycles: 1,
+			},
+		},
+		{
+			name: "STOP",
+			expected: StepResult{
+				PCBefore: 7, PCAfter: 8, CIR: 0b0111_0000, Opcode: 0b0111,
+				RegistersBefore: []uint16{15, 0}, RegistersAfter: []uint16{15, 0}, Cycles: 1,
+				Halted: true,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		result, err := machine.Step()
+		assert.NoError(t, err, testCase.name)
+		assert.Equal(t, testCase.expected, result, testCase.name)
+	}
+
+	assert.Equal(t, "15\n", utils.ClearOutputForTesting(out.String()))
+}
+
+func Test_Apache16bits_Step(t *testing.T) {
+	memory := extras.NewMemory1024x16bits()
+	assert.NoError(t, memory.Set(0, 0b0011_10_1111111111)) // ADD R2 1023
+	assert.NoError(t, memory.Set(1023, 300))
+
+	machine, err := NewApache16bits(memory, nil, nil)
+	assert.NoError(t, err)
+	machine.REGISTERS[2] = 200
+
+	result, err := machine.Step()
+	assert.NoError(t, err)
+	assert.Equal(t, StepResult{
+		PCBefore: 0, PCAfter: 1, CIR: 0b0011_10_1111111111, Opcode: 0b0011, Register: 2, Operand: 1023,
+		RegistersBefore: []uint16{0, 0, 200, 0}, RegistersAfter: []uint16{0, 0, 500, 0}, Cycles: 1,
+		Reads: []MemoryAccess{{Address: 1023, Value: 300, Previous: 300}},
+	}, result)
+	assert.Equal(t, []int{2}, result.ChangedRegisters())
+
+	_, err = machine.Step() // LOAD R0 0, word 1 is zero
+	assert.NoError(t, err)
+	machine.PC = 1024
+	_, err = machine.Step()
+	var fault *extras.MemoryFaultError
+	assert.ErrorAs(t, err, &fault)
+	assert.Equal(t, 1024, fault.Address)
+}
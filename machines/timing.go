@@ -0,0 +1,119 @@
+package machines
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Work is what an opcode does besides being fetched, a Timing puts a price on it
+type Work struct {
+	Memory int // data words read or written
+	ALU    int // arithmetic, logic and shift operations
+	IO     int // IN and OUT transfers
+}
+
+// Timing is a timing table, an instruction costs Fetch plus the latency of
+// every part of its Work, Opcodes replaces that sum for single opcodes
+type Timing struct {
+	Name    string         `json:"name"`
+	Fetch   int            `json:"fetch"`             // every instruction
+	Memory  int            `json:"memory"`            // each data word read or written
+	ALU     int            `json:"alu"`               // each arithmetic, logic or shift operation
+	IO      int            `json:"io"`                // each IN or OUT
+	Opcodes map[string]int `json:"opcodes,omitempty"` // cost by opcode in binary, e.g. "0011"
+}
+
+// UnitTiming makes every instruction one cycle, it is what machines start with
+var UnitTiming = &Timing{Name: "unit", Fetch: 1}
+
+// ClassicTiming is a slow memory and slower I/O, as on a small microcontroller
+var ClassicTiming = &Timing{Name: "classic", Fetch: 2, Memory: 2, ALU: 1, IO: 8}
+
+// Timings are the built in timing tables by name
+var Timings = map[string]*Timing{
+	UnitTiming.Name:    UnitTiming,
+	ClassicTiming.Name: ClassicTiming,
+}
+
+// ReadTiming decodes a timing table written as JSON, as in
+// {"name": "slow", "fetch": 1, "memory": 4, "opcodes": {"0110": 3}}
+func ReadTiming(r io.Reader) (*Timing, error) {
+	var timing Timing
+	if err := json.NewDecoder(r).Decode(&timing); err != nil {
+		return nil, fmt.Errorf("invalid timing table: %w", err)
+	}
+	return &timing, nil
+}
+
+// Cost is what one opcode takes with this table
+func (t *Timing) Cost(opcode uint8, work Work) int {
+	for text, cost := range t.Opcodes {
+		if code, err := strconv.ParseUint(text, 2, 8); err == nil && uint8(code) == opcode {
+			return cost
+		}
+	}
+	return t.Fetch + work.Memory*t.Memory + work.ALU*t.ALU + work.IO*t.IO
+}
+
+// costs prices every opcode of a machine, each one has to take at least a
+// cycle so Run always gets through its budget
+func (t *Timing) costs(works []Work) ([]int, error) {
+	for text := range t.Opcodes {
+		code, err := strconv.ParseUint(text, 2, 8)
+		if err != nil || int(code) >= len(works) {
+			return nil, fmt.Errorf("timing %s: unknown opcode %q", t.Name, text)
+		}
+	}
+	costs := make([]int, len(works))
+	for opcode, work := range works {
+		costs[opcode] = t.Cost(uint8(opcode), work)
+		if costs[opcode] < 1 {
+			return nil, fmt.Errorf("timing %s: opcode %04b costs %d cycles, it has to take at least 1", t.Name, opcode, costs[opcode])
+		}
+	}
+	return costs, nil
+}
+
+// apache8bitsWork is the work of every Apache8bits opcode
+var apache8bitsWork = []Work{
+	//     BINARY | OPCODE     | WORK
+	{Memory: 1},         // 0000   | LOAD R0    | read ADDRESS
+	{Memory: 1},         // 0001   | STORE R0   | write ADDRESS
+	{},                  // 0010   | JUMP R0 IF |
+	{Memory: 1, ALU: 1}, // 0011   | ADD R0     | read ADDRESS, add
+	{ALU: 1},            // 0100   | <<R0       | shift
+	{ALU: 1},            // 0101   | NOT R0     | not
+	{},                  // 0110   | JUMP       |
+	{},                  // 0111   | STOP       |
+	{Memory: 1},         // 1000   | LOAD R1    | read ADDRESS
+	{Memory: 1},         // 1001   | STORE R1   | write ADDRESS
+	{},                  // 1010   | JUMP R1 IF |
+	{Memory: 1, ALU: 1}, // 1011   | ADD R1     | read ADDRESS, add
+	{ALU: 1},            // 1100   | <<R1       | shift
+	{ALU: 1},            // 1101   | NOT R1     | not
+	{IO: 1},             // 1110   | OUT R0     | output
+	{Memory: 1, IO: 1},  // 1111   | IN         | input, write ADDRESS
+}
+
+// apache16bitsWork is the work of every Apache16bits opcode
+var apache16bitsWork = []Work{
+	//     BINARY | OPCODE      | WORK
+	{Memory: 1},         // 0000   | LOAD RX AX  | read ADDRESS X
+	{Memory: 1},         // 0001   | STORE RX AX | write ADDRESS X
+	{},                  // 0010   | JUMP RX IF  |
+	{Memory: 1, ALU: 1}, // 0011   | ADD RX AX   | read ADDRESS X, add
+	{Memory: 1, ALU: 1}, // 0100   | SUB RX AX   | read ADDRESS X, sub
+	{Memory: 1, ALU: 1}, // 0101   | MUT RX AX   | read ADDRESS X, mut
+	{Memory: 1, ALU: 1}, // 0110   | DIV RX AX   | read ADDRESS X, div
+	{ALU: 1},            // 0111   | >>RX X      | shift
+	{ALU: 1},            // 1000   | <<RX X      | shift
+	{ALU: 1},            // 1001   | NOT RX      | not
+	{},                  // 1010   | JUMP        |
+	{},                  // 1011   |             |
+	{},                  // 1100   |             |
+	{},                  // 1101   | STOP        |
+	{IO: 1},             // 1110   | OUT RX      | output
+	{Memory: 1, IO: 1},  // 1111   | IN AX       | input, write ADDRESS
+}
@@ -0,0 +1,149 @@
+package machines
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/utils"
+)
+
+func Test_Timing_Cost(t *testing.T) {
+	add := Work{Memory: 1, ALU: 1}
+	assert.Equal(t, 1, UnitTiming.Cost(0b0011, add))
+	assert.Equal(t, 5, ClassicTiming.Cost(0b0011, add))
+	assert.Equal(t, 2, ClassicTiming.Cost(0b0110, Work{}))
+
+	timing := &Timing{Name: "slow add", Fetch: 1, Opcodes: map[string]int{"0011": 9}}
+	assert.Equal(t, 9, timing.Cost(0b0011, add))
+	assert.Equal(t, 1, timing.Cost(0b0000, Work{Memory: 1}))
+}
+
+func Test_Timing_Errors(t *testing.T) {
+	machine, err := NewApache8bits(extras.NewMemory3x8bits(), nil, nil)
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		timing   *Timing
+		expected string
+	}{
+		"not binary":     {&Timing{Name: "bad", Fetch: 1, Opcodes: map[string]int{"add": 2}}, `timing bad: unknown opcode "add"`},
+		"out of range":   {&Timing{Name: "bad", Fetch: 1, Opcodes: map[string]int{"10000": 2}}, `timing bad: unknown opcode "10000"`},
+		"free":           {&Timing{Name: "free"}, "timing free: opcode 0000 costs 0 cycles, it has to take at least 1"},
+		"free override":  {&Timing{Name: "free", Fetch: 1, Opcodes: map[string]int{"0111": 0}}, "timing free: opcode 0111 costs 0 cycles, it has to take at least 1"},
+		"negative fetch": {&Timing{Name: "neg", Fetch: -1, Memory: 2}, "timing neg: opcode 0010 costs -1 cycles, it has to take at least 1"},
+	}
+
+	for name, testCase := range testCases {
+		assert.EqualError(t, machine.SetTiming(testCase.timing), testCase.expected, name)
+		assert.Same(t, UnitTiming, machine.Timing(), name)
+	}
+}
+
+func Test_ReadTiming(t *testing.T) {
+	timing, err := ReadTiming(strings.NewReader(`{"name": "slow", "fetch": 1, "memory": 4, "opcodes": {"0110": 3}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &Timing{Name: "slow", Fetch: 1, Memory: 4, Opcodes: map[string]int{"0110": 3}}, timing)
+
+	_, err = ReadTiming(strings.NewReader(`{"fetch": "one"}`))
+	assert.ErrorContains(t, err, "invalid timing table")
+}
+
+func Test_Machine_Timing(t *testing.T) {
+	for _, slow := range []bool{false, true} {
+		memory := extras.NewMemory3x8bits()
+		// ADD R0 2, JUMP 0, data 1
+		assert.NoError(t, memory.LoadProgram("0011 0010\n0110 0000\n0000 0001"))
+
+		out := utils.NewTestOutput()
+		machine, err := NewApache8bits(memory, nil, &out)
+		assert.NoError(t, err)
+		assert.Same(t, UnitTiming, machine.Timing())
+		if slow {
+			machine.SetHistory(NewHistory(0))
+		}
+
+		// ADD takes the fetch, a memory read and the addition
+		assert.NoError(t, machine.SetTiming(ClassicTiming))
+		assert.NoError(t, machine.Run(5))
+		assert.Equal(t, 1, machine.Instructions())
+		assert.Equal(t, 5, machine.Cycles())
+
+		// the JUMP takes 2 cycles, the last instruction may go over the budget
+		assert.NoError(t, machine.Run(1))
+		assert.Equal(t, 2, machine.Instructions())
+		assert.Equal(t, 7, machine.Cycles())
+		assert.Equal(t, []uint16{1, 0}, machine.Registers())
+
+		result, err := machine.Step()
+		assert.NoError(t, err)
+		assert.Equal(t, 5, result.Cycles)
+
+		machine.Reset()
+		assert.Equal(t, 0, machine.Instructions())
+		assert.Equal(t, 0, machine.Cycles())
+
+		assert.NoError(t, machine.SetTiming(nil))
+		assert.Same(t, UnitTiming, machine.Timing())
+		assert.NoError(t, machine.Run(4))
+		assert.Equal(t, 4, machine.Instructions())
+		assert.Equal(t, 4, machine.Cycles())
+	}
+}
+
+func Test_Apache16bits_Timing(t *testing.T) {
+	memory := extras.NewMemory1024x16bits()
+	assert.NoError(t, memory.Set(0, 0b0110_00_0000000010)) // DIV R0 2, the STOP word is the divisor
+	assert.NoError(t, memory.Set(1, 0b1110_00_0000000000)) // OUT R0
+	assert.NoError(t, memory.Set(2, 0b1101_00_0000000000)) // STOP
+
+	out := utils.NewTestOutput()
+	machine, err := NewApache16bits(memory, nil, &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machine.SetTiming(&Timing{Name: "test", Fetch: 1, Memory: 3, ALU: 10, IO: 100, Opcodes: map[string]int{"1101": 7}}))
+
+	assert.NoError(t, machine.Run(1000))
+	assert.True(t, machine.Halted())
+	assert.Equal(t, 3, machine.Instructions())
+	assert.Equal(t, 14+101+7, machine.Cycles())
+}
+
+func Test_Machine_Cache(t *testing.T) {
+	memory := extras.NewMemory3x8bits()
+	// ADD R0 2, JUMP 0, data 1
+	assert.NoError(t, memory.LoadProgram("0011 0010\n0110 0000\n0000 0001"))
+
+	out := utils.NewTestOutput()
+	machine, err := NewApache8bits(memory, nil, &out)
+	assert.NoError(t, err)
+	assert.Nil(t, machine.CacheStats())
+
+	// 2 sets of one word, the ADD at 0 and its data at 2 evict each other
+	assert.NoError(t, machine.SetCache(&extras.CacheConfig{Size: 2, LineSize: 1, Ways: 1, MemoryLatency: 10}))
+	for _, cycles := range []int{21, 11, 21} {
+		result, err := machine.Step()
+		assert.NoError(t, err)
+		assert.Equal(t, cycles, result.Cycles)
+	}
+	assert.Equal(t, 53, machine.Cycles())
+	assert.Equal(t, &extras.CacheStats{Reads: 5, Misses: 5, Latency: 50}, machine.CacheStats())
+
+	// debuggers look at the memory behind the cache
+	val, err := machine.ReadMemory(2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), val)
+	assert.NoError(t, machine.WriteMemory(2, 3))
+	assert.Equal(t, 5, machine.CacheStats().Reads)
+	assert.Equal(t, 0, machine.CacheStats().Writes)
+
+	assert.NoError(t, machine.SetCache(nil))
+	assert.Same(t, memory, machine.MEMORY)
+	assert.Nil(t, machine.CacheStats())
+	result, err := machine.Step()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Cycles)
+
+	assert.Error(t, machine.SetCache(&extras.CacheConfig{Size: 3, LineSize: 2, Ways: 1}))
+}
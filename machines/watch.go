@@ -0,0 +1,44 @@
+package machines
+
+// Watch is called after every instruction while set on a machine, returning
+// stop pauses Run and reason tells the user why
+type Watch func(result StepResult) (reason string, stop bool)
+
+// runWatched is the slow Run path, each instruction goes through Step so the
+// watch, when there is one, can look at what it did, an instruction that
+// faults is shown to the watch before its error is returned
+func runWatched(machine Machine, watch Watch, cycles int) error {
+	for !machine.Halted() && cycles > 0 {
+		result, err := machine.Step()
+		cycles -= result.Cycles
+		if watch == nil {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		reason, stop := watch(result)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return &BreakError{PC: result.PCAfter, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// Chain calls every watch after each instruction, the first one asking to stop
+// gives the reason, the ones after it still see the instruction
+func Chain(watches ...Watch) Watch {
+	return func(result StepResult) (string, bool) {
+		var reason string
+		var stop bool
+		for _, watch := range watches {
+			if r, s := watch(result); s && !stop {
+				reason, stop = r, true
+			}
+		}
+		return reason, stop
+	}
+}
@@ -0,0 +1,87 @@
+package machines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/utils"
+)
+
+func Test_Machine_Watch(t *testing.T) {
+	memory := extras.NewMemory3x8bits()
+	// ADD R0 2, JUMP 0, data 1
+	assert.NoError(t, memory.LoadProgram("0011 0010\n0110 0000\n0000 0001"))
+
+	out := utils.NewTestOutput()
+	machine, err := NewApache8bits(memory, nil, &out)
+	assert.NoError(t, err)
+
+	var seen int
+	machine.SetWatch(func(result StepResult) (string, bool) {
+		seen++
+		return "R0 reached 3", result.RegistersAfter[0] == 3
+	})
+
+	err = machine.Run(999)
+	var pause *BreakError
+	assert.ErrorAs(t, err, &pause)
+	assert.Equal(t, &BreakError{PC: 1, Reason: "R0 reached 3"}, pause)
+	assert.Equal(t, 5, seen)
+
+	// resuming runs the JUMP, R0 is still 3 so the watch pauses again
+	assert.ErrorAs(t, machine.Run(999), &pause)
+	assert.Equal(t, []uint16{3, 0}, machine.Registers())
+
+	machine.SetWatch(nil)
+	assert.NoError(t, machine.Run(4))
+	assert.Equal(t, []uint16{5, 0}, machine.Registers())
+	assert.Equal(t, 6, seen)
+}
+
+func Test_Machine_Watch_Fault(t *testing.T) {
+	memory := extras.NewMemory3x8bits()
+	// NOT R1, LOAD R0 15, the load faults
+	assert.NoError(t, memory.LoadProgram("1101 0000\n0000 1111"))
+	machine, err := NewApache8bits(memory, nil, nil)
+	assert.NoError(t, err)
+
+	var seen []StepResult
+	machine.SetWatch(func(result StepResult) (string, bool) {
+		seen = append(seen, result)
+		return "", false
+	})
+
+	err = machine.Run(999)
+	var fault *extras.MemoryFaultError
+	assert.ErrorAs(t, err, &fault)
+	assert.Len(t, seen, 2)
+	assert.Equal(t, err, seen[1].Fault)
+	assert.True(t, seen[1].Fetched())
+	assert.Equal(t, uint16(0b0000_1111), seen[1].CIR)
+
+	// the PC now points past the end of memory, nothing is fetched
+	assert.NoError(t, machine.SetProgramCounter(3))
+	assert.Error(t, machine.Run(999))
+	assert.Len(t, seen, 3)
+	assert.False(t, seen[2].Fetched())
+}
+
+func Test_Chain(t *testing.T) {
+	var calls []string
+	watch := func(name string, stop bool) Watch {
+		return func(_ StepResult) (string, bool) {
+			calls = append(calls, name)
+			return name, stop
+		}
+	}
+
+	reason, stop := Chain(watch("a", false), watch("b", true), watch("c", true))(StepResult{})
+	assert.True(t, stop)
+	assert.Equal(t, "b", reason)
+	assert.Equal(t, []string{"a", "b", "c"}, calls)
+
+	_, stop = Chain(watch("a", false))(StepResult{})
+	assert.False(t, stop)
+}
@@ -1,40 +1,337 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/coverage"
+	"apache-instruction-set-simulator/disassembler"
 	"apache-instruction-set-simulator/extras"
 	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/pipeline"
+	"apache-instruction-set-simulator/profiler"
+	"apache-instruction-set-simulator/trace"
 )
 
+// commands other than run, picked by the first argument
+var commands = map[string]func(args []string) error{
+	"asm":    asmCommand,
+	"cosim":  cosimCommand,
+	"dap":    dapCommand,
+	"debug":  debugCommand,
+	"disasm": disasmCommand,
+	"gdb":    gdbCommand,
+	"test":   testCommand,
+}
+
 func main() {
 	err := godotenv.Load(".env")
 	if err != nil {
 		log.Fatalf("Load env error: %+v", err)
 	}
 
-	var programName string = os.Args[1]
-	if programName == "" {
-		log.Fatal("programName param was not provided")
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatalf("%s error: %+v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
+	if err := runCommand(os.Args[1:]); err != nil {
+		log.Fatalf("Run error: %+v", err)
+	}
+}
+
+func runCommand(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	machineName := flags.String("machine", "apache8", fmt.Sprintf("machine to run the program on (%s)", strings.Join(machines.Names(), ", ")))
+	traceName := flags.String("trace", "", "file to write a record of every executed instruction to")
+	traceFormat := flags.String("trace-format", "json", "trace format, json (JSON Lines) or text")
+	restoreName := flags.String("restore", "", "snapshot file to resume instead of loading a program, only the cycles are given then")
+	snapshotName := flags.String("snapshot", "", "file to write a snapshot to when the cycles run out before STOP")
+	snapshotFormat := flags.String("snapshot-format", "json", "snapshot format, json or binary")
+	profileName := flags.String("profile", "", "file to write an execution profile annotated against the disassembly to")
+	coverageName := flags.String("coverage", "", "file to write a coverage report mapped to the program source to")
+	coverageFormat := flags.String("coverage-format", "text", "coverage format, text or lcov")
+	coverageMin := flags.Float64("coverage-min", 0, "fail when less than this percentage of the source lines ran")
+	coverageBranchMin := flags.Float64("coverage-branch-min", 0, "fail when less than this percentage of the branch outcomes happened")
+	pipelineName := flags.String("pipeline", "", "time the run on a five stage pipeline handling hazards by stall or forward and print its CPI next to the one of the machine under its timing")
+	timingName := flags.String("timing", "", "timing table pricing the cycles, unit, classic or a JSON file, the cycle count is printed at the end")
+	cacheSize := flags.Int("cache-size", 0, "words of a cache to put in front of the memory, its statistics are printed at the end, 0 runs without one")
+	cacheLine := flags.Int("cache-line", 1, "words per cache line")
+	cacheWays := flags.Int("cache-ways", 1, "cache lines per set, 1 is direct mapped")
+	cacheReplacement := flags.String("cache-replacement", "lru", "cache replacement policy, lru, fifo or random")
+	cacheWrite := flags.String("cache-write", "back", "cache write policy, back or through")
+	cacheHitLatency := flags.Int("cache-hit-latency", 0, "extra cycles of every cache access")
+	cacheMemoryLatency := flags.Int("cache-memory-latency", 10, "extra cycles of every transfer between the cache and the memory")
+	flags.Parse(args)
+
+	var programName string = flags.Arg(0)
+	cyclesArg := 1
+	if *restoreName != "" {
+		programName, cyclesArg = "", 0
+	} else if programName == "" {
+		return fmt.Errorf("programName param was not provided")
 	}
 	sCycles := os.Getenv("CYCLES")
-	if len(os.Args) == 3 {
-		sCycles = os.Args[2]
+	if flags.NArg() == cyclesArg+1 {
+		sCycles = flags.Arg(cyclesArg)
 	}
 	cycles, err := strconv.ParseInt(sCycles, 10, 64)
 	if err != nil {
-		log.Fatalf("Casting error: %+v", err)
+		return fmt.Errorf("casting error: %w", err)
+	}
+	format, err := machines.ParseSnapshotFormat(*snapshotFormat)
+	if err != nil {
+		return err
+	}
+	if *coverageName != "" && *restoreName != "" {
+		return fmt.Errorf("coverage is mapped to the program source, it can not start from a snapshot")
+	}
+
+	var snapshot machines.Snapshot
+	if *restoreName != "" {
+		if snapshot, err = readSnapshot(*restoreName); err != nil {
+			return err
+		}
+		*machineName = snapshot.Machine
 	}
 
 	fmt.Println("process started")
-	var memory *extras.Memory16x8bits = extras.NewMemory16x8bits()
-	memory.LoadProgram(programName)
-	var machine *machines.Apache8bits = machines.NewApache8bits(memory, nil, nil)
-	machine.Run(int(cycles))
+	machine, err := machines.New(*machineName, nil, nil)
+	if err != nil {
+		return err
+	}
+	if *restoreName != "" {
+		err = machine.Restore(snapshot)
+	} else {
+		err = machine.LoadProgram(programName)
+	}
+	if err != nil {
+		return err
+	}
+	if *timingName != "" {
+		timing, err := readTiming(*timingName)
+		if err != nil {
+			return err
+		}
+		if err := machine.SetTiming(timing); err != nil {
+			return err
+		}
+	}
+	if *cacheSize > 0 {
+		config := extras.CacheConfig{Size: *cacheSize, LineSize: *cacheLine, Ways: *cacheWays, HitLatency: *cacheHitLatency, MemoryLatency: *cacheMemoryLatency}
+		if config.Replacement, err = extras.ParseReplacement(*cacheReplacement); err != nil {
+			return err
+		}
+		if config.Write, err = extras.ParseWritePolicy(*cacheWrite); err != nil {
+			return err
+		}
+		if err := machine.SetCache(&config); err != nil {
+			return err
+		}
+	}
+	var watches []machines.Watch
+	var profile *profiler.Profile
+	if *profileName != "" || *coverageName != "" {
+		target, ok := assembler.Targets[*machineName]
+		if !ok {
+			return fmt.Errorf("no assembler target for machine: %s", *machineName)
+		}
+		profile = profiler.New(target)
+		watches = append(watches, profile.Watch)
+	}
+	var stages *pipeline.Pipeline
+	if *pipelineName != "" {
+		hazards, err := pipeline.ParseHazards(*pipelineName)
+		if err != nil {
+			return err
+		}
+		target, ok := assembler.Targets[*machineName]
+		if !ok {
+			return fmt.Errorf("no assembler target for machine: %s", *machineName)
+		}
+		if stages, err = pipeline.New(target, hazards); err != nil {
+			return err
+		}
+		watches = append(watches, stages.Watch)
+	}
+	// the trace is opened last, nothing returns between creating it and closing it
+	var closeTrace func() error
+	if *traceName != "" {
+		var watch machines.Watch
+		if watch, closeTrace, err = traceRun(*machineName, *traceName, *traceFormat); err != nil {
+			return err
+		}
+		watches = append(watches, watch)
+	}
+	if len(watches) > 0 {
+		machine.SetWatch(machines.Chain(watches...))
+	}
+	runErr := machine.Run(int(cycles))
+	if closeTrace != nil {
+		if err := closeTrace(); err != nil {
+			return err
+		}
+	}
+	// a run stopped by an error is reported up to the faulting instruction
+	// before the error is returned
+	if *profileName != "" {
+		if err := writeProfile(machine, profile, *profileName); err != nil {
+			return err
+		}
+	}
+	var report *coverage.Report
+	if *coverageName != "" {
+		if report, err = collectCoverage(machine, profile, programName); err != nil {
+			return err
+		}
+		if err := writeCoverage(report, *coverageName, *coverageFormat); err != nil {
+			return err
+		}
+		fmt.Println(report.Summary())
+	}
+	if stages != nil {
+		if err := stages.Report(os.Stdout, machine); err != nil {
+			return err
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if report != nil {
+		if err := report.Check(*coverageMin, *coverageBranchMin); err != nil {
+			return err
+		}
+	}
+	if *snapshotName != "" && !machine.Halted() {
+		if err := writeSnapshot(machine, *snapshotName, format); err != nil {
+			return err
+		}
+		fmt.Printf("cycles ran out, snapshot written to %s\n", *snapshotName)
+	}
+	if stats := machine.CacheStats(); stats != nil {
+		fmt.Printf("cache: %s\n", stats)
+	}
+	if *timingName != "" {
+		fmt.Printf("%d instructions, %d cycles\n", machine.Instructions(), machine.Cycles())
+	}
 	fmt.Println("process finished")
+	return nil
+}
+
+// readTiming picks a built in timing table by name or reads one from a file
+func readTiming(name string) (*machines.Timing, error) {
+	if timing, ok := machines.Timings[name]; ok {
+		return timing, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return machines.ReadTiming(file)
+}
+
+func readSnapshot(name string) (machines.Snapshot, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return machines.Snapshot{}, err
+	}
+	defer file.Close()
+	return machines.ReadSnapshot(file)
+}
+
+func writeSnapshot(machine machines.Machine, name string, format machines.SnapshotFormat) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := machine.Snapshot().Write(file, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// traceRun builds a watch writing a trace record per instruction to traceName
+func traceRun(machineName string, traceName string, formatName string) (machines.Watch, func() error, error) {
+	format, err := trace.ParseFormat(formatName)
+	if err != nil {
+		return nil, nil, err
+	}
+	target, ok := assembler.Targets[machineName]
+	if !ok {
+		return nil, nil, fmt.Errorf("no assembler target for machine: %s", machineName)
+	}
+	file, err := os.Create(traceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return trace.NewWriter(writer, target, format).Watch, func() error {
+		if err := writer.Flush(); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}, nil
+}
+
+// writeProfile reports the profile against the memory as the run left it
+func writeProfile(machine machines.Machine, profile *profiler.Profile, profileName string) error {
+	lines, err := disassembler.FromMachine(machine, profile.Target)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(profileName)
+	if err != nil {
+		return err
+	}
+	if err := profile.Report(file, lines); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// collectCoverage maps the profile of the run onto the source of programName,
+// loaded from programs/ like LoadProgram does
+func collectCoverage(machine machines.Machine, profile *profiler.Profile, programName string) (*coverage.Report, error) {
+	source, err := coverage.LoadSource(filepath.Join("programs", programName), profile.Target)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := disassembler.FromMachine(machine, profile.Target)
+	if err != nil {
+		return nil, err
+	}
+	return coverage.Collect(profile, lines, source), nil
+}
+
+func writeCoverage(report *coverage.Report, coverageName string, formatName string) error {
+	format, err := coverage.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(coverageName)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(file, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
@@ -1,44 +1,232 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
-	"apache-instruction-set-simulator/extras"
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/coverage"
+	"apache-instruction-set-simulator/legacy"
 	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/profiler"
 	"apache-instruction-set-simulator/utils"
 )
 
-func Test_Apache8bits_Against_Programs(t *testing.T) {
+// the programs are checked by the specs next to them, programs/*.test.yaml
+// and programs/*.test.json
+func Test_TestCommand(t *testing.T) {
+	junit := filepath.Join(t.TempDir(), "junit.xml")
+	assert.NoError(t, testCommand([]string{"-junit", junit}))
+
+	report, err := os.ReadFile(junit)
+	assert.NoError(t, err)
+	assert.Contains(t, string(report), `<testsuites tests="10" failures="0" errors="0"`)
+
+	dir := t.TempDir()
+	image, err := os.ReadFile("programs/sum.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sum.txt"), image, 0644))
+	spec := filepath.Join(dir, "sum.test.yaml")
+	assert.NoError(t, os.WriteFile(spec, []byte("program: sum.txt\ncases:\n  - input: [\"1\", \"2\"]\n    output: [\"4\"]\n"), 0644))
+	err = testCommand([]string{spec})
+	assert.EqualError(t, err, "1 of 1 tests failed")
+
+	// a spec that does not load is reported and the others still run
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bad.test.yaml"), []byte("program: sum.txt\n"), 0644))
+	err = testCommand([]string{"-junit", junit, dir})
+	assert.EqualError(t, err, "2 of 2 tests failed")
+	report, err = os.ReadFile(junit)
+	assert.NoError(t, err)
+	assert.Contains(t, string(report), `<testsuites tests="2" failures="1" errors="1"`)
+
+	err = testCommand([]string{t.TempDir()})
+	assert.ErrorContains(t, err, "no spec files found")
+}
+
+func Test_AsmCommand(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "sum.txt")
+
+	err := asmCommand([]string{"-o", output, "programs/sum.masic"})
+	assert.NoError(t, err)
+
+	image, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	expected, err := os.ReadFile("programs/sum.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(expected)), strings.TrimSpace(string(image)))
+
+	output = filepath.Join(t.TempDir(), "fibonacci16.txt")
+	symbols := filepath.Join(t.TempDir(), "fibonacci16.sym")
+	err = asmCommand([]string{"-machine", "apache16", "-o", output, "-symbols", symbols, "programs/fibonacci16.masic"})
+	assert.NoError(t, err)
+
+	table, err := os.ReadFile(symbols)
+	assert.NoError(t, err)
+	assert.Equal(t, "loop 1 code 5\ndone 10 code 14\ncount 11 data 15\nNUMBERS 12 const 2\none 12 data 16\na 13 data 17\nb 14 data 18\n", string(table))
+
+	image, err = os.ReadFile(output)
+	assert.NoError(t, err)
+	expected, err = os.ReadFile("programs/fibonacci16.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(image))
+
+	source := filepath.Join(t.TempDir(), "bad.masic")
+	assert.NoError(t, os.WriteFile(source, []byte("STOP\nFOO\n"), 0644))
+	err = asmCommand([]string{source})
+	assert.EqualError(t, err, "\n"+source+":2: unknown instruction \"FOO\"")
+}
+
+func Test_RunCommand_Snapshot(t *testing.T) {
+	first := filepath.Join(t.TempDir(), "fibonacci.json")
+	assert.NoError(t, runCommand([]string{"-snapshot", first, "fibonacci.txt", "20"}))
+
+	second := filepath.Join(t.TempDir(), "fibonacci.bin")
+	assert.NoError(t, runCommand([]string{"-restore", first, "-snapshot", second, "-snapshot-format", "binary", "10"}))
+
+	snapshot, err := readSnapshot(second)
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := machines.New("apache8", nil, &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machine.LoadProgram("fibonacci.txt"))
+	assert.NoError(t, machine.Run(30))
+	assert.Equal(t, machine.Snapshot(), snapshot)
+
+	// programs that halt leave no snapshot behind
+	halted := filepath.Join(t.TempDir(), "fibonacci16.json")
+	assert.NoError(t, runCommand([]string{"-machine", "apache16", "-snapshot", halted, "fibonacci16.txt", "999"}))
+	assert.NoFileExists(t, halted)
+}
+
+func Test_RunCommand_Profile_And_Trace(t *testing.T) {
+	profileName := filepath.Join(t.TempDir(), "profile.txt")
+	traceName := filepath.Join(t.TempDir(), "trace.txt")
+	err := runCommand([]string{"-machine", "apache16", "-profile", profileName, "-trace", traceName, "-trace-format", "text", "fibonacci16.txt", "999"})
+	assert.NoError(t, err)
+
+	profile, err := os.ReadFile(profileName)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(profile), "55 instructions, 55 cycles\n"))
+	assert.Contains(t, string(profile), "0008  JUMP R1 IF 10           1         5   16.7%\n")
+
+	records, err := os.ReadFile(traceName)
+	assert.NoError(t, err)
+	assert.Equal(t, 55, strings.Count(string(records), "\n"))
+}
+
+func Test_RunCommand_Fault(t *testing.T) {
+	// the DIV faults, the profile and the trace still cover it
+	program, err := assembler.Assemble(`
+        LOAD R0 one
+        DIV R0 zero
+        STOP
+one:    .data 1
+zero:   .data 0
+`, assembler.Apache16bits)
+	assert.NoError(t, err)
+	machine, err := machines.New("apache16", nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, machines.LoadWords(machine, program.Words))
+	snapshotName := filepath.Join(t.TempDir(), "div.json")
+	assert.NoError(t, writeSnapshot(machine, snapshotName, machines.SnapshotJSON))
+
+	profileName := filepath.Join(t.TempDir(), "profile.txt")
+	traceName := filepath.Join(t.TempDir(), "trace.txt")
+	err = runCommand([]string{"-restore", snapshotName, "-profile", profileName, "-trace", traceName, "-trace-format", "text", "99"})
+	var executionErr *machines.ExecutionError
+	assert.ErrorAs(t, err, &executionErr)
+
+	profile, err := os.ReadFile(profileName)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(profile), "2 instructions, 2 cycles\n"))
+
+	records, err := os.ReadFile(traceName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(records), "\n"))
+	assert.Contains(t, string(records), "fault: ")
+
+	// the records are buffered, /dev/full only refuses them when they are flushed
+	if _, err := os.Stat("/dev/full"); err == nil {
+		err = runCommand([]string{"-trace", "/dev/full", "fibonacci.txt", "3"})
+		assert.Error(t, err)
+	}
+}
+
+func Test_RunCommand_Timing(t *testing.T) {
+	out := utils.NewTestOutput()
+	machine, err := machines.New("apache16", nil, &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machine.LoadProgram("fibonacci16.txt"))
+	assert.NoError(t, machine.SetTiming(machines.ClassicTiming))
+	assert.NoError(t, machine.Run(999))
+	assert.Equal(t, 55, machine.Instructions())
+
+	profileName := filepath.Join(t.TempDir(), "profile.txt")
+	err = runCommand([]string{"-machine", "apache16", "-timing", "classic", "-profile", profileName, "fibonacci16.txt", "999"})
+	assert.NoError(t, err)
+	profile, err := os.ReadFile(profileName)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(profile), fmt.Sprintf("55 instructions, %d cycles\n", machine.Cycles())))
+
+	// a table from a file, fibonacci does not halt in the cycles a slow fetch leaves
+	timingName := filepath.Join(t.TempDir(), "slow.json")
+	assert.NoError(t, os.WriteFile(timingName, []byte(`{"name": "slow", "fetch": 100}`), 0644))
+	snapshotName := filepath.Join(t.TempDir(), "fibonacci16.json")
+	assert.NoError(t, runCommand([]string{"-machine", "apache16", "-timing", timingName, "-snapshot", snapshotName, "fibonacci16.txt", "999"}))
+	assert.FileExists(t, snapshotName)
+
+	err = runCommand([]string{"-timing", filepath.Join(t.TempDir(), "missing.json"), "fibonacci.txt", "3"})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_RunCommand_Pipeline(t *testing.T) {
+	assert.NoError(t, runCommand([]string{"-machine", "apache16", "-pipeline", "forward", "fibonacci16.txt", "999"}))
+	assert.NoError(t, runCommand([]string{"-timing", "classic", "-pipeline", "stall", "fibonacci.txt", "999"}))
+
+	err := runCommand([]string{"-pipeline", "superscalar", "fibonacci.txt", "3"})
+	assert.EqualError(t, err, `unknown hazard handling "superscalar", use stall or forward`)
+}
+
+func Test_RunCommand_Cache(t *testing.T) {
+	// the misses make fibonacci too slow to halt in the cycles it needs without a cache
+	snapshotName := filepath.Join(t.TempDir(), "fibonacci16.json")
+	args := []string{"-machine", "apache16", "-cache-size", "8", "-cache-line", "2", "-cache-ways", "2", "-cache-replacement", "fifo", "-snapshot", snapshotName}
+	assert.NoError(t, runCommand(append(args, "fibonacci16.txt", "55")))
+	assert.FileExists(t, snapshotName)
+
+	err := runCommand(append(args, "-cache-write", "around", "fibonacci16.txt", "55"))
+	assert.EqualError(t, err, `unknown write policy "around", use back or through`)
+	err = runCommand([]string{"-cache-size", "6", "-cache-line", "4", "fibonacci.txt", "3"})
+	assert.EqualError(t, err, "cache size 6 is not a multiple of 1 ways of 4 words")
+}
+
+func Test_CosimCommand(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "input.txt")
+	assert.NoError(t, os.WriteFile(input, []byte("9\n4\n"), 0644))
+	for _, programName := range []string{"fibonacci.txt", "sub.txt", "sum.txt"} {
+		assert.NoError(t, cosimCommand([]string{"-input", input, programName}), programName)
+	}
+
+	// apache8 reads 9 and 4 as two numbers, the legacy interpreter reads 94
+	assert.NoError(t, os.WriteFile(input, []byte("9 4\n"), 0644))
+	err := cosimCommand([]string{"-input", input, "sub.txt"})
+	var divergence *legacy.Divergence
+	assert.ErrorAs(t, err, &divergence)
+	assert.Equal(t, 1, divergence.Instructions)
+}
+
+func Test_Program_Coverage(t *testing.T) {
 	testCases := map[string]struct {
-		programName, input, output string
-		cycles                     int
+		programName, input string
 	}{
-		"sum.txt": {
-			programName: "sum.txt",
-			input:       "25\n" + "25\n",
-			output:      "50\n",
-			cycles:      999,
-		},
-		"sub.txt": {
-			programName: "sub.txt",
-			input:       "99\n" + "33\n",
-			output:      "66\n",
-			cycles:      999,
-		},
-		"square.txt": {
-			programName: "square.txt",
-			input:       "5\n",
-			output:      "25\n",
-			cycles:      999,
-		},
-		"fibonacci.txt": {
-			programName: "fibonacci.txt",
-			input:       "",
-			output:      "1\n2\n3\n5\n8\n13\n21\n34\n55\n89\n144\n233\n",
-			cycles:      44,
-		},
+		"square.txt": {programName: "square.txt", input: "5\n"},
+		"sub.txt":    {programName: "sub.txt", input: "9\n" + "4\n"},
 	}
 
 	for name, testCase := range testCases {
@@ -50,13 +238,32 @@ func Test_Apache8bits_Against_Programs(t *testing.T) {
 			defer in.Close()
 
 			out := utils.NewTestOutput()
+			machine, err := machines.New("apache8", in, &out)
+			assert.NoError(t, err)
+			assert.NoError(t, machine.LoadProgram(testCase.programName))
+			profile := profiler.New(assembler.Apache8bits)
+			machine.SetWatch(profile.Watch)
+			assert.NoError(t, machine.Run(999))
 
-			var memory *extras.Memory16x8bits = extras.NewMemory16x8bits()
-			memory.LoadProgram(testCase.programName)
-			var machine *machines.Apache8bits = machines.NewApache8bits(memory, in, &out)
-			machine.Run(testCase.cycles)
-
-			assert.Equal(t, testCase.output, utils.ClearOutputForTesting(out.String()))
+			report, err := collectCoverage(machine, profile, testCase.programName)
+			assert.NoError(t, err)
+			assert.NoError(t, report.Check(100, 100), report.Summary())
 		})
 	}
 }
+
+func Test_RunCommand_Coverage(t *testing.T) {
+	coverageName := filepath.Join(t.TempDir(), "fibonacci16.lcov")
+	err := runCommand([]string{"-machine", "apache16", "-coverage", coverageName, "-coverage-format", "lcov", "-coverage-min", "100", "fibonacci16.txt", "999"})
+	assert.NoError(t, err)
+
+	lcov, err := os.ReadFile(coverageName)
+	assert.NoError(t, err)
+	assert.Contains(t, string(lcov), "SF:programs/fibonacci16.masic\n")
+	assert.Contains(t, string(lcov), "LF:11\nLH:11\n")
+
+	// nothing halts fibonacci in 3 cycles
+	err = runCommand([]string{"-coverage", filepath.Join(t.TempDir(), "fibonacci.txt"), "-coverage-min", "50", "fibonacci.txt", "3"})
+	var threshold *coverage.ThresholdError
+	assert.ErrorAs(t, err, &threshold)
+}
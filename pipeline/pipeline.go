@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+// Stages are the stages every instruction goes through, in order
+var Stages = []string{"IF", "ID", "EX", "MEM", "WB"}
+
+// indexes of the stages in Stages a result can come out of
+const (
+	stageEX  = 2
+	stageMEM = 3
+	stageWB  = 4
+)
+
+// Hazards picks how a source register still being computed is waited for
+type Hazards int
+
+const (
+	Stall   Hazards = iota // wait until the producer wrote the register file back
+	Forward                // take the value from the stage that produced it
+)
+
+var hazards = []string{"stall", "forward"}
+
+func (h Hazards) String() string {
+	return hazards[h]
+}
+
+// ParseHazards reads the names printed by Hazards.String
+func ParseHazards(name string) (Hazards, error) {
+	for idx, hazard := range hazards {
+		if hazard == name {
+			return Hazards(idx), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hazard handling %q, use %s", name, strings.Join(hazards, " or "))
+}
+
+// Usage is how an opcode uses its register
+type Usage struct {
+	Register int  // register of the opcode, -1 when it is encoded in the instruction
+	Reads    bool // the register is a source, needed when the instruction enters EX
+	Writes   bool // the register is the destination
+	Memory   bool // the result comes out of MEM instead of EX
+}
+
+// usages are the register usages of every opcode by machine name
+var usages = map[string][]Usage{
+	"apache8": {
+		//     BINARY | OPCODE     | COMMENT
+		{Register: 0, Writes: true, Memory: true},              // 0000   | LOAD R0    |
+		{Register: 0, Reads: true},                             // 0001   | STORE R0   |
+		{Register: 0, Reads: true},                             // 0010   | JUMP R0 IF | resolved in EX
+		{Register: 0, Reads: true, Writes: true, Memory: true}, // 0011   | ADD R0     | adds the word read in MEM
+		{Register: 0, Reads: true, Writes: true},               // 0100   | <<R0       |
+		{Register: 0, Reads: true, Writes: true},               // 0101   | NOT R0     |
+		{Register: -1},                                         // 0110   | JUMP       | resolved in ID
+		{Register: -1},                                         // 0111   | STOP       |
+		{Register: 1, Writes: true, Memory: true},              // 1000   | LOAD R1    |
+		{Register: 1, Reads: true},                             // 1001   | STORE R1   |
+		{Register: 1, Reads: true},                             // 1010   | JUMP R1 IF | resolved in EX
+		{Register: 1, Reads: true, Writes: true, Memory: true}, // 1011   | ADD R1     | adds the word read in MEM
+		{Register: 1, Reads: true, Writes: true},               // 1100   | <<R1       |
+		{Register: 1, Reads: true, Writes: true},               // 1101   | NOT R1     |
+		{Register: 0, Reads: true},                             // 1110   | OUT R0     |
+		{Register: -1},                                         // 1111   | IN         | writes memory in MEM
+	},
+	"apache16": {
+		//     BINARY | OPCODE      | COMMENT
+		{Register: -1, Writes: true, Memory: true},              // 0000   | LOAD RX AX  |
+		{Register: -1, Reads: true},                             // 0001   | STORE RX AX |
+		{Register: -1, Reads: true},                             // 0010   | JUMP RX IF  | resolved in EX
+		{Register: -1, Reads: true, Writes: true, Memory: true}, // 0011   | ADD RX AX   | uses the word read in MEM
+		{Register: -1, Reads: true, Writes: true, Memory: true}, // 0100   | SUB RX AX   | uses the word read in MEM
+		{Register: -1, Reads: true, Writes: true, Memory: true}, // 0101   | MUT RX AX   | uses the word read in MEM
+		{Register: -1, Reads: true, Writes: true, Memory: true}, // 0110   | DIV RX AX   | uses the word read in MEM
+		{Register: -1, Reads: true, Writes: true},               // 0111   | >>RX X      |
+		{Register: -1, Reads: true, Writes: true},               // 1000   | <<RX X      |
+		{Register: -1, Reads: true, Writes: true},               // 1001   | NOT RX      |
+		{Register: -1},              // 1010   | JUMP        | resolved in ID
+		{Register: -1},              // 1011   |             |
+		{Register: -1},              // 1100   |             |
+		{Register: -1},              // 1101   | STOP        |
+		{Register: -1, Reads: true}, // 1110   | OUT RX      |
+		{Register: -1},              // 1111   | IN AX       | writes memory in MEM
+	},
+}
+
+// Pipeline times a program on a five stage pipeline, set its Watch on a
+// machine and the machine executes the instructions while the pipeline counts
+// the cycles they would take overlapped, conditional jumps are predicted not
+// taken and flush the two instructions behind them when they jump
+type Pipeline struct {
+	Target       *assembler.Target
+	Hazards      Hazards
+	Instructions int // executed in total
+	Stalls       int // cycles lost waiting for a source register
+	Flushes      int // cycles lost to instructions fetched after a jump
+	usages       []Usage
+	ready        map[int]int // first cycle each register can enter EX as a source
+	next         int         // first cycle the next instruction can enter EX
+	last         int         // cycle the last instruction entered EX
+}
+
+// New builds a pipeline for the machine of target
+func New(target *assembler.Target, hazards Hazards) (*Pipeline, error) {
+	usages, ok := usages[target.Name]
+	if !ok {
+		return nil, fmt.Errorf("no pipeline for machine: %s", target.Name)
+	}
+	return &Pipeline{Target: target, Hazards: hazards, usages: usages, ready: map[int]int{}, next: stageEX}, nil
+}
+
+// Record moves one executed instruction through the pipeline
+func (p *Pipeline) Record(result machines.StepResult) {
+	if !result.Fetched() {
+		return
+	}
+	p.Instructions++
+	execute := p.next
+	usage := p.usages[result.Opcode]
+	register := usage.Register
+	if register < 0 {
+		register = int(result.Register)
+	}
+	if ready := p.ready[register]; usage.Reads && ready > execute {
+		p.Stalls += ready - execute
+		execute = ready
+	}
+	if usage.Writes {
+		p.ready[register] = execute + p.latency(usage)
+	}
+	p.last, p.next = execute, execute+1
+
+	instruction, _, _, ok := p.Target.Decode(result.CIR)
+	if !ok || result.PCAfter == result.PCBefore+1 || result.Halted {
+		return
+	}
+	switch instruction.Flow {
+	case assembler.FlowJump:
+		p.Flushes++
+		p.next++
+	case assembler.FlowBranch:
+		p.Flushes += 2
+		p.next += 2
+	}
+}
+
+// latency is how many cycles after entering EX a result can be used by the
+// next instructions entering EX, one cycle after the stage that has it
+func (p *Pipeline) latency(usage Usage) int {
+	produced := stageEX
+	if usage.Memory {
+		produced = stageMEM
+	}
+	if p.Hazards == Stall {
+		// written back in the first half of WB, read by ID in the second, so
+		// every result waits for WB wherever it was produced
+		produced = stageWB
+	}
+	return produced - stageEX + 1
+}
+
+// Watch times without ever pausing the program
+func (p *Pipeline) Watch(result machines.StepResult) (string, bool) {
+	p.Record(result)
+	return "", false
+}
+
+// Cycles is the time from the first fetch to the last write back
+func (p *Pipeline) Cycles() int {
+	if p.Instructions == 0 {
+		return 0
+	}
+	return p.last + len(Stages) - stageEX
+}
+
+// CPI is the average of cycles per instruction, 0 before any instruction
+func (p *Pipeline) CPI() float64 {
+	if p.Instructions == 0 {
+		return 0
+	}
+	return float64(p.Cycles()) / float64(p.Instructions)
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/utils"
+)
+
+const countdown = `
+        LOAD R0 count
+loop:   ADD R0 minus
+        STORE R0 count
+        JUMP R0 IF done
+        JUMP loop
+done:   STOP
+count:  .data 3
+minus:  .data -1
+`
+
+func runPipeline(t *testing.T, machineName string, source string, hazards Hazards, timing *machines.Timing) (*Pipeline, machines.Machine) {
+	program, err := assembler.Assemble(source, assembler.Targets[machineName])
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := machines.New(machineName, strings.NewReader(""), &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machine.SetTiming(timing))
+	assert.NoError(t, machines.LoadWords(machine, program.Words))
+
+	pipeline, err := New(program.Target, hazards)
+	assert.NoError(t, err)
+	machine.SetWatch(pipeline.Watch)
+	assert.NoError(t, machine.Run(999))
+	return pipeline, machine
+}
+
+func Test_Pipeline(t *testing.T) {
+	testCases := map[Hazards]struct {
+		stalls, cycles int
+	}{
+		// every value loaded or added is needed by the next instruction, one
+		// cycle late when forwarded from MEM, two when read back from WB
+		Forward: {stalls: 4, cycles: 25},
+		Stall:   {stalls: 8, cycles: 29},
+	}
+
+	for hazards, testCase := range testCases {
+		pipeline, machine := runPipeline(t, "apache8", countdown, hazards, nil)
+		assert.True(t, machine.Halted(), hazards)
+		assert.Equal(t, 13, pipeline.Instructions, hazards)
+		assert.Equal(t, testCase.stalls, pipeline.Stalls, hazards)
+		// the two JUMP loop flush 1 cycle each, the taken JUMP R0 IF flushes 2
+		assert.Equal(t, 4, pipeline.Flushes, hazards)
+		assert.Equal(t, testCase.cycles, pipeline.Cycles(), hazards)
+		assert.Equal(t, pipeline.Instructions+len(Stages)-1+pipeline.Stalls+pipeline.Flushes, pipeline.Cycles(), hazards)
+		assert.Equal(t, machine.Instructions(), pipeline.Instructions, hazards)
+	}
+}
+
+func Test_Pipeline_Registers(t *testing.T) {
+	// only the instructions reading R2 wait for the DIV
+	source := `
+        DIV R2 one
+        NOT R3
+        NOT R2
+        STOP
+one:    .data 1
+`
+	pipeline, _ := runPipeline(t, "apache16", source, Forward, nil)
+	assert.Equal(t, 0, pipeline.Stalls)
+
+	source = `
+        DIV R2 one
+        NOT R2
+        STOP
+one:    .data 1
+`
+	pipeline, _ = runPipeline(t, "apache16", source, Forward, nil)
+	assert.Equal(t, 1, pipeline.Stalls)
+	assert.Equal(t, 3+4+1, pipeline.Cycles())
+}
+
+func Test_Pipeline_Report(t *testing.T) {
+	pipeline, machine := runPipeline(t, "apache8", countdown, Forward, machines.ClassicTiming)
+
+	// LOAD 4, three times ADD 5 STORE 4 JUMP R0 IF 2, twice JUMP 2, STOP 2
+	assert.Equal(t, 43, machine.Cycles())
+
+	var sb strings.Builder
+	assert.NoError(t, pipeline.Report(&sb, machine))
+	assert.Equal(t, `pipeline, hazards forward
+                       cycles      CPI
+pipelined                  25     1.92
+machine, classic           43     3.31
+13 instructions, 4 stall cycles, 4 flush cycles
+`, sb.String())
+}
+
+func Test_ParseHazards(t *testing.T) {
+	for _, hazards := range []Hazards{Stall, Forward} {
+		parsed, err := ParseHazards(hazards.String())
+		assert.NoError(t, err)
+		assert.Equal(t, hazards, parsed)
+	}
+
+	_, err := ParseHazards("predict")
+	assert.EqualError(t, err, `unknown hazard handling "predict", use stall or forward`)
+
+	_, err = New(&assembler.Target{Name: "apache32"}, Forward)
+	assert.EqualError(t, err, "no pipeline for machine: apache32")
+}
@@ -0,0 +1,32 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"apache-instruction-set-simulator/machines"
+)
+
+// Report writes the cycles of the pipelined run next to the ones the machine
+// that executed the same instructions counted under its timing
+//
+//	pipeline, hazards forward
+//	                       cycles      CPI
+//	pipelined                  25     1.92
+//	machine, classic           43     3.31
+//	13 instructions, 4 stall cycles, 4 flush cycles
+func (p *Pipeline) Report(w io.Writer, machine machines.Machine) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "pipeline, hazards %s\n", p.Hazards)
+	fmt.Fprintf(&sb, "%-18s %10s %8s\n", "", "cycles", "CPI")
+	fmt.Fprintf(&sb, "%-18s %10d %8.2f\n", "pipelined", p.Cycles(), p.CPI())
+	cpi := 0.0
+	if machine.Instructions() > 0 {
+		cpi = float64(machine.Cycles()) / float64(machine.Instructions())
+	}
+	fmt.Fprintf(&sb, "%-18s %10d %8.2f\n", "machine, "+machine.Timing().Name, machine.Cycles(), cpi)
+	fmt.Fprintf(&sb, "%d instructions, %d stall cycles, %d flush cycles\n", p.Instructions, p.Stalls, p.Flushes)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
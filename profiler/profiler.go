@@ -0,0 +1,88 @@
+package profiler
+
+import (
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+// Branch counts the outcomes of a conditional jump
+type Branch struct {
+	Taken    int
+	NotTaken int
+}
+
+// TakenRatio is the share of executions that jumped, 0 when it never ran
+func (b Branch) TakenRatio() float64 {
+	if b.Taken+b.NotTaken == 0 {
+		return 0
+	}
+	return float64(b.Taken) / float64(b.Taken+b.NotTaken)
+}
+
+// Profile counts what a program executed, set its Watch on a machine to
+// profile Run
+type Profile struct {
+	Target       *assembler.Target
+	Instructions int                // executed in total
+	Cycles       int                // clock cycles spent in total, as priced by the machine timing
+	Opcodes      map[string]int     // executions by mnemonic, as in the target table ("ADD R0", "ADD RX"), "?" for unknown opcodes
+	OpcodeCycles map[string]int     // clock cycles by mnemonic
+	Addresses    map[uint16]int     // executions by address
+	Costs        map[uint16]int     // clock cycles by address
+	Branches     map[uint16]*Branch // outcomes of the conditional jumps by address
+	entries      map[uint16]bool    // addresses reached by a jump, they start a basic block
+}
+
+func New(target *assembler.Target) *Profile {
+	return &Profile{
+		Target:       target,
+		Opcodes:      map[string]int{},
+		OpcodeCycles: map[string]int{},
+		Addresses:    map[uint16]int{},
+		Costs:        map[uint16]int{},
+		Branches:     map[uint16]*Branch{},
+		entries:      map[uint16]bool{},
+	}
+}
+
+// Record counts one executed instruction, one that faulted counts as it
+// started, one that could not be fetched never ran
+func (p *Profile) Record(result machines.StepResult) {
+	if !result.Fetched() {
+		return
+	}
+	p.Instructions++
+	p.Cycles += result.Cycles
+	p.Addresses[result.PCBefore]++
+	p.Costs[result.PCBefore] += result.Cycles
+	instruction, _, operand, ok := p.Target.Decode(result.CIR)
+	if !ok {
+		p.Opcodes["?"]++
+		p.OpcodeCycles["?"] += result.Cycles
+		return
+	}
+	p.Opcodes[instruction.Mnemonic]++
+	p.OpcodeCycles[instruction.Mnemonic] += result.Cycles
+	if result.PCAfter != result.PCBefore+1 && !result.Halted {
+		p.entries[result.PCAfter] = true
+	}
+	if instruction.Flow != assembler.FlowBranch {
+		return
+	}
+	branch, ok := p.Branches[result.PCBefore]
+	if !ok {
+		branch = &Branch{}
+		p.Branches[result.PCBefore] = branch
+	}
+	if result.PCAfter == operand {
+		branch.Taken++
+	} else {
+		branch.NotTaken++
+	}
+}
+
+// Watch profiles without ever pausing the program
+func (p *Profile) Watch(result machines.StepResult) (string, bool) {
+	p.Record(result)
+	return "", false
+}
@@ -0,0 +1,101 @@
+package profiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/utils"
+)
+
+// the count stays in memory, the loop runs on R0
+const countdown = `
+        LOAD R0 count
+loop:   ADD R0 minus
+        JUMP R0 IF done
+        JUMP loop
+done:   OUT R0
+        STOP
+count:  .data 3
+minus:  .data -1
+`
+
+func profileCountdown(t *testing.T) (*Profile, []disassembler.Line) {
+	program, err := assembler.Assemble(countdown, assembler.Targets["apache8"])
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := machines.New("apache8", strings.NewReader(""), &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machines.LoadWords(machine, program.Words))
+
+	assert.NoError(t, machine.SetTiming(machines.ClassicTiming))
+
+	profile := New(program.Target)
+	machine.SetWatch(profile.Watch)
+	assert.NoError(t, machine.Run(999))
+
+	lines, err := disassembler.FromMachine(machine, program.Target)
+	assert.NoError(t, err)
+	return profile, lines
+}
+
+func Test_Profile(t *testing.T) {
+	profile, lines := profileCountdown(t)
+
+	assert.Equal(t, 11, profile.Instructions)
+	assert.Equal(t, 41, profile.Cycles)
+	assert.Equal(t, map[string]int{"LOAD R0": 1, "ADD R0": 3, "JUMP R0 IF": 3, "JUMP": 2, "OUT R0": 1, "STOP": 1}, profile.Opcodes)
+	assert.Equal(t, map[string]int{"LOAD R0": 4, "ADD R0": 15, "JUMP R0 IF": 6, "JUMP": 4, "OUT R0": 10, "STOP": 2}, profile.OpcodeCycles)
+	assert.Equal(t, map[uint16]int{0: 1, 1: 3, 2: 3, 3: 2, 4: 1, 5: 1}, profile.Addresses)
+	assert.Equal(t, map[uint16]int{0: 4, 1: 15, 2: 6, 3: 4, 4: 10, 5: 2}, profile.Costs)
+	assert.Equal(t, map[uint16]*Branch{2: {Taken: 1, NotTaken: 2}}, profile.Branches)
+	assert.InDelta(t, 1.0/3, profile.Branches[2].TakenRatio(), 1e-9)
+
+	assert.Equal(t, []Block{
+		{Start: 0, End: 0, Runs: 1, Instructions: 1, Cycles: 4},
+		{Start: 1, End: 2, Runs: 3, Instructions: 6, Cycles: 21},
+		{Start: 3, End: 3, Runs: 2, Instructions: 2, Cycles: 4},
+		{Start: 4, End: 5, Runs: 1, Instructions: 2, Cycles: 12},
+	}, profile.Blocks(lines))
+}
+
+func Test_Profile_Report(t *testing.T) {
+	profile, lines := profileCountdown(t)
+
+	var sb strings.Builder
+	assert.NoError(t, profile.Report(&sb, lines))
+	assert.Equal(t, `11 instructions, 41 cycles
+
+opcode            count       %   cycles
+ADD R0                3   27.3%       15
+JUMP R0 IF            3   27.3%        6
+JUMP                  2   18.2%        4
+LOAD R0               1    9.1%        4
+OUT R0                1    9.1%       10
+STOP                  1    9.1%        2
+
+branch                    taken not taken  taken%
+0002  JUMP R0 IF 4            1         2   33.3%
+
+block        runs    count       %   cycles
+0001-0002       3        6   54.5%       21
+0003-0003       2        2   18.2%        4
+0004-0005       1        2   18.2%       12
+0000-0000       1        1    9.1%        4
+
+   count       %  listing
+       1    9.1%  0000  0000 0110  LOAD R0 6
+       3   27.3%  0001  0011 0111  ADD R0 7
+       3   27.3%  0002  0010 0100  JUMP R0 IF 4
+       2   18.2%  0003  0110 0001  JUMP 1
+       1    9.1%  0004  1110 0000  OUT R0
+       1    9.1%  0005  0111 0000  STOP
+                  0006  0000 0011  LOAD R0 3      ; data 3, referenced
+                  0007  1111 1111  IN 15          ; data 255 (-1), referenced
+`, sb.String())
+}
@@ -0,0 +1,139 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+)
+
+// Block is a basic block, straight line code entered at Start only
+type Block struct {
+	Start, End   uint16 // End is the last address in the block
+	Runs         int    // times the block was entered
+	Instructions int    // instructions executed inside the block
+	Cycles       int    // clock cycles spent inside the block
+}
+
+// Blocks splits a listing into basic blocks, they start at address 0, at jump
+// targets and after jumps and STOP, words guessed as data that never ran are
+// left out
+func (p *Profile) Blocks(lines []disassembler.Line) []Block {
+	leaders := map[uint16]bool{0: true}
+	for address := range p.entries {
+		leaders[address] = true
+	}
+	for _, line := range lines {
+		instruction, _, operand, ok := p.Target.Decode(line.Word)
+		if !ok || !p.code(line) {
+			continue
+		}
+		switch instruction.Flow {
+		case assembler.FlowJump, assembler.FlowBranch:
+			leaders[operand] = true
+			leaders[line.Address+1] = true
+		case assembler.FlowStop:
+			leaders[line.Address+1] = true
+		}
+	}
+
+	var blocks []Block
+	for _, line := range lines {
+		if !p.code(line) {
+			continue
+		}
+		last := len(blocks) - 1
+		if leaders[line.Address] || last < 0 || blocks[last].End != line.Address-1 {
+			blocks = append(blocks, Block{Start: line.Address, Runs: p.Addresses[line.Address]})
+			last++
+		}
+		blocks[last].End = line.Address
+		blocks[last].Instructions += p.Addresses[line.Address]
+		blocks[last].Cycles += p.Costs[line.Address]
+	}
+	return blocks
+}
+
+// code tells whether a line is worth profiling, it is reachable or it ran
+func (p *Profile) code(line disassembler.Line) bool {
+	return !line.Data || p.Addresses[line.Address] > 0
+}
+
+// Report writes the opcode histogram with the cycles of every opcode, the
+// branch outcomes, the basic blocks from the hottest down and the listing annotated with the count of every
+// address, the zero words at the end of memory nothing used are left out
+func (p *Profile) Report(w io.Writer, lines []disassembler.Line) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d instructions, %d cycles\n", p.Instructions, p.Cycles)
+
+	fmt.Fprintf(&sb, "\n%-14s %8s %7s %8s\n", "opcode", "count", "%", "cycles")
+	mnemonics := make([]string, 0, len(p.Opcodes))
+	for mnemonic := range p.Opcodes {
+		mnemonics = append(mnemonics, mnemonic)
+	}
+	sort.Slice(mnemonics, func(i, j int) bool {
+		a, b := mnemonics[i], mnemonics[j]
+		return p.Opcodes[a] > p.Opcodes[b] || p.Opcodes[a] == p.Opcodes[b] && a < b
+	})
+	for _, mnemonic := range mnemonics {
+		fmt.Fprintf(&sb, "%-14s %8d %7s %8d\n", mnemonic, p.Opcodes[mnemonic], p.percent(p.Opcodes[mnemonic]), p.OpcodeCycles[mnemonic])
+	}
+
+	if len(p.Branches) > 0 {
+		fmt.Fprintf(&sb, "\n%-22s %8s %9s %7s\n", "branch", "taken", "not taken", "taken%")
+		addresses := make([]int, 0, len(p.Branches))
+		for address := range p.Branches {
+			addresses = append(addresses, int(address))
+		}
+		sort.Ints(addresses)
+		for _, address := range addresses {
+			branch := p.Branches[uint16(address)]
+			fmt.Fprintf(&sb, "%04d  %-16s %8d %9d %6.1f%%\n", address, instructionAt(lines, uint16(address)), branch.Taken, branch.NotTaken, 100*branch.TakenRatio())
+		}
+	}
+
+	blocks := p.Blocks(lines)
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Instructions > blocks[j].Instructions })
+	fmt.Fprintf(&sb, "\n%-10s %6s %8s %7s %8s\n", "block", "runs", "count", "%", "cycles")
+	for _, block := range blocks {
+		fmt.Fprintf(&sb, "%04d-%04d  %6d %8d %7s %8d\n", block.Start, block.End, block.Runs, block.Instructions, p.percent(block.Instructions), block.Cycles)
+	}
+
+	fmt.Fprintf(&sb, "\n%8s %7s  listing\n", "count", "%")
+	end := len(lines)
+	for end > 0 && !p.code(lines[end-1]) && !lines[end-1].Referenced && lines[end-1].Word == 0 {
+		end--
+	}
+	for _, line := range lines[:end] {
+		var listing strings.Builder
+		if err := disassembler.Format(&listing, []disassembler.Line{line}); err != nil {
+			return err
+		}
+		count := p.Addresses[line.Address]
+		if count == 0 {
+			fmt.Fprintf(&sb, "%8s %7s  %s", "", "", listing.String())
+			continue
+		}
+		fmt.Fprintf(&sb, "%8d %7s  %s", count, p.percent(count), listing.String())
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (p *Profile) percent(count int) string {
+	if p.Instructions == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(count)/float64(p.Instructions))
+}
+
+func instructionAt(lines []disassembler.Line, address uint16) string {
+	if int(address) < len(lines) {
+		return lines[address].Instruction
+	}
+	return "?"
+}
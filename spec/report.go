@@ -0,0 +1,125 @@
+package spec
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Summary writes a line per case and the counts, failed cases are followed by
+// what went wrong
+//
+//	PASS  programs/sum.test.yaml  25 plus 25
+//	FAIL  programs/sub.test.yaml  99 minus 33
+//	      output: expected "66\n", got "65\n"
+//	1 passed, 1 failed
+func Summary(w io.Writer, results []Result) error {
+	passed := 0
+	for _, result := range results {
+		status := "FAIL"
+		if result.Passed() {
+			status = "PASS"
+			passed++
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s  %s\n", status, result.File.Path, result.Case.Name); err != nil {
+			return err
+		}
+		for _, message := range result.messages() {
+			if _, err := fmt.Fprintf(w, "      %s\n", message); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d passed, %d failed\n", passed, len(results)-passed)
+	return err
+}
+
+func (r *Result) messages() []string {
+	if r.Err != nil {
+		return []string{r.Err.Error()}
+	}
+	return r.Failures
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as JUnit XML, a testsuite per spec file, checks
+// that did not hold are failures and runs that could not finish are errors
+func WriteJUnit(w io.Writer, results []Result) error {
+	suites := junitSuites{}
+	var total time.Duration
+	suiteTimes := []time.Duration{}
+	for _, result := range results {
+		if len(suites.Suites) == 0 || suites.Suites[len(suites.Suites)-1].Name != result.File.Path {
+			suites.Suites = append(suites.Suites, junitSuite{Name: result.File.Path})
+			suiteTimes = append(suiteTimes, 0)
+		}
+		suite := &suites.Suites[len(suites.Suites)-1]
+		testCase := junitCase{Name: result.Case.Name, ClassName: result.File.Path, Time: seconds(result.Time)}
+		if result.Err != nil {
+			testCase.Error = &junitProblem{Message: result.Err.Error(), Text: result.Err.Error()}
+			suite.Errors++
+		} else if len(result.Failures) > 0 {
+			testCase.Failure = &junitProblem{Message: result.Failures[0], Text: strings.Join(result.Failures, "\n")}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+		suiteTimes[len(suiteTimes)-1] += result.Time
+		total += result.Time
+	}
+	for idx := range suites.Suites {
+		suite := &suites.Suites[idx]
+		suite.Time = seconds(suiteTimes[idx])
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+	}
+	suites.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
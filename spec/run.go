@@ -0,0 +1,135 @@
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/disassembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+// Result is how a case went, it passed when it neither failed a check nor
+// errored
+type Result struct {
+	File     *File
+	Case     *Case
+	Failures []string // checks the run did not meet
+	Err      error    // the program could not be loaded or the run failed
+	Time     time.Duration
+}
+
+// Passed tells whether every check of the case held
+func (r *Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// Run runs every case of a spec, each on a fresh machine
+func Run(file *File) []Result {
+	words, err := loadProgram(file)
+	results := make([]Result, len(file.Cases))
+	for idx := range file.Cases {
+		results[idx] = Result{File: file, Case: &file.Cases[idx], Err: err}
+		if err == nil {
+			start := time.Now()
+			results[idx].Failures, results[idx].Err = runCase(file, &file.Cases[idx], words)
+			results[idx].Time = time.Since(start)
+		}
+	}
+	return results
+}
+
+// RunPath loads the spec at path and runs it, a spec that can not be loaded
+// gives a single errored case so the specs after it still run
+func RunPath(path string) []Result {
+	file, err := Load(path)
+	if err != nil {
+		return []Result{{File: &File{Path: path}, Case: &Case{Name: "load"}, Err: err}}
+	}
+	return Run(file)
+}
+
+// loadProgram reads the image of a spec or assembles its .masic source
+func loadProgram(file *File) ([]uint16, error) {
+	target := assembler.Targets[file.Machine]
+	path := filepath.Join(filepath.Dir(file.Path), file.Program)
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".masic" {
+		program, err := assembler.Assemble(string(text), target)
+		if err != nil {
+			return nil, err
+		}
+		return program.Words, nil
+	}
+	return disassembler.ParseImage(string(text), target)
+}
+
+func runCase(file *File, testCase *Case, words []uint16) ([]string, error) {
+	input := ""
+	if len(testCase.Input) > 0 {
+		input = strings.Join(testCase.Input, "\n") + "\n"
+	}
+	var out bytes.Buffer
+	machine, err := machines.New(file.Machine, strings.NewReader(input), &out)
+	if err != nil {
+		return nil, err
+	}
+	if err := machines.LoadWords(machine, words); err != nil {
+		return nil, err
+	}
+	if err := machine.Run(testCase.Cycles); err != nil {
+		return nil, err
+	}
+
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+	expected := ""
+	if len(testCase.Output) > 0 {
+		expected = strings.Join(testCase.Output, "\n") + "\n"
+	}
+	if output := strings.ReplaceAll(out.String(), "> ", ""); output != expected {
+		fail("output: expected %q, got %q", expected, output)
+	}
+	if testCase.Halted != nil && *testCase.Halted != machine.Halted() {
+		fail("halted: expected %t, got %t", *testCase.Halted, machine.Halted())
+	}
+	if testCase.Registers != nil && !equalWords(testCase.Registers, machine.Registers()) {
+		fail("registers: expected %v, got %v", testCase.Registers, machine.Registers())
+	}
+	addresses := make([]int, 0, len(testCase.Memory))
+	for idx := range testCase.Memory {
+		addresses = append(addresses, int(idx))
+	}
+	sort.Ints(addresses)
+	for _, idx := range addresses {
+		word, err := machine.ReadMemory(uint16(idx))
+		if err != nil {
+			fail("memory[%d]: %v", idx, err)
+		} else if word != testCase.Memory[uint16(idx)] {
+			fail("memory[%d]: expected %d, got %d", idx, testCase.Memory[uint16(idx)], word)
+		}
+	}
+	return failures, nil
+}
+
+func equalWords(expected []uint16, actual []uint16) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for idx := range expected {
+		if expected[idx] != actual[idx] {
+			return false
+		}
+	}
+	return true
+}
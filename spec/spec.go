@@ -0,0 +1,127 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"apache-instruction-set-simulator/assembler"
+)
+
+// Suffixes name the spec files Discover picks up, a spec sits next to the
+// program it tests, sum.test.yaml for sum.txt
+var Suffixes = []string{".test.yaml", ".test.yml", ".test.json"}
+
+// DefaultCycles is the budget of a case that gives none
+const DefaultCycles = 1000
+
+// File is a spec file, every case runs the same program on a fresh machine
+type File struct {
+	Path    string `yaml:"-" json:"-"`
+	Program string `yaml:"program" json:"program"` // an image or a .masic source, relative to the spec
+	Machine string `yaml:"machine" json:"machine"` // apache8 when left out
+	Cases   []Case `yaml:"cases" json:"cases"`
+}
+
+// Case is a run of the program and what it has to leave behind, halted,
+// registers and memory are only checked when given
+type Case struct {
+	Name      string            `yaml:"name" json:"name"`
+	Input     []string          `yaml:"input" json:"input"`   // lines IN reads
+	Output    []string          `yaml:"output" json:"output"` // lines OUT prints, the "> " prompts of IN left out
+	Cycles    int               `yaml:"cycles" json:"cycles"`
+	Halted    *bool             `yaml:"halted" json:"halted"`
+	Registers []uint16          `yaml:"registers" json:"registers"`
+	Memory    map[uint16]uint16 `yaml:"memory" json:"memory"` // words by address
+}
+
+// Load reads a spec, JSON when the name ends in .json and YAML otherwise,
+// unknown fields are refused so a typo does not skip a check
+func Load(path string) (*File, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Path: path}
+	if filepath.Ext(path) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(file)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(text))
+		decoder.KnownFields(true)
+		err = decoder.Decode(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("spec %s: %w", path, err)
+	}
+
+	if file.Program == "" {
+		return nil, fmt.Errorf("spec %s: no program", path)
+	}
+	if file.Machine == "" {
+		file.Machine = "apache8"
+	}
+	if _, ok := assembler.Targets[file.Machine]; !ok {
+		return nil, fmt.Errorf("spec %s: no assembler target for machine: %s", path, file.Machine)
+	}
+	if len(file.Cases) == 0 {
+		return nil, fmt.Errorf("spec %s: no cases", path)
+	}
+	for idx := range file.Cases {
+		testCase := &file.Cases[idx]
+		if testCase.Name == "" {
+			testCase.Name = fmt.Sprintf("case %d", idx+1)
+		}
+		if testCase.Cycles == 0 {
+			testCase.Cycles = DefaultCycles
+		}
+		if testCase.Cycles < 0 {
+			return nil, fmt.Errorf("spec %s: case %q runs %d cycles", path, testCase.Name, testCase.Cycles)
+		}
+	}
+	return file, nil
+}
+
+// Discover lists the spec files under paths in name order, a directory gives
+// the files in it ending in one of the Suffixes, a file is taken as it is
+func Discover(paths ...string) ([]string, error) {
+	var found []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			found = append(found, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isSpec(entry.Name()) {
+				found = append(found, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+func isSpec(name string) bool {
+	for _, suffix := range Suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
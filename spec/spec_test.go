@@ -0,0 +1,173 @@
+package spec
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSpec writes sum.txt (IN 6, IN 7, ADD R0 6, ADD R0 7, OUT R0, STOP) and
+// a spec named name next to it
+func writeSpec(t *testing.T, name string, text string) string {
+	dir := t.TempDir()
+	image := "1111 0110\n1111 0111\n0011 0110\n0011 0111\n1110 0000\n0111 0000\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sum.txt"), []byte(image), 0644))
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, []byte(text), 0644))
+	return path
+}
+
+func Test_Load(t *testing.T) {
+	testCases := map[string]string{
+		"sum.test.yaml": "program: sum.txt\ncases:\n  - input: [\"1\", \"2\"]\n    output: [\"3\"]\n",
+		"sum.test.json": `{"program": "sum.txt", "cases": [{"input": ["1", "2"], "output": ["3"]}]}`,
+	}
+
+	for name, text := range testCases {
+		file, err := Load(writeSpec(t, name, text))
+		assert.NoError(t, err, name)
+		assert.Equal(t, "apache8", file.Machine, name)
+		assert.Equal(t, []Case{{Name: "case 1", Input: []string{"1", "2"}, Output: []string{"3"}, Cycles: DefaultCycles}}, file.Cases, name)
+	}
+}
+
+func Test_Load_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		name, text, expected string
+	}{
+		"unknown field": {
+			name:     "sum.test.yaml",
+			text:     "program: sum.txt\ncases:\n  - outptu: [\"3\"]\n",
+			expected: "field outptu not found",
+		},
+		"unknown json field": {
+			name:     "sum.test.json",
+			text:     `{"program": "sum.txt", "cases": [{"outptu": ["3"]}]}`,
+			expected: `unknown field "outptu"`,
+		},
+		"no program": {
+			name:     "sum.test.yaml",
+			text:     "cases:\n  - output: [\"3\"]\n",
+			expected: "no program",
+		},
+		"no cases": {
+			name:     "sum.test.yaml",
+			text:     "program: sum.txt\n",
+			expected: "no cases",
+		},
+		"unknown machine": {
+			name:     "sum.test.yaml",
+			text:     "program: sum.txt\nmachine: apache32\ncases:\n  - output: []\n",
+			expected: "no assembler target for machine: apache32",
+		},
+		"negative cycles": {
+			name:     "sum.test.yaml",
+			text:     "program: sum.txt\ncases:\n  - name: back\n    cycles: -1\n",
+			expected: `case "back" runs -1 cycles`,
+		},
+	}
+
+	for name, testCase := range testCases {
+		_, err := Load(writeSpec(t, testCase.name, testCase.text))
+		assert.ErrorContains(t, err, testCase.expected, name)
+	}
+}
+
+func Test_Discover(t *testing.T) {
+	path := writeSpec(t, "sum.test.yml", "")
+	dir := filepath.Dir(path)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.test.json"), nil, 0644))
+
+	found, err := Discover(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "a.test.json"), path}, found)
+
+	found, err = Discover(filepath.Join(dir, "sum.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "sum.txt")}, found)
+
+	_, err = Discover(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func Test_Run(t *testing.T) {
+	file, err := Load(writeSpec(t, "sum.test.yaml", `program: sum.txt
+cases:
+  - name: passes
+    input: ["1", "2"]
+    output: ["3"]
+    halted: true
+    registers: [3, 0]
+    memory: {6: 1, 7: 2}
+  - name: fails
+    input: ["1", "2"]
+    output: ["4"]
+    cycles: 3
+    halted: true
+    registers: [4, 0]
+    memory: {7: 3, 6: 2, 16: 0}
+  - name: errors
+    input: ["1"]
+`))
+	assert.NoError(t, err)
+
+	results := Run(file)
+	assert.Len(t, results, 3)
+	assert.True(t, results[0].Passed())
+
+	assert.False(t, results[1].Passed())
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, []string{
+		`output: expected "4\n", got ""`,
+		"halted: expected true, got false",
+		"registers: expected [4 0], got [1 0]",
+		"memory[6]: expected 2, got 1",
+		"memory[7]: expected 3, got 2",
+		"memory[16]: memory overflow, idx: 16, size: 16",
+	}, results[1].Failures)
+
+	assert.Error(t, results[2].Err)
+	assert.False(t, results[2].Passed())
+
+	// a program that can not be loaded errors every case
+	file.Program = "missing.txt"
+	for _, result := range Run(file) {
+		assert.ErrorIs(t, result.Err, os.ErrNotExist)
+	}
+}
+
+func Test_Report(t *testing.T) {
+	file, err := Load(writeSpec(t, "sum.test.yaml", "program: sum.txt\ncases:\n  - name: passes\n    input: [\"1\", \"2\"]\n    output: [\"3\"]\n  - name: fails\n    input: [\"1\", \"2\"]\n    output: [\"4\"]\n"))
+	assert.NoError(t, err)
+	results := Run(file)
+
+	var summary bytes.Buffer
+	assert.NoError(t, Summary(&summary, results))
+	assert.Equal(t, "PASS  "+file.Path+"  passes\nFAIL  "+file.Path+"  fails\n      output: expected \"4\\n\", got \"3\\n\"\n1 passed, 1 failed\n", summary.String())
+
+	var junit bytes.Buffer
+	assert.NoError(t, WriteJUnit(&junit, results))
+	assert.True(t, strings.HasPrefix(junit.String(), `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<testsuites tests="2" failures="1" errors="0"`))
+	assert.Contains(t, junit.String(), `<testsuite name="`+file.Path+`" tests="2" failures="1" errors="0"`)
+	assert.Contains(t, junit.String(), `<failure message="output: expected &#34;4\n&#34;, got &#34;3\n&#34;">`)
+}
+
+func Test_RunPath(t *testing.T) {
+	path := writeSpec(t, "sum.test.yaml", "program: sum.txt\ncases:\n  - input: [\"1\", \"2\"]\n    output: [\"3\"]\n    registers: [3]\n")
+	results := RunPath(path)
+	assert.Len(t, results, 1)
+	assert.Equal(t, []string{"registers: expected [3], got [3 0]"}, results[0].Failures)
+
+	// a spec that does not load is an errored case of its own
+	bad := filepath.Join(filepath.Dir(path), "bad.test.yaml")
+	assert.NoError(t, os.WriteFile(bad, []byte("cases: [\n"), 0644))
+	results = RunPath(bad)
+	assert.Len(t, results, 1)
+	assert.Equal(t, bad, results[0].File.Path)
+	assert.Equal(t, "load", results[0].Case.Name)
+	assert.ErrorContains(t, results[0].Err, "spec "+bad)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"apache-instruction-set-simulator/spec"
+)
+
+// test [-junit file] [spec or directory ...], the specs in programs when none is given
+func testCommand(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	junitName := flags.String("junit", "", "file to write the results to as JUnit XML")
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"programs"}
+	}
+	names, err := spec.Discover(paths...)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no spec files found in %v", paths)
+	}
+
+	var results []spec.Result
+	for _, name := range names {
+		results = append(results, spec.RunPath(name)...)
+	}
+
+	if err := spec.Summary(os.Stdout, results); err != nil {
+		return err
+	}
+	if *junitName != "" {
+		if err := writeJUnit(results, *junitName); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for idx := range results {
+		if !results[idx].Passed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(results))
+	}
+	return nil
+}
+
+func writeJUnit(results []spec.Result, junitName string) error {
+	file, err := os.Create(junitName)
+	if err != nil {
+		return err
+	}
+	if err := spec.WriteJUnit(file, results); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
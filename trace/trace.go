@@ -0,0 +1,160 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+)
+
+// Format picks how records are written
+type Format int
+
+const (
+	JSONLines Format = iota // one JSON object per line, for tools and diffs
+	Text                    // one aligned line per instruction, for people
+)
+
+var formats = []string{"json", "text"}
+
+func (f Format) String() string {
+	return formats[f]
+}
+
+// ParseFormat reads the names printed by Format.String
+func ParseFormat(name string) (Format, error) {
+	for idx, format := range formats {
+		if format == name {
+			return Format(idx), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown trace format %q, use %s", name, strings.Join(formats, " or "))
+}
+
+// Record is one executed instruction
+type Record struct {
+	Instruction int                     `json:"instruction"` // 1 for the first instruction traced
+	Cycle       int                     `json:"cycle"`       // clock cycles from the start of the trace to the end of the instruction
+	PC          uint16                  `json:"pc"`
+	NextPC      uint16                  `json:"next_pc"`
+	CIR         uint16                  `json:"cir"`
+	Mnemonic    string                  `json:"mnemonic"` // e.g. "ADD R0 15", "?" for unknown opcodes
+	Before      []uint16                `json:"before"`   // registers before the instruction
+	After       []uint16                `json:"after"`    // registers after the instruction
+	Reads       []machines.MemoryAccess `json:"reads,omitempty"`
+	Writes      []machines.MemoryAccess `json:"writes,omitempty"`
+	Input       bool                    `json:"input,omitempty"`
+	Output      bool                    `json:"output,omitempty"`
+	Halted      bool                    `json:"halted,omitempty"`
+	Fault       string                  `json:"fault,omitempty"` // error the instruction stopped with
+}
+
+// NewRecord decodes what a step did, cycle is the clock when it ended, an
+// instruction that could not be fetched has no mnemonic
+func NewRecord(number int, cycle int, result machines.StepResult, target *assembler.Target) Record {
+	mnemonic := "?"
+	if instruction, register, operand, ok := target.Decode(result.CIR); !result.Fetched() {
+		mnemonic = ""
+	} else if ok {
+		mnemonic = target.Text(instruction, register, operand)
+	}
+	fault := ""
+	if result.Fault != nil {
+		fault = result.Fault.Error()
+	}
+	return Record{
+		Instruction: number,
+		Cycle:       cycle,
+		PC:          result.PCBefore,
+		NextPC:      result.PCAfter,
+		CIR:         result.CIR,
+		Mnemonic:    mnemonic,
+		Before:      result.RegistersBefore,
+		After:       result.RegistersAfter,
+		Reads:       result.Reads,
+		Writes:      result.Writes,
+		Input:       result.Input,
+		Output:      result.Output,
+		Halted:      result.Halted,
+		Fault:       fault,
+	}
+}
+
+// Writer writes a record for every instruction it is handed, set its Watch on a
+// machine to trace Run
+type Writer struct {
+	w      io.Writer
+	target *assembler.Target
+	format Format
+	count  int
+	cycles int
+}
+
+func NewWriter(w io.Writer, target *assembler.Target, format Format) *Writer {
+	return &Writer{w: w, target: target, format: format}
+}
+
+// Write numbers and writes the record of one step
+func (t *Writer) Write(result machines.StepResult) error {
+	t.count++
+	t.cycles += result.Cycles
+	record := NewRecord(t.count, t.cycles, result, t.target)
+	if t.format == Text {
+		_, err := fmt.Fprintln(t.w, record.Text(t.target))
+		return err
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(t.w, "%s\n", line)
+	return err
+}
+
+// Watch traces without ever pausing the program, unless the trace can not be
+// written
+func (t *Writer) Watch(result machines.StepResult) (string, bool) {
+	if err := t.Write(result); err != nil {
+		return fmt.Sprintf("trace: %v", err), true
+	}
+	return "", false
+}
+
+// Text formats the record on one line, the instruction and cycle numbers first,
+// only what changed is listed
+//
+//	3      11  0002  0011 0110  ADD R0 6        R0 3 -> 7  read [6] 4
+func (r Record) Text(target *assembler.Target) string {
+	var effects []string
+	for idx := range r.After {
+		if idx < len(r.Before) && r.Before[idx] != r.After[idx] {
+			effects = append(effects, fmt.Sprintf("R%d %d -> %d", idx, r.Before[idx], r.After[idx]))
+		}
+	}
+	for _, read := range r.Reads {
+		effects = append(effects, fmt.Sprintf("read [%d] %d", read.Address, read.Value))
+	}
+	for _, write := range r.Writes {
+		effects = append(effects, fmt.Sprintf("write [%d] %d -> %d", write.Address, write.Previous, write.Value))
+	}
+	if r.NextPC != r.PC+1 && !r.Halted && r.Fault == "" {
+		effects = append(effects, fmt.Sprintf("jump %d", r.NextPC))
+	}
+	if r.Input {
+		effects = append(effects, "input")
+	}
+	if r.Output {
+		effects = append(effects, "output")
+	}
+	if r.Halted {
+		effects = append(effects, "halted")
+	}
+	if r.Fault != "" {
+		effects = append(effects, "fault: "+r.Fault)
+	}
+	line := fmt.Sprintf("%6d  %6d  %04d  %s  %-14s %s", r.Instruction, r.Cycle, r.PC, target.FormatWord(r.CIR), r.Mnemonic, strings.Join(effects, "  "))
+	return strings.TrimRight(line, " ")
+}
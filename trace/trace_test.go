@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"apache-instruction-set-simulator/assembler"
+	"apache-instruction-set-simulator/machines"
+	"apache-instruction-set-simulator/utils"
+)
+
+const double = `
+        LOAD R0 a
+        ADD R0 a
+        STORE R0 a
+        STOP
+a:      .data 3
+`
+
+func traceDouble(t *testing.T, format Format) string {
+	program, err := assembler.Assemble(double, assembler.Targets["apache8"])
+	assert.NoError(t, err)
+
+	out := utils.NewTestOutput()
+	machine, err := machines.New("apache8", strings.NewReader(""), &out)
+	assert.NoError(t, err)
+	assert.NoError(t, machine.SetTiming(machines.ClassicTiming))
+	assert.NoError(t, machines.LoadWords(machine, program.Words))
+
+	var sb strings.Builder
+	machine.SetWatch(NewWriter(&sb, program.Target, format).Watch)
+	assert.NoError(t, machine.Run(999))
+	return sb.String()
+}
+
+func Test_Writer(t *testing.T) {
+	// under classic timing LOAD takes 4 cycles, ADD 5, STORE 4 and STOP 2
+	testCases := map[Format]string{
+		JSONLines: `{"instruction":1,"cycle":4,"pc":0,"next_pc":1,"cir":4,"mnemonic":"LOAD R0 4","before":[0,0],"after":[3,0],"reads":[{"address":4,"value":3,"previous":3}]}` + "\n" +
+			`{"instruction":2,"cycle":9,"pc":1,"next_pc":2,"cir":52,"mnemonic":"ADD R0 4","before":[3,0],"after":[6,0],"reads":[{"address":4,"value":3,"previous":3}]}` + "\n" +
+			`{"instruction":3,"cycle":13,"pc":2,"next_pc":3,"cir":20,"mnemonic":"STORE R0 4","before":[6,0],"after":[6,0],"writes":[{"address":4,"value":6,"previous":3}]}` + "\n" +
+			`{"instruction":4,"cycle":15,"pc":3,"next_pc":4,"cir":112,"mnemonic":"STOP","before":[6,0],"after":[6,0],"halted":true}` + "\n",
+		Text: "     1       4  0000  0000 0100  LOAD R0 4      R0 0 -> 3  read [4] 3\n" +
+			"     2       9  0001  0011 0100  ADD R0 4       R0 3 -> 6  read [4] 3\n" +
+			"     3      13  0002  0001 0100  STORE R0 4     write [4] 3 -> 6\n" +
+			"     4      15  0003  0111 0000  STOP           halted\n",
+	}
+
+	for format, expected := range testCases {
+		t.Run(format.String(), func(t *testing.T) {
+			assert.Equal(t, expected, traceDouble(t, format))
+		})
+	}
+}
+
+func Test_ParseFormat(t *testing.T) {
+	format, err := ParseFormat("text")
+	assert.NoError(t, err)
+	assert.Equal(t, Text, format)
+
+	_, err = ParseFormat("xml")
+	assert.EqualError(t, err, `unknown trace format "xml", use json or text`)
+}
+
+func Test_Writer_Fault(t *testing.T) {
+	testCases := map[string]struct {
+		words    []uint16
+		input    string
+		expected string
+	}{
+		// IN 15, the input is not a number
+		"execute": {
+			words:    []uint16{0b1111_1111},
+			input:    "x\n",
+			expected: "     1       1  0000  1111 1111  IN 15          input  fault: invalid input \"x\" in base 10: strconv.ParseInt: parsing \"\": invalid syntax\n",
+		},
+		// JUMP 15, ..., NOT R1, the PC runs off the end of memory
+		"fetch": {
+			words: []uint16{0b0110_1111, 15: 0b1101_0000},
+			expected: "     1       1  0000  0110 1111  JUMP 15        jump 15\n" +
+				"     2       2  0015  1101 0000  NOT R1         R1 0 -> 255\n" +
+				"     3       2  0016  0000 0000                 fault: memory overflow, idx: 16, size: 16\n",
+		},
+	}
+
+	for name, testCase := range testCases {
+		out := utils.NewTestOutput()
+		machine, err := machines.New("apache8", strings.NewReader(testCase.input), &out)
+		assert.NoError(t, err, name)
+		assert.NoError(t, machines.LoadWords(machine, testCase.words), name)
+
+		var sb strings.Builder
+		machine.SetWatch(NewWriter(&sb, assembler.Targets["apache8"], Text).Watch)
+		assert.Error(t, machine.Run(999), name)
+		assert.Equal(t, testCase.expected, sb.String(), name)
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "fmt"
+
+// InputError is returned when a string can not be parsed into a number
+type InputError struct {
+	Value string
+	Base  int
+	Err   error
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("invalid input %q in base %d: %v", e.Value, e.Base, e.Err)
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// CastError is returned when a value does not hold the type it is cast to
+type CastError struct {
+	Value    interface{}
+	Expected string // name of the type it had to be
+}
+
+func (e *CastError) Error() string {
+	return fmt.Sprintf("casting %s error, val: %+v (%T)", e.Expected, e.Value, e.Value)
+}
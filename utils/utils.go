@@ -3,7 +3,6 @@ package utils
 import (
 	"bytes"
 	"io"
-	"log"
 	"os"
 	"regexp"
 	"strconv"
@@ -12,22 +11,21 @@ import (
 
 var nonNumericRegex = regexp.MustCompile(`[^0-9]+`)
 
-func CastStringToUint8(sVal string, base int) uint8 {
-	sVal = RemoveAllNonNumericFromString(sVal)
-	nVal, err := strconv.ParseInt(sVal, base, 64)
+func CastStringToUint8(sVal string, base int) (uint8, error) {
+	nVal, err := strconv.ParseInt(RemoveAllNonNumericFromString(sVal), base, 64)
 	if err != nil {
-		log.Fatalf("Parsing string to uint8 error: %+v", err)
+		return 0, &InputError{Value: sVal, Base: base, Err: err}
 	}
 
-	return uint8(nVal)
+	return uint8(nVal), nil
 }
 
-func CastInterfaceToUint8(iVal interface{}) uint8 {
+func CastInterfaceToUint8(iVal interface{}) (uint8, error) {
 	nVal, ok := iVal.(uint8)
 	if !ok {
-		log.Fatalf("Casting uint8 error, val: %+v", iVal)
+		return 0, &CastError{Value: iVal, Expected: "uint8"}
 	}
-	return nVal
+	return nVal, nil
 }
 
 func RemoveAllNonNumericFromString(sVal string) string {
@@ -62,20 +60,19 @@ func ClearOutputForTesting(sVal string) string {
 	return strings.Replace(sVal, "> ", "", 3)
 }
 
-func CastStringToUint16(sVal string, base int) uint16 {
-	sVal = RemoveAllNonNumericFromString(sVal)
-	nVal, err := strconv.ParseInt(sVal, base, 64)
+func CastStringToUint16(sVal string, base int) (uint16, error) {
+	nVal, err := strconv.ParseInt(RemoveAllNonNumericFromString(sVal), base, 64)
 	if err != nil {
-		log.Fatalf("Parsing string to uint16 error: %+v", err)
+		return 0, &InputError{Value: sVal, Base: base, Err: err}
 	}
 
-	return uint16(nVal)
+	return uint16(nVal), nil
 }
 
-func CastInterfaceToUint16(iVal interface{}) uint16 {
+func CastInterfaceToUint16(iVal interface{}) (uint16, error) {
 	nVal, ok := iVal.(uint16)
 	if !ok {
-		log.Fatalf("Casting uint16 error, val: %+v", iVal)
+		return 0, &CastError{Value: iVal, Expected: "uint16"}
 	}
-	return nVal
+	return nVal, nil
 }
@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,7 +30,8 @@ func Test_CastStringToUint8(t *testing.T) {
 
 	for name, testCase := range testCases {
 		t.Run(name, func(t *testing.T) {
-			val := CastStringToUint8(testCase.sVal, testCase.base)
+			val, err := CastStringToUint8(testCase.sVal, testCase.base)
+			assert.NoError(t, err)
 			assert.Equal(t, testCase.expected, val)
 		})
 	}
@@ -34,7 +39,8 @@ func Test_CastStringToUint8(t *testing.T) {
 
 func Test_CastInterfaceToUint8(t *testing.T) {
 	var i interface{} = uint8(100)
-	val := CastInterfaceToUint8(i)
+	val, err := CastInterfaceToUint8(i)
+	assert.NoError(t, err)
 	assert.Equal(t, uint8(100), val)
 }
 
@@ -79,7 +85,8 @@ func Test_CastStringToUint16(t *testing.T) {
 
 	for name, testCase := range testCases {
 		t.Run(name, func(t *testing.T) {
-			val := CastStringToUint16(testCase.sVal, testCase.base)
+			val, err := CastStringToUint16(testCase.sVal, testCase.base)
+			assert.NoError(t, err)
 			assert.Equal(t, testCase.expected, val)
 		})
 	}
@@ -87,6 +94,70 @@ func Test_CastStringToUint16(t *testing.T) {
 
 func Test_CastInterfaceToUint16(t *testing.T) {
 	var i interface{} = uint16(8772)
-	val := CastInterfaceToUint16(i)
+	val, err := CastInterfaceToUint16(i)
+	assert.NoError(t, err)
 	assert.Equal(t, uint16(8772), val)
 }
+
+func Test_Cast_Errors(t *testing.T) {
+	var inputErr *InputError
+
+	_, err := CastStringToUint8("> ", 10)
+	assert.ErrorAs(t, err, &inputErr)
+	assert.Equal(t, "> ", inputErr.Value)
+
+	_, err = CastStringToUint16("12", 2)
+	assert.ErrorAs(t, err, &inputErr)
+	assert.Equal(t, 2, inputErr.Base)
+
+	var castErr *CastError
+	_, err = CastInterfaceToUint8(uint16(1))
+	assert.ErrorAs(t, err, &castErr)
+	assert.Equal(t, &CastError{Value: uint16(1), Expected: "uint8"}, castErr)
+	assert.EqualError(t, err, "casting uint8 error, val: 1 (uint16)")
+
+	_, err = CastInterfaceToUint16(uint8(1))
+	assert.ErrorAs(t, err, &castErr)
+	assert.Equal(t, "uint16", castErr.Expected)
+}
+
+func Fuzz_CastString(f *testing.F) {
+	paths, err := filepath.Glob("../programs/*.txt")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			f.Add(line, 2)
+		}
+	}
+	f.Add("> 100\n", 10)
+	f.Add("99999999999999999999", 10)
+	f.Add("12", 2)
+
+	f.Fuzz(func(t *testing.T, sVal string, base int) {
+		val8, err8 := CastStringToUint8(sVal, base)
+		val16, err16 := CastStringToUint16(sVal, base)
+
+		// both take the same strings, the 8 bits one keeps the low byte
+		if err8 != nil || err16 != nil {
+			var inputErr *InputError
+			assert.ErrorAs(t, err8, &inputErr)
+			assert.Equal(t, sVal, inputErr.Value)
+			assert.ErrorAs(t, err16, &inputErr)
+			assert.Equal(t, base, inputErr.Base)
+			return
+		}
+		assert.Equal(t, uint8(val16), val8)
+
+		if base >= 2 && base <= 10 { // only digits survive
+			val, err := CastStringToUint16(strconv.FormatUint(uint64(val16), base), base)
+			assert.NoError(t, err)
+			assert.Equal(t, val16, val)
+		}
+	})
+}